@@ -4,14 +4,17 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 )
 
 type RequestPayload struct {
-	Action string      `json:"action"`
-	Auth   AuthPayload `json:"auth,omitempty"`
-	Mail   MailPayload `json:"mail,omitempty"`
-	Knn    KnnPayload  `json:"knn,omitempty"`
+	Action string       `json:"action"`
+	Auth   AuthPayload  `json:"auth,omitempty"`
+	Mail   MailPayload  `json:"mail,omitempty"`
+	Knn    KnnPayload   `json:"knn,omitempty"`
+	Batch  []KnnPayload `json:"batch,omitempty"`
 }
 
 type MailPayload struct {
@@ -26,21 +29,11 @@ type AuthPayload struct {
 	Password string `json:"password"`
 }
 
-type KnnPayload struct {
-	Age                                int     `json:"age"`
-	Gender                             int     `json:"gender"`
-	ChestPain                          int     `json:"chest_pain"`
-	RestingBloodPressure               int     `json:"resting_blood_pressure"`
-	CholestoralInMg                    int     `json:"cholestoral_in_mg"`
-	FastingBloodSugar                  int     `json:"fasting_blood_sugar"`
-	RestingElectrocardiographicResults int     `json:"resting_electrocardiographic_results"`
-	MaximumHeartRateAchieved           int     `json:"maximum_heart_rate_achieved"`
-	ExerciseInducedAngina              int     `json:"exercise_induced_angina"`
-	PreviousPeak                       float64 `json:"previous_peak"`
-	SlopeOfThePeakExercise             int     `json:"slope_of_the_peak_exercise"`
-	NumberOfMajorVessels               int     `json:"number_of_major_vessels"`
-	Thalassemia                        int     `json:"thalassemia"`
-}
+// KnnPayload holds the patient features keyed by the field names of the knn service dataset schema
+// and an optional "options" object overriding the knn settings (k, metric, weighting...) for this request.
+// The broker only checks its shape and passes it through so new features or settings don't need to be
+// declared here, the knn service validates the features against its schema
+type KnnPayload map[string]any
 
 // Broker handler for the Config type
 func (app *Config) Broker(write http.ResponseWriter, read *http.Request) {
@@ -56,15 +49,28 @@ func (app *Config) Broker(write http.ResponseWriter, read *http.Request) {
 
 // Handling the frontend submission
 func (app *Config) HandleSubmission(write http.ResponseWriter, read *http.Request) {
+	var body json.RawMessage
 	var request_payload RequestPayload
 
 	// Writing the json as RequestPayload and search for errors
-	possible_error := app.readJSON(write, read, &request_payload)
+	possible_error := app.readJSON(write, read, &body)
+	if possible_error == nil {
+		possible_error = json.Unmarshal(body, &request_payload)
+	}
 	if possible_error != nil {
 		app.errorJSON(write, possible_error)
 		return
 	}
 
+	// A misspelled field of a knn request would be dropped and the patient scored without it
+	if strings.HasPrefix(request_payload.Action, "knn") {
+		possible_error = app.readStrictJSON(body, &request_payload)
+		if possible_error != nil {
+			app.errorJSON(write, possible_error)
+			return
+		}
+	}
+
 	// Run the correct service to call
 	switch request_payload.Action {
 	case "auth":
@@ -73,6 +79,10 @@ func (app *Config) HandleSubmission(write http.ResponseWriter, read *http.Reques
 		app.sendMail(write, request_payload.Mail)
 	case "knn":
 		app.calculateKNN(write, request_payload.Knn)
+	case "knn-batch":
+		app.calculateKNNBatch(write, request_payload.Batch)
+	case "knn-info":
+		app.knnInfo(write)
 	default:
 		app.errorJSON(write, errors.New("unknown action"))
 	}
@@ -119,7 +129,7 @@ func (app *Config) authenticate(write http.ResponseWriter, authentic AuthPayload
 	}
 
 	if jsonFromService.Error {
-		app.errorJSON(write, possible_error, http.StatusUnauthorized)
+		app.errorJSON(write, errors.New(jsonFromService.Message), http.StatusUnauthorized)
 		return
 	}
 
@@ -171,6 +181,13 @@ func (app *Config) sendMail(write http.ResponseWriter, msg MailPayload) {
 }
 
 func (app *Config) calculateKNN(write http.ResponseWriter, authentic KnnPayload) {
+	// Report every malformed field at once without calling the service
+	field_errors := authentic.validate()
+	if len(field_errors) > 0 {
+		app.writeJSON(write, http.StatusUnprocessableEntity, jsonResponse{Error: true, Message: describeFields(field_errors), Data: field_errors})
+		return
+	}
+
 	// Create some json we'll send to the knn microservice
 	jsonData, _ := json.MarshalIndent(authentic, "", "\t")
 
@@ -190,24 +207,95 @@ func (app *Config) calculateKNN(write http.ResponseWriter, authentic KnnPayload)
 	}
 	defer response.Body.Close()
 
+	// Create a varible we'll read response.Body into
+	var jsonFromService jsonResponse
+
+	// Decode the json from the knn service
+	possible_error = json.NewDecoder(response.Body).Decode(&jsonFromService)
+	if possible_error != nil {
+		app.errorJSON(write, errors.New("error calling knn service"))
+		return
+	}
+
+	// Pass the invalid fields found by the knn service on to the frontend
+	if response.StatusCode == http.StatusUnprocessableEntity {
+		app.writeJSON(write, http.StatusUnprocessableEntity, jsonFromService)
+		return
+	}
+
 	// Make sure we get back the right status code
 	if response.StatusCode != http.StatusAccepted {
-		app.errorJSON(write, errors.New("error calling knn service"))
+		app.errorJSON(write, fmt.Errorf("error calling knn service: %s", jsonFromService.Message))
+		return
+	}
+
+	if jsonFromService.Error {
+		app.errorJSON(write, errors.New(jsonFromService.Message), http.StatusUnauthorized)
 		return
 	}
 
+	// Sending response back to frontend
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = jsonFromService.Message
+	payload.Data = jsonFromService.Data
+
+	app.writeJSON(write, http.StatusAccepted, payload)
+}
+
+func (app *Config) calculateKNNBatch(write http.ResponseWriter, patients []KnnPayload) {
+	if len(patients) == 0 {
+		app.errorJSON(write, errors.New("batch must have at least one patient"))
+		return
+	}
+
+	// Report the malformed fields of every patient at once, prefixed by the patient position
+	var field_errors []fieldError
+	for index, patient := range patients {
+		for _, field_error := range patient.validate() {
+			field_error.Field = fmt.Sprintf("batch[%d].%s", index, field_error.Field)
+			field_errors = append(field_errors, field_error)
+		}
+	}
+	if len(field_errors) > 0 {
+		app.writeJSON(write, http.StatusUnprocessableEntity, jsonResponse{Error: true, Message: describeFields(field_errors), Data: field_errors})
+		return
+	}
+
+	// Create some json we'll send to the knn microservice
+	jsonData, _ := json.Marshal(patients)
+
+	// Call the service
+	request, possible_error := http.NewRequest("POST", "http://knn/knn/batch", bytes.NewBuffer(jsonData))
+	if possible_error != nil {
+		app.errorJSON(write, possible_error)
+		return
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	// Creating new client and try to send the request to the service
+	client := &http.Client{}
+	response, possible_error := client.Do(request)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error)
+		return
+	}
+	defer response.Body.Close()
+
 	// Create a varible we'll read response.Body into
 	var jsonFromService jsonResponse
 
 	// Decode the json from the knn service
 	possible_error = json.NewDecoder(response.Body).Decode(&jsonFromService)
 	if possible_error != nil {
-		app.errorJSON(write, possible_error)
+		app.errorJSON(write, errors.New("error calling knn service"))
 		return
 	}
 
-	if jsonFromService.Error {
-		app.errorJSON(write, possible_error, http.StatusUnauthorized)
+	// Make sure we get back the right status code
+	if response.StatusCode != http.StatusAccepted || jsonFromService.Error {
+		app.errorJSON(write, fmt.Errorf("error calling knn service: %s", jsonFromService.Message))
 		return
 	}
 
@@ -219,3 +307,47 @@ func (app *Config) calculateKNN(write http.ResponseWriter, authentic KnnPayload)
 
 	app.writeJSON(write, http.StatusAccepted, payload)
 }
+
+// This function asks the knn service which model answers the predictions: its version, algorithm,
+// settings, training set and evaluation metrics
+func (app *Config) knnInfo(write http.ResponseWriter) {
+	// Call the service
+	request, possible_error := http.NewRequest("GET", "http://knn/knn/model", nil)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error)
+		return
+	}
+
+	// Creating new client and try to send the request to the service
+	client := &http.Client{}
+	response, possible_error := client.Do(request)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error)
+		return
+	}
+	defer response.Body.Close()
+
+	// Create a varible we'll read response.Body into
+	var jsonFromService jsonResponse
+
+	// Decode the json from the knn service
+	possible_error = json.NewDecoder(response.Body).Decode(&jsonFromService)
+	if possible_error != nil {
+		app.errorJSON(write, errors.New("error calling knn service"))
+		return
+	}
+
+	// Make sure we get back the right status code
+	if response.StatusCode != http.StatusOK || jsonFromService.Error {
+		app.errorJSON(write, fmt.Errorf("error calling knn service: %s", jsonFromService.Message))
+		return
+	}
+
+	// Sending response back to frontend
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = jsonFromService.Message
+	payload.Data = jsonFromService.Data
+
+	app.writeJSON(write, http.StatusOK, payload)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// stubService answers the calls of the broker in place of the other services and keeps them
+type stubService struct {
+	status int
+	body   string
+	calls  []stubCall
+}
+
+// stubCall is a request the broker sent to a service
+type stubCall struct {
+	method       string
+	url          string
+	content_type string
+	body         string
+}
+
+func (service *stubService) RoundTrip(request *http.Request) (*http.Response, error) {
+	call := stubCall{method: request.Method, url: request.URL.String(), content_type: request.Header.Get("Content-Type")}
+
+	if request.Body != nil {
+		body, possible_error := io.ReadAll(request.Body)
+		if possible_error != nil {
+			return nil, possible_error
+		}
+		call.body = string(body)
+	}
+	service.calls = append(service.calls, call)
+
+	response := &http.Response{
+		StatusCode: service.status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(service.body)),
+		Request:    request,
+	}
+
+	return response, nil
+}
+
+// This function makes the broker call the stub instead of the network for the rest of the test
+func stub_services(t *testing.T, status int, body string) *stubService {
+	service := &stubService{status: status, body: body}
+
+	transport := http.DefaultTransport
+	http.DefaultTransport = service
+	t.Cleanup(func() { http.DefaultTransport = transport })
+
+	return service
+}
+
+// This function sends a submission to the broker and decodes its answer
+func submit(t *testing.T, submission string) (int, jsonResponse) {
+	t.Helper()
+
+	app := Config{}
+	recorder := httptest.NewRecorder()
+	app.routes().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/handle", strings.NewReader(submission)))
+
+	var response jsonResponse
+	possible_error := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if possible_error != nil {
+		t.Fatalf("response %q is not json: %v", recorder.Body.String(), possible_error)
+	}
+
+	return recorder.Code, response
+}
+
+// This function returns the fields of the field errors of a response
+func fields_of(t *testing.T, response jsonResponse) []string {
+	t.Helper()
+
+	content, _ := json.Marshal(response.Data)
+
+	var field_errors []fieldError
+	possible_error := json.Unmarshal(content, &field_errors)
+	if possible_error != nil {
+		t.Fatalf("data %s: %v", content, possible_error)
+	}
+
+	var fields []string
+	for _, field_error := range field_errors {
+		fields = append(fields, field_error.Field)
+	}
+
+	return fields
+}
+
+func TestBroker(t *testing.T) {
+	app := Config{}
+	recorder := httptest.NewRecorder()
+	app.routes().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d, expected %d", recorder.Code, http.StatusOK)
+	}
+}
+
+func TestKNN(t *testing.T) {
+	service := stub_services(t, http.StatusAccepted, `{"error": false, "message": "The result is: Yes", "data": {"class": 1, "probability": 0.8}}`)
+
+	status, response := submit(t, `{"action": "knn", "knn": {"age": 63, "thalassemia": null, "options": {"k": 7, "missing": "mean"}}}`)
+
+	if status != http.StatusAccepted || response.Error || response.Message != "The result is: Yes" {
+		t.Fatalf("status %d with %+v", status, response)
+	}
+
+	data, _ := response.Data.(map[string]any)
+	if data["class"] != 1.0 || data["probability"] != 0.8 {
+		t.Fatalf("data %v, expected the prediction of the knn service", response.Data)
+	}
+
+	if len(service.calls) != 1 || service.calls[0].method != http.MethodPost || service.calls[0].url != "http://knn/knn" {
+		t.Fatalf("calls %+v, expected one to the knn service", service.calls)
+	}
+
+	// The features, the null ones and the options reach the knn service as they were sent
+	var sent map[string]any
+	json.Unmarshal([]byte(service.calls[0].body), &sent)
+
+	options, _ := sent["options"].(map[string]any)
+	if value, found := sent["thalassemia"]; sent["age"] != 63.0 || !found || value != nil || options["k"] != 7.0 || options["missing"] != "mean" {
+		t.Fatalf("sent %v", sent)
+	}
+}
+
+func TestKNNService(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		answer int
+		fields []string
+	}{
+		{"invalid fields", http.StatusUnprocessableEntity, `{"error": true, "message": "1 invalid field", "data": [{"field": "age", "value": "130", "reason": "must be at most 120"}]}`, http.StatusUnprocessableEntity, []string{"age"}},
+		{"refused settings", http.StatusBadRequest, `{"error": true, "message": "unknown metric"}`, http.StatusBadRequest, nil},
+		{"not json", http.StatusBadGateway, `bad gateway`, http.StatusBadRequest, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub_services(t, test.status, test.body)
+
+			status, response := submit(t, `{"action": "knn", "knn": {"age": 130}}`)
+			if status != test.answer || !response.Error {
+				t.Fatalf("status %d with %+v, expected an error with %d", status, response, test.answer)
+			}
+
+			if test.fields != nil {
+				if fields := fields_of(t, response); len(fields) != 1 || fields[0] != test.fields[0] {
+					t.Fatalf("fields %v, expected %v", fields, test.fields)
+				}
+			}
+		})
+	}
+}
+
+func TestKNNRefuses(t *testing.T) {
+	tests := []struct {
+		name       string
+		submission string
+		status     int
+		fields     []string
+	}{
+		{"not json", `{"action": "knn"`, http.StatusBadRequest, nil},
+		{"unknown action", `{"action": "guess"}`, http.StatusBadRequest, nil},
+		{"misspelled field", `{"action": "knn", "kn": {"age": 63}}`, http.StatusBadRequest, nil},
+		{"no features", `{"action": "knn", "knn": {}}`, http.StatusUnprocessableEntity, []string{"knn"}},
+		{"not numbers", `{"action": "knn", "knn": {"sex": "male", "age": "63", "options": 7}}`, http.StatusUnprocessableEntity, []string{"age", "options", "sex"}},
+		{"empty batch", `{"action": "knn-batch", "batch": []}`, http.StatusBadRequest, nil},
+		{"invalid patients", `{"action": "knn-batch", "batch": [{"age": 63}, {"age": true}, {}]}`, http.StatusUnprocessableEntity, []string{"batch[1].age", "batch[2].knn"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := stub_services(t, http.StatusAccepted, `{"error": false}`)
+
+			status, response := submit(t, test.submission)
+			if status != test.status || !response.Error {
+				t.Fatalf("status %d with %+v, expected an error with %d", status, response, test.status)
+			}
+
+			if test.fields != nil {
+				if fields := fields_of(t, response); strings.Join(fields, ",") != strings.Join(test.fields, ",") {
+					t.Fatalf("fields %v, expected %v", fields, test.fields)
+				}
+			}
+
+			// A request the broker refuses never reaches the knn service
+			if len(service.calls) > 0 {
+				t.Fatalf("calls %+v, expected none", service.calls)
+			}
+		})
+	}
+}
+
+func TestKNNBatch(t *testing.T) {
+	service := stub_services(t, http.StatusAccepted, `{"error": false, "message": "Scored 2 patients, 0 failed", "data": [{"row": 1}, {"row": 2}]}`)
+
+	status, response := submit(t, `{"action": "knn-batch", "batch": [{"age": 63}, {"age": 41, "options": {"k": 3}}]}`)
+
+	if status != http.StatusAccepted || response.Error || response.Message != "Scored 2 patients, 0 failed" {
+		t.Fatalf("status %d with %+v", status, response)
+	}
+
+	call := service.calls[0]
+	if len(service.calls) != 1 || call.url != "http://knn/knn/batch" || call.content_type != "application/json" {
+		t.Fatalf("calls %+v, expected one to the batch endpoint", service.calls)
+	}
+
+	var sent []map[string]any
+	json.Unmarshal([]byte(call.body), &sent)
+
+	if len(sent) != 2 || sent[1]["age"] != 41.0 || sent[1]["options"] == nil {
+		t.Fatalf("sent %v", sent)
+	}
+
+	// A batch the knn service refuses is an error
+	stub_services(t, http.StatusRequestEntityTooLarge, `{"error": true, "message": "batch has 10001 patients"}`)
+
+	status, response = submit(t, `{"action": "knn-batch", "batch": [{"age": 63}]}`)
+	if status != http.StatusBadRequest || !strings.Contains(response.Message, "10001 patients") {
+		t.Fatalf("status %d with %+v", status, response)
+	}
+}
+
+func TestKNNInfo(t *testing.T) {
+	service := stub_services(t, http.StatusOK, `{"error": false, "message": "Model knn-1a2b", "data": {"version": "knn-1a2b"}}`)
+
+	status, response := submit(t, `{"action": "knn-info"}`)
+
+	if status != http.StatusOK || response.Message != "Model knn-1a2b" || len(service.calls) != 1 || service.calls[0].url != "http://knn/knn/model" {
+		t.Fatalf("status %d with %+v after calls %+v", status, response, service.calls)
+	}
+
+	stub_services(t, http.StatusInternalServerError, `{"error": true, "message": "no model"}`)
+
+	status, response = submit(t, `{"action": "knn-info"}`)
+	if status != http.StatusBadRequest || !response.Error {
+		t.Fatalf("status %d with %+v", status, response)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	payload := KnnPayload{"age": 63.0, "gender": nil, "options": map[string]any{}, "chest_pain": "3", "previous_peak": []any{1.0}}
+
+	field_errors := payload.validate()
+
+	expected := []fieldError{
+		{Field: "chest_pain", Value: `"3"`, Reason: "must be a number"},
+		{Field: "previous_peak", Value: `[1]`, Reason: "must be a number"},
+	}
+
+	if len(field_errors) != len(expected) {
+		t.Fatalf("field errors %+v, expected %+v", field_errors, expected)
+	}
+	for index := range expected {
+		if field_errors[index] != expected[index] {
+			t.Errorf("field error %+v, expected %+v", field_errors[index], expected[index])
+		}
+	}
+
+	if message := describeFields(field_errors); !strings.HasPrefix(message, "request has 2 invalid fields") {
+		t.Fatalf("message %q", message)
+	}
+}
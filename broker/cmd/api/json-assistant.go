@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"io"
@@ -36,6 +37,15 @@ func (app *Config) readJSON(write http.ResponseWriter, read *http.Request, data
 	return nil
 }
 
+// readStrictJSON decodes a JSON body already read and rejects the fields the data structure doesn't
+// declare instead of silently dropping them
+func (app *Config) readStrictJSON(body []byte, data any) error {
+	decoded_data := json.NewDecoder(bytes.NewReader(body))
+	decoded_data.DisallowUnknownFields()
+
+	return decoded_data.Decode(data)
+}
+
 // writeJSON takes a response status code and arbitrary data and writes a JSON response to the client
 func (app *Config) writeJSON(write http.ResponseWriter, status int, data any, headers ...http.Header) error {
 	// Marshal the data into a JSON byte slice
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// fieldError describes a field of a knn payload that can't be sent to the knn service,
+// it has the same shape as the field errors the knn service returns with status 422
+type fieldError struct {
+	Field  string `json:"field"`
+	Value  string `json:"value,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// This function checks the shape of the payload before it is sent: every feature must be a finite
+// number or null when it is unknown, and "options" must be an object. Whether a missing feature is
+// imputed or refused, the clinical ranges and the list of known fields belong to the knn service,
+// which checks them and answers with every violation.
+func (payload KnnPayload) validate() []fieldError {
+	var field_errors []fieldError
+
+	if len(payload) == 0 {
+		return []fieldError{{Field: "knn", Reason: "must hold the patient features"}}
+	}
+
+	for key, value := range payload {
+		if key == "options" {
+			if _, is_object := value.(map[string]any); !is_object {
+				field_errors = append(field_errors, fieldError{Field: key, Value: describe(value), Reason: "must be an object"})
+			}
+			continue
+		}
+
+		// The knn service fills a null feature or leaves it out as its missing value policy says
+		if value == nil {
+			continue
+		}
+
+		number, is_number := value.(float64)
+		if !is_number || math.IsNaN(number) || math.IsInf(number, 0) {
+			field_errors = append(field_errors, fieldError{Field: key, Value: describe(value), Reason: "must be a number"})
+		}
+	}
+
+	// Map iteration is random, keep the reported fields in a stable order
+	slices.SortFunc(field_errors, func(a, b fieldError) int { return strings.Compare(a.Field, b.Field) })
+
+	return field_errors
+}
+
+// This function writes a json value back as text to show it in a field error
+func describe(value any) string {
+	content, possible_error := json.Marshal(value)
+	if possible_error != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(content)
+}
+
+// This function summarizes the field errors in one message
+func describeFields(field_errors []fieldError) string {
+	var messages []string
+
+	for _, field_error := range field_errors {
+		messages = append(messages, fmt.Sprintf("field %s %s", field_error.Field, field_error.Reason))
+	}
+
+	return fmt.Sprintf("request has %d invalid fields: %s", len(field_errors), strings.Join(messages, "; "))
+}
@@ -0,0 +1,355 @@
+package artifact
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"knn/classifier"
+	"knn/data"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// The version of the file layout, a service refuses the artifacts of a layout it doesn't know
+const Format = 1
+
+// Hyperparameters is how a model is built from a dataset: the scaler, the default knn settings and
+// index, how missing features are handled and which algorithm answers by default
+type Hyperparameters struct {
+	ScalerMethod string                  `json:"scaler"`
+	Defaults     classifier.Settings     `json:"settings"`
+	Index        classifier.IndexOptions `json:"index"`
+	Missing      string                  `json:"missing"`
+	Algorithm    string                  `json:"algorithm"`
+}
+
+// This function makes sure a model can be built with the hyperparameters on a training set with the
+// given number of rows, k can't ask for more neighbors than there are rows
+func (hyperparameters Hyperparameters) Validate(rows int) error {
+	if !data.ValidScalerMethod(hyperparameters.ScalerMethod) {
+		return fmt.Errorf("unknown scaler method %q", hyperparameters.ScalerMethod)
+	}
+
+	possible_error := hyperparameters.Defaults.Validate(rows)
+	if possible_error != nil {
+		return possible_error
+	}
+
+	if !data.ValidMissingPolicy(hyperparameters.Missing) {
+		return fmt.Errorf("unknown missing value policy %q", hyperparameters.Missing)
+	}
+
+	if !slices.Contains(classifier.ModelNames(), hyperparameters.Algorithm) {
+		return fmt.Errorf("unknown model %q", hyperparameters.Algorithm)
+	}
+
+	return nil
+}
+
+// DatasetInfo identifies the rows a model was trained on, the hash covers the parsed rows so the
+// same data gives the same hash whatever the formatting of the csv file
+type DatasetInfo struct {
+	Source string `json:"source"`
+	SHA256 string `json:"sha256"`
+	Rows   int    `json:"rows"`
+}
+
+// Metadata describes an artifact without its rows. The version is derived from the dataset, the
+// schema and the hyperparameters so training the same model twice gives the same version, the
+// checksum covers the whole artifact.
+type Metadata struct {
+	Format          int                      `json:"format"`
+	Version         string                   `json:"version"`
+	CreatedAt       time.Time                `json:"created_at"`
+	Dataset         DatasetInfo              `json:"dataset"`
+	Hyperparameters Hyperparameters          `json:"hyperparameters"`
+	Evaluations     []*classifier.Evaluation `json:"evaluations,omitempty"`
+	Checksum        string                   `json:"checksum,omitempty"`
+}
+
+// Artifact is everything needed to rebuild a trained model exactly: the schema, the encoded feature
+// names, the fitted scaler and the training rows. The algorithms are refitted on the rows when the
+// artifact is loaded, their fitting is deterministic.
+type Artifact struct {
+	Metadata
+	Schema   *data.Schema `json:"schema"`
+	Encoder  []string     `json:"encoder"`
+	Scaler   *data.Scaler `json:"scaler"`
+	Features [][]float64  `json:"features"`
+	Labels   []int        `json:"labels"`
+}
+
+// envelope is the file layout, the checksum is the sha256 of the artifact bytes as written
+type envelope struct {
+	SHA256   string          `json:"sha256"`
+	Artifact json.RawMessage `json:"artifact"`
+}
+
+// This function fits the encoder and the scaler on the dataset and records them with the
+// hyperparameters. With folds of at least 2 every algorithm is cross validated with the seed
+// and the evaluations are kept so the artifact says how good it is.
+func Train(dataset *data.Dataset, source string, hyperparameters Hyperparameters, folds int, seed uint64) (*Artifact, error) {
+	possible_error := hyperparameters.Validate(len(dataset.Features))
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	hyperparameters.Index = hyperparameters.Index.Resolve()
+
+	encoder := data.NewEncoder(dataset.Schema)
+	scaler, possible_error := data.FitScaler(hyperparameters.ScalerMethod, encoder.EncodeAll(dataset.Features))
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	trained := &Artifact{
+		Metadata: Metadata{
+			Format:          Format,
+			CreatedAt:       time.Now().UTC(),
+			Dataset:         DatasetInfo{Source: source, SHA256: HashDataset(dataset), Rows: len(dataset.Labels)},
+			Hyperparameters: hyperparameters,
+		},
+		Schema:   dataset.Schema,
+		Encoder:  encoder.Names,
+		Scaler:   scaler,
+		Features: dataset.Features,
+		Labels:   dataset.Labels,
+	}
+
+	trained.Version, possible_error = trained.version()
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	if folds >= 2 {
+		for _, name := range classifier.ModelNames() {
+			evaluation, possible_error := classifier.CrossValidate(dataset, name, hyperparameters.ScalerMethod, hyperparameters.Defaults, folds, seed)
+			if possible_error != nil {
+				return nil, fmt.Errorf("can't evaluate %s: %w", name, possible_error)
+			}
+			trained.Evaluations = append(trained.Evaluations, evaluation)
+		}
+	}
+
+	_, possible_error = trained.seal()
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	return trained, nil
+}
+
+// This function returns the sha256 of the rows of a dataset, one line per row with the label last
+func HashDataset(dataset *data.Dataset) string {
+	hash := sha256.New()
+	line := []byte{}
+
+	for index, row := range dataset.Features {
+		line = line[:0]
+		for _, value := range row {
+			line = strconv.AppendFloat(line, value, 'g', -1, 64)
+			line = append(line, ',')
+		}
+		line = strconv.AppendInt(line, int64(dataset.Labels[index]), 10)
+		line = append(line, '\n')
+		hash.Write(line)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// This function derives the version from what decides the behavior of the model
+func (trained *Artifact) version() (string, error) {
+	identity, possible_error := json.Marshal(struct {
+		Dataset         string          `json:"dataset"`
+		Schema          *data.Schema    `json:"schema"`
+		Hyperparameters Hyperparameters `json:"hyperparameters"`
+	}{trained.Dataset.SHA256, trained.Schema, trained.Hyperparameters})
+	if possible_error != nil {
+		return "", possible_error
+	}
+
+	sum := sha256.Sum256(identity)
+
+	return "knn-" + hex.EncodeToString(sum[:6]), nil
+}
+
+// This function encodes the artifact without its checksum and sets the checksum of the encoding
+func (trained *Artifact) seal() ([]byte, error) {
+	trained.Checksum = ""
+
+	content, possible_error := json.Marshal(trained)
+	if possible_error != nil {
+		return nil, fmt.Errorf("can't encode artifact: %w", possible_error)
+	}
+
+	sum := sha256.Sum256(content)
+	trained.Checksum = hex.EncodeToString(sum[:])
+
+	return content, nil
+}
+
+// This function returns the cross validated metrics of the default algorithm of the artifact,
+// nil when it was trained without evaluation
+func (trained *Artifact) Metrics() *classifier.Metrics {
+	for _, evaluation := range trained.Evaluations {
+		if evaluation.Model == trained.Hyperparameters.Algorithm {
+			return &evaluation.Metrics
+		}
+	}
+
+	return nil
+}
+
+// This function rebuilds the dataset the artifact was trained on
+func (trained *Artifact) TrainingSet() *data.Dataset {
+	return &data.Dataset{Schema: trained.Schema, Features: trained.Features, Labels: trained.Labels}
+}
+
+// This function writes the artifact and its checksum to the file
+func (trained *Artifact) Save(file_name string) error {
+	content, possible_error := trained.seal()
+	if possible_error != nil {
+		return possible_error
+	}
+
+	encoded, possible_error := json.Marshal(envelope{SHA256: trained.Checksum, Artifact: content})
+	if possible_error != nil {
+		return fmt.Errorf("can't encode artifact: %w", possible_error)
+	}
+
+	return write_file(file_name, append(encoded, '\n'))
+}
+
+// This function replaces the file with the content, a reader never sees a half written file
+// because the content is written aside and renamed over it
+func write_file(file_name string, content []byte) error {
+	temporary, possible_error := os.CreateTemp(filepath.Dir(file_name), filepath.Base(file_name)+".*")
+	if possible_error != nil {
+		return fmt.Errorf("can't write %s: %w", file_name, possible_error)
+	}
+	defer os.Remove(temporary.Name())
+
+	// A temporary file is only readable by its owner, the files are read by the service
+	possible_error = temporary.Chmod(0o644)
+	if possible_error == nil {
+		_, possible_error = temporary.Write(content)
+	}
+	if possible_error == nil {
+		possible_error = temporary.Close()
+	} else {
+		temporary.Close()
+	}
+	if possible_error != nil {
+		return fmt.Errorf("can't write %s: %w", file_name, possible_error)
+	}
+
+	possible_error = os.Rename(temporary.Name(), file_name)
+	if possible_error != nil {
+		return fmt.Errorf("can't write %s: %w", file_name, possible_error)
+	}
+
+	return nil
+}
+
+// This function reads an artifact and refuses it if its checksum doesn't match its content,
+// if its layout is unknown or if its parts don't fit together
+func Load(file_name string) (*Artifact, error) {
+	content, possible_error := os.ReadFile(file_name)
+	if possible_error != nil {
+		return nil, fmt.Errorf("can't read artifact: %w", possible_error)
+	}
+
+	var sealed envelope
+	possible_error = json.Unmarshal(content, &sealed)
+	if possible_error != nil {
+		return nil, fmt.Errorf("can't decode artifact: %w", possible_error)
+	}
+
+	sum := sha256.Sum256(sealed.Artifact)
+	if hex.EncodeToString(sum[:]) != sealed.SHA256 {
+		return nil, errors.New("artifact checksum doesn't match its content")
+	}
+
+	var trained Artifact
+	decoder := json.NewDecoder(bytes.NewReader(sealed.Artifact))
+	decoder.DisallowUnknownFields()
+
+	possible_error = decoder.Decode(&trained)
+	if possible_error != nil {
+		return nil, fmt.Errorf("can't decode artifact: %w", possible_error)
+	}
+	trained.Checksum = sealed.SHA256
+
+	possible_error = trained.check()
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	return &trained, nil
+}
+
+// This function makes sure a decoded artifact describes a model this service can rebuild
+func (trained *Artifact) check() error {
+	if trained.Format != Format {
+		return fmt.Errorf("artifact format %d is not supported, expected %d", trained.Format, Format)
+	}
+
+	if trained.Schema == nil || trained.Scaler == nil {
+		return errors.New("artifact must have a schema and a scaler")
+	}
+
+	possible_error := trained.Schema.Check()
+	if possible_error != nil {
+		return possible_error
+	}
+
+	if !slices.Equal(data.NewEncoder(trained.Schema).Names, trained.Encoder) {
+		return errors.New("artifact encoder doesn't match its schema")
+	}
+
+	// The scaler works on the encoded rows, a hand edited vector of another length would panic
+	if !data.ValidScalerMethod(trained.Scaler.Method) {
+		return fmt.Errorf("artifact scaler method %q is unknown", trained.Scaler.Method)
+	}
+	for name, vector := range map[string][]float64{
+		"min": trained.Scaler.Min, "max": trained.Scaler.Max, "mean": trained.Scaler.Mean,
+		"std": trained.Scaler.Std, "median": trained.Scaler.Median, "iqr": trained.Scaler.IQR,
+	} {
+		if len(vector) != len(trained.Encoder) {
+			return fmt.Errorf("artifact scaler %s has %d values, the encoder has %d columns", name, len(vector), len(trained.Encoder))
+		}
+	}
+
+	if len(trained.Features) == 0 || len(trained.Features) != len(trained.Labels) {
+		return errors.New("artifact must have one label per training row")
+	}
+
+	features := len(trained.Schema.Features())
+	for index, row := range trained.Features {
+		if len(row) != features {
+			return fmt.Errorf("artifact row %d has %d features, the schema has %d", index+1, len(row), features)
+		}
+	}
+
+	if HashDataset(trained.TrainingSet()) != trained.Dataset.SHA256 {
+		return errors.New("artifact rows don't match their dataset hash")
+	}
+
+	version, possible_error := trained.version()
+	if possible_error != nil {
+		return possible_error
+	}
+
+	if version != trained.Version {
+		return fmt.Errorf("artifact version %s doesn't match its content, expected %s", trained.Version, version)
+	}
+
+	return trained.Hyperparameters.Validate(len(trained.Features))
+}
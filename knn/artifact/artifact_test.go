@@ -0,0 +1,159 @@
+package artifact
+
+import (
+	"bytes"
+	"knn/classifier"
+	"knn/data"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// This function trains an artifact on heart.csv, every algorithm is cross validated with folds of
+// at least 2
+func train_heart(t *testing.T, folds int) *Artifact {
+	t.Helper()
+
+	schema, possible_error := data.DefaultSchema()
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	dataset, possible_error := data.LoadDataset("../../heart.csv", schema)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	hyperparameters := Hyperparameters{
+		ScalerMethod: data.ScalerMinMax,
+		Defaults:     classifier.Settings{K: 5, Metric: classifier.MetricEuclidean, TieBreak: classifier.TieNearest, Weighting: classifier.WeightUniform},
+		Missing:      data.MissingMean,
+		Algorithm:    classifier.ModelKNN,
+	}
+
+	trained, possible_error := Train(dataset, "heart.csv", hyperparameters, folds, 42)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	return trained
+}
+
+// A saved artifact loads back with the same checksum, version and rows, and saving it again gives
+// the same file
+func TestSaveLoad(t *testing.T) {
+	trained := train_heart(t, 5)
+	file_name := filepath.Join(t.TempDir(), "artifact.json")
+
+	possible_error := trained.Save(file_name)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	loaded, possible_error := Load(file_name)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	if loaded.Checksum != trained.Checksum || loaded.Version != trained.Version || loaded.Dataset != trained.Dataset {
+		t.Fatalf("loaded %s %s %+v, saved %s %s %+v", loaded.Checksum, loaded.Version, loaded.Dataset, trained.Checksum, trained.Version, trained.Dataset)
+	}
+
+	if HashDataset(loaded.TrainingSet()) != HashDataset(trained.TrainingSet()) {
+		t.Fatal("the loaded rows differ from the saved ones")
+	}
+
+	if *loaded.Metrics() != *trained.Metrics() {
+		t.Fatalf("loaded metrics %+v, saved %+v", loaded.Metrics(), trained.Metrics())
+	}
+
+	again := filepath.Join(t.TempDir(), "artifact.json")
+	possible_error = loaded.Save(again)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	first, _ := os.ReadFile(file_name)
+	second, _ := os.ReadFile(again)
+	if !bytes.Equal(first, second) {
+		t.Fatal("saving the loaded artifact gives another file")
+	}
+}
+
+// This function saves a copy of the artifact changed by hand, with a checksum that matches the
+// change so only the content checks can refuse it
+func resave(t *testing.T, trained *Artifact, change func(*Artifact)) []byte {
+	t.Helper()
+
+	file_name := filepath.Join(t.TempDir(), "artifact.json")
+	possible_error := trained.Save(file_name)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	changed, possible_error := Load(file_name)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+	change(changed)
+
+	possible_error = changed.Save(file_name)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	content, possible_error := os.ReadFile(file_name)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	return content
+}
+
+// Load refuses an artifact whose file was changed after it was saved
+func TestLoadRefuses(t *testing.T) {
+	trained := train_heart(t, 0)
+	directory := t.TempDir()
+	file_name := filepath.Join(directory, "artifact.json")
+
+	possible_error := trained.Save(file_name)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	saved, possible_error := os.ReadFile(file_name)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{"truncated", saved[:len(saved)/2]},
+		{"changed k", bytes.Replace(saved, []byte(`"k":5`), []byte(`"k":7`), 1)},
+		{"changed checksum", bytes.Replace(saved, []byte(trained.Checksum), bytes.Repeat([]byte("0"), len(trained.Checksum)), 1)},
+		{"not json", []byte("artifact")},
+		{"short scaler", resave(t, trained, func(changed *Artifact) { changed.Scaler.Std = changed.Scaler.Std[1:] })},
+		{"unknown scaler", resave(t, trained, func(changed *Artifact) { changed.Scaler.Method = "zscore" })},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if bytes.Equal(test.content, saved) {
+				t.Fatal("the file wasn't changed")
+			}
+
+			changed := filepath.Join(directory, "changed.json")
+			possible_error := os.WriteFile(changed, test.content, 0o644)
+			if possible_error != nil {
+				t.Fatal(possible_error)
+			}
+
+			_, possible_error = Load(changed)
+			if possible_error == nil {
+				t.Fatal("expected the changed artifact to be refused")
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package artifact
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"knn/classifier"
+	"knn/data"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The files of a store: every version has its own directory holding its description, its rows
+// as csv and the artifact trained on them
+const (
+	active_file   = "active"
+	history_file  = "history.jsonl"
+	version_file  = "version.json"
+	dataset_file  = "dataset.csv"
+	artifact_file = "artifact.json"
+)
+
+// ErrUnknownVersion is returned for a version the store doesn't have
+var ErrUnknownVersion = errors.New("unknown dataset version")
+
+// Version is a training set kept by a store with the model trained on it, Cases are the ids of
+// the confirmed predictions folded into its rows
+type Version struct {
+	ID         string              `json:"id"`
+	CreatedAt  time.Time           `json:"created_at"`
+	UploadedBy string              `json:"uploaded_by"`
+	Model      string              `json:"model"`
+	Dataset    DatasetInfo         `json:"dataset"`
+	Metrics    *classifier.Metrics `json:"metrics,omitempty"`
+	Cases      []string            `json:"cases,omitempty"`
+}
+
+// Switch records a change of the active version, who made it and how the new model scored
+type Switch struct {
+	At       time.Time           `json:"at"`
+	By       string              `json:"by"`
+	From     string              `json:"from,omitempty"`
+	To       string              `json:"to"`
+	Rollback bool                `json:"rollback,omitempty"`
+	Model    string              `json:"model"`
+	Metrics  *classifier.Metrics `json:"metrics,omitempty"`
+}
+
+// Store keeps every training set version on disk with its artifact, which one is active and the
+// history of the switches. It only records: the caller builds the model of a version before
+// activating it so a version that can't be served never becomes active.
+type Store struct {
+	directory string
+	mutex     sync.Mutex
+}
+
+// This function opens the store in the directory, creating it if needed
+func OpenStore(directory string) (*Store, error) {
+	possible_error := os.MkdirAll(directory, 0o755)
+	if possible_error != nil {
+		return nil, fmt.Errorf("can't open dataset store: %w", possible_error)
+	}
+
+	return &Store{directory: directory}, nil
+}
+
+// This function keeps a new version made of the rows and the artifact trained on them, the
+// metrics recorded are the ones of the default algorithm of the artifact
+func (store *Store) Add(trained *Artifact, uploaded_by string, cases []string) (Version, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	version := Version{
+		CreatedAt:  time.Now().UTC(),
+		UploadedBy: uploaded_by,
+		Model:      trained.Version,
+		Dataset:    trained.Dataset,
+		Metrics:    trained.Metrics(),
+		Cases:      cases,
+	}
+	id := version.CreatedAt.Format("20060102T150405.000Z") + "-" + trained.Dataset.SHA256[:8]
+
+	// The same rows added twice within a millisecond get a counter so no version is overwritten
+	version.ID = id
+	directory := filepath.Join(store.directory, version.ID)
+	possible_error := os.Mkdir(directory, 0o755)
+	for count := 2; errors.Is(possible_error, os.ErrExist); count++ {
+		version.ID = fmt.Sprintf("%s-%d", id, count)
+		directory = filepath.Join(store.directory, version.ID)
+		possible_error = os.Mkdir(directory, 0o755)
+	}
+	if possible_error != nil {
+		return Version{}, fmt.Errorf("can't add dataset version: %w", possible_error)
+	}
+
+	var rows bytes.Buffer
+	possible_error = data.WriteDataset(&rows, trained.TrainingSet())
+	if possible_error == nil {
+		possible_error = write_file(filepath.Join(directory, dataset_file), rows.Bytes())
+	}
+	if possible_error == nil {
+		possible_error = trained.Save(filepath.Join(directory, artifact_file))
+	}
+	if possible_error == nil {
+		possible_error = write_json(filepath.Join(directory, version_file), version)
+	}
+
+	if possible_error != nil {
+		os.RemoveAll(directory)
+		return Version{}, possible_error
+	}
+
+	return version, nil
+}
+
+// This function returns every version of the store, the oldest first
+func (store *Store) Versions() ([]Version, error) {
+	entries, possible_error := os.ReadDir(store.directory)
+	if possible_error != nil {
+		return nil, fmt.Errorf("can't list dataset versions: %w", possible_error)
+	}
+
+	var versions []Version
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		version, possible_error := store.Version(entry.Name())
+		if possible_error != nil {
+			return nil, possible_error
+		}
+		versions = append(versions, version)
+	}
+
+	slices.SortFunc(versions, func(a, b Version) int { return a.CreatedAt.Compare(b.CreatedAt) })
+
+	return versions, nil
+}
+
+// This function returns the description of a version
+func (store *Store) Version(id string) (Version, error) {
+	var version Version
+
+	if !filepath.IsLocal(id) || strings.ContainsRune(id, filepath.Separator) {
+		return version, ErrUnknownVersion
+	}
+
+	content, possible_error := os.ReadFile(filepath.Join(store.directory, id, version_file))
+	if errors.Is(possible_error, os.ErrNotExist) {
+		return version, ErrUnknownVersion
+	}
+	if possible_error != nil {
+		return version, fmt.Errorf("can't read dataset version %s: %w", id, possible_error)
+	}
+
+	possible_error = json.Unmarshal(content, &version)
+	if possible_error != nil {
+		return version, fmt.Errorf("can't decode dataset version %s: %w", id, possible_error)
+	}
+
+	return version, nil
+}
+
+// This function loads the artifact of a version, checking it like any artifact
+func (store *Store) Load(id string) (*Artifact, error) {
+	_, possible_error := store.Version(id)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	return Load(filepath.Join(store.directory, id, artifact_file))
+}
+
+// This function returns the active version, an empty id when none was activated yet
+func (store *Store) Active() (string, error) {
+	content, possible_error := os.ReadFile(filepath.Join(store.directory, active_file))
+	if errors.Is(possible_error, os.ErrNotExist) {
+		return "", nil
+	}
+	if possible_error != nil {
+		return "", fmt.Errorf("can't read active dataset version: %w", possible_error)
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+// This function makes the version active and appends the switch to the history
+func (store *Store) Activate(id string, by string, rollback bool) (Switch, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	version, possible_error := store.Version(id)
+	if possible_error != nil {
+		return Switch{}, possible_error
+	}
+
+	previous, possible_error := store.Active()
+	if possible_error != nil {
+		return Switch{}, possible_error
+	}
+
+	change := Switch{
+		At:       time.Now().UTC(),
+		By:       by,
+		From:     previous,
+		To:       id,
+		Rollback: rollback,
+		Model:    version.Model,
+		Metrics:  version.Metrics,
+	}
+
+	possible_error = write_file(filepath.Join(store.directory, active_file), []byte(id+"\n"))
+	if possible_error != nil {
+		return Switch{}, possible_error
+	}
+
+	line, possible_error := json.Marshal(change)
+	if possible_error != nil {
+		return Switch{}, possible_error
+	}
+
+	history, possible_error := os.OpenFile(filepath.Join(store.directory, history_file), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if possible_error != nil {
+		return Switch{}, fmt.Errorf("can't record the switch: %w", possible_error)
+	}
+	defer history.Close()
+
+	_, possible_error = history.Write(append(line, '\n'))
+	if possible_error != nil {
+		return Switch{}, fmt.Errorf("can't record the switch: %w", possible_error)
+	}
+
+	return change, nil
+}
+
+// This function returns every switch between versions, the oldest first
+func (store *Store) History() ([]Switch, error) {
+	history, possible_error := os.Open(filepath.Join(store.directory, history_file))
+	if errors.Is(possible_error, os.ErrNotExist) {
+		return nil, nil
+	}
+	if possible_error != nil {
+		return nil, fmt.Errorf("can't read the switch history: %w", possible_error)
+	}
+	defer history.Close()
+
+	var switches []Switch
+
+	scanner := bufio.NewScanner(history)
+	for scanner.Scan() {
+		var change Switch
+		possible_error = json.Unmarshal(scanner.Bytes(), &change)
+		if possible_error != nil {
+			return nil, fmt.Errorf("can't decode the switch history: %w", possible_error)
+		}
+		switches = append(switches, change)
+	}
+
+	return switches, scanner.Err()
+}
+
+// This function returns the version that was active before the active one, the target of a
+// rollback. The history is replayed as a stack: an activation pushes its version and a rollback
+// pops the version it left, so rolling back again keeps going back instead of returning to the
+// version just rolled back. An empty id means nothing was active before.
+func (store *Store) Previous() (string, error) {
+	switches, possible_error := store.History()
+	if possible_error != nil {
+		return "", possible_error
+	}
+
+	var stack []string
+
+	for _, change := range switches {
+		if change.Rollback && len(stack) > 0 {
+			stack = stack[:len(stack)-1]
+		}
+
+		if len(stack) == 0 || stack[len(stack)-1] != change.To {
+			stack = append(stack, change.To)
+		}
+	}
+
+	if len(stack) < 2 {
+		return "", nil
+	}
+
+	return stack[len(stack)-2], nil
+}
+
+// This function replaces the file with the value encoded as indented json
+func write_json(file_name string, value any) error {
+	content, possible_error := json.MarshalIndent(value, "", "\t")
+	if possible_error != nil {
+		return fmt.Errorf("can't encode %s: %w", file_name, possible_error)
+	}
+
+	return write_file(file_name, append(content, '\n'))
+}
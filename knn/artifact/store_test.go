@@ -0,0 +1,139 @@
+package artifact
+
+import (
+	"errors"
+	"knn/data"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoreAdd(t *testing.T) {
+	trained := train_heart(t, 0)
+
+	store, possible_error := OpenStore(filepath.Join(t.TempDir(), "datasets"))
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	// The same rows added right away get another id instead of overwriting the first version
+	first, possible_error := store.Add(trained, "alice", nil)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+	second, possible_error := store.Add(trained, "bob", []string{"case-1"})
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+	if first.ID == second.ID {
+		t.Fatalf("both versions are %s", first.ID)
+	}
+
+	versions, possible_error := store.Versions()
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+	if len(versions) != 2 || versions[0].ID != first.ID || versions[1].ID != second.ID || versions[1].UploadedBy != "bob" || versions[1].Cases[0] != "case-1" {
+		t.Fatalf("versions %+v, expected %s then %s", versions, first.ID, second.ID)
+	}
+
+	loaded, possible_error := store.Load(second.ID)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+	if loaded.Checksum != trained.Checksum {
+		t.Fatalf("loaded artifact %s, added %s", loaded.Checksum, trained.Checksum)
+	}
+
+	// The rows are kept as csv next to the artifact
+	rows, possible_error := data.LoadDataset(filepath.Join(store.directory, first.ID, dataset_file), trained.Schema)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+	if HashDataset(rows) != first.Dataset.SHA256 {
+		t.Fatal("the csv of the version doesn't hold its rows")
+	}
+
+	if active, _ := store.Active(); active != "" {
+		t.Fatalf("adding a version activated %s", active)
+	}
+
+	for _, id := range []string{"missing", "../" + first.ID, first.ID + "/" + artifact_file} {
+		if _, possible_error := store.Load(id); !errors.Is(possible_error, ErrUnknownVersion) {
+			t.Errorf("loading %q: %v, expected an unknown version", id, possible_error)
+		}
+	}
+}
+
+// Rolling back goes back one activation at a time, never to the version just rolled back
+func TestStoreRollback(t *testing.T) {
+	trained := train_heart(t, 0)
+
+	store, possible_error := OpenStore(t.TempDir())
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	ids := make([]string, 3)
+	for index := range ids {
+		version, possible_error := store.Add(trained, "alice", nil)
+		if possible_error != nil {
+			t.Fatal(possible_error)
+		}
+		ids[index] = version.ID
+	}
+	a, b, c := ids[0], ids[1], ids[2]
+
+	steps := []struct {
+		id       string
+		rollback bool
+		previous string
+	}{
+		{a, false, ""},
+		{b, false, a},
+		{c, false, b},
+		{b, true, a},
+		{a, true, ""},
+		{c, false, a},
+		{c, false, a},
+	}
+
+	for number, step := range steps {
+		before, _ := store.Active()
+
+		change, possible_error := store.Activate(step.id, "alice", step.rollback)
+		if possible_error != nil {
+			t.Fatal(possible_error)
+		}
+		if change.From != before || change.To != step.id || change.Rollback != step.rollback {
+			t.Fatalf("step %d recorded %+v", number+1, change)
+		}
+
+		active, possible_error := store.Active()
+		if possible_error != nil || active != step.id {
+			t.Fatalf("step %d: %s is active (%v), expected %s", number+1, active, possible_error, step.id)
+		}
+
+		previous, possible_error := store.Previous()
+		if possible_error != nil || previous != step.previous {
+			t.Fatalf("step %d: previous is %q (%v), expected %q", number+1, previous, possible_error, step.previous)
+		}
+	}
+
+	history, possible_error := store.History()
+	if possible_error != nil || len(history) != len(steps) {
+		t.Fatalf("%d switches recorded (%v), expected %d", len(history), possible_error, len(steps))
+	}
+
+	if _, possible_error := store.Activate("missing", "alice", false); !errors.Is(possible_error, ErrUnknownVersion) {
+		t.Fatalf("activating a missing version: %v", possible_error)
+	}
+
+	// A store opened again finds the same active version
+	again, possible_error := OpenStore(store.directory)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+	if active, _ := again.Active(); active != c {
+		t.Fatalf("reopened store has %s active, expected %s", active, c)
+	}
+}
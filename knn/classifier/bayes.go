@@ -0,0 +1,161 @@
+package classifier
+
+import (
+	"fmt"
+	"math"
+)
+
+// NaiveBayes assumes the features are independent given the class. A numeric feature follows a
+// normal distribution per class and a categorical one a frequency table per class smoothed with
+// Alpha so a value never seen with a class doesn't rule it out.
+type NaiveBayes struct {
+	Alpha        float64 `json:"alpha"`
+	VarSmoothing float64 `json:"var_smoothing"`
+	categorical  []bool
+	classes      []int
+	priors       []float64
+	means        [][]float64
+	variances    [][]float64
+	counts       []map[int]map[float64]float64
+	totals       []float64
+	categories   []int
+}
+
+// This function creates a naive bayes classifier, categorical marks the categorical features
+func NewNaiveBayes(categorical []bool) *NaiveBayes {
+	return &NaiveBayes{Alpha: 1, VarSmoothing: 1e-9, categorical: categorical}
+}
+
+func (model *NaiveBayes) Fit(X [][]float64, y []int) error {
+	features := len(X[0])
+	model.classes = classes_of(y)
+	model.priors = make([]float64, len(model.classes))
+	model.means = make([][]float64, len(model.classes))
+	model.variances = make([][]float64, len(model.classes))
+	model.counts = make([]map[int]map[float64]float64, len(model.classes))
+	model.totals = make([]float64, len(model.classes))
+	model.categories = make([]int, features)
+
+	// The variances get a small share of the largest one so a constant feature doesn't divide by zero
+	largest_variance := 0.0
+
+	for position, class := range model.classes {
+		var rows [][]float64
+		for row, label := range y {
+			if label == class {
+				rows = append(rows, X[row])
+			}
+		}
+
+		model.priors[position] = float64(len(rows)) / float64(len(y))
+		model.means[position] = make([]float64, features)
+		model.variances[position] = make([]float64, features)
+		model.counts[position] = map[int]map[float64]float64{}
+		model.totals[position] = float64(len(rows))
+
+		for feature := 0; feature < features; feature++ {
+			if model.categorical[feature] {
+				model.counts[position][feature] = map[float64]float64{}
+				for _, row := range rows {
+					model.counts[position][feature][row[feature]]++
+				}
+				continue
+			}
+
+			for _, row := range rows {
+				model.means[position][feature] += row[feature] / float64(len(rows))
+			}
+			for _, row := range rows {
+				difference := row[feature] - model.means[position][feature]
+				model.variances[position][feature] += difference * difference / float64(len(rows))
+			}
+			largest_variance = max(largest_variance, model.variances[position][feature])
+		}
+	}
+
+	for feature := 0; feature < features; feature++ {
+		if model.categorical[feature] {
+			seen := map[float64]bool{}
+			for _, row := range X {
+				seen[row[feature]] = true
+			}
+			model.categories[feature] = len(seen)
+		}
+	}
+
+	epsilon := max(model.VarSmoothing*largest_variance, model.VarSmoothing)
+	for position := range model.classes {
+		for feature := range model.variances[position] {
+			model.variances[position][feature] += epsilon
+		}
+	}
+
+	return nil
+}
+
+func (model *NaiveBayes) Predict(X_to_predict []float64) (int, error) {
+	probabilities, possible_error := model.PredictProba(X_to_predict)
+	if possible_error != nil {
+		return 0, possible_error
+	}
+
+	return most_probable(probabilities), nil
+}
+
+func (model *NaiveBayes) PredictProba(X_to_predict []float64) (map[int]float64, error) {
+	if model.classes == nil {
+		return nil, fmt.Errorf("naive bayes is not fitted")
+	}
+
+	// Work with log probabilities so the product of many small likelihoods doesn't underflow
+	logs := make([]float64, len(model.classes))
+	highest := math.Inf(-1)
+
+	for position := range model.classes {
+		logs[position] = math.Log(model.priors[position])
+
+		for feature, value := range X_to_predict {
+			if model.categorical[feature] {
+				count := model.counts[position][feature][value]
+				logs[position] += math.Log((count + model.Alpha) / (model.totals[position] + model.Alpha*float64(model.categories[feature])))
+				continue
+			}
+
+			mean, variance := model.means[position][feature], model.variances[position][feature]
+			logs[position] += -0.5*math.Log(2*math.Pi*variance) - (value-mean)*(value-mean)/(2*variance)
+		}
+
+		highest = max(highest, logs[position])
+	}
+
+	probabilities := map[int]float64{}
+	total := 0.0
+	for position, class := range model.classes {
+		probabilities[class] = math.Exp(logs[position] - highest)
+		total += probabilities[class]
+	}
+	for class := range probabilities {
+		probabilities[class] /= total
+	}
+
+	return probabilities, nil
+}
+
+func (model *NaiveBayes) Describe() Description {
+	priors := map[int]float64{}
+	means := map[int][]float64{}
+	for position, class := range model.classes {
+		priors[class] = model.priors[position]
+		means[class] = model.means[position]
+	}
+
+	return Description{
+		Name: ModelNaiveBayes,
+		Parameters: map[string]any{
+			"alpha":         model.Alpha,
+			"var_smoothing": model.VarSmoothing,
+			"priors":        priors,
+			"means":         means,
+		},
+	}
+}
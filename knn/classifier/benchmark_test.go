@@ -0,0 +1,235 @@
+package classifier
+
+import (
+	"fmt"
+	"knn/data"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// The rows of heart.csv are resampled with some noise to reach every benchmarked training set size
+var benchmark_sizes = []int{303, 10000, 100000}
+
+// benchmarkSet is a scaled training set and the queries predicted against it
+type benchmarkSet struct {
+	X           [][]float64
+	y           []int
+	queries     [][]float64
+	categorical []bool
+}
+
+// This function loads heart.csv scaled with min-max and resamples it to size rows, the queries are
+// 200 more resampled rows
+func loadBenchmarkSet(b *testing.B, size int) benchmarkSet {
+	b.Helper()
+
+	dataset := load_heart(b)
+
+	scaler, possible_error := data.FitScaler(data.ScalerMinMax, dataset.Features)
+	if possible_error != nil {
+		b.Fatal(possible_error)
+	}
+	X_scaled := scaler.TransformAll(dataset.Features)
+
+	random := rand.New(rand.NewPCG(1, 2))
+	queries, _ := resample(X_scaled, dataset.Labels, 200, random)
+
+	X, y := X_scaled, dataset.Labels
+	if size != len(X_scaled) {
+		X, y = resample(X_scaled, dataset.Labels, size, random)
+	}
+
+	return benchmarkSet{X: X, y: y, queries: queries, categorical: dataset.Schema.Categorical()}
+}
+
+// This function returns n rows drawn from X with their labels and a little gaussian noise
+func resample(X [][]float64, y []int, n int, random *rand.Rand) ([][]float64, []int) {
+	rows := make([][]float64, n)
+	labels := make([]int, n)
+
+	for index := range rows {
+		source := random.IntN(len(X))
+		rows[index] = slices.Clone(X[source])
+		labels[index] = y[source]
+
+		for feature := range rows[index] {
+			rows[index][feature] += random.NormFloat64() * 0.02
+		}
+	}
+
+	return rows, labels
+}
+
+// This function measures a prediction with every neighbor index on training sets of growing size,
+// the recall metric is the share of the exact neighbors an index finds: the exact indexes must
+// reach 1 while the lsh index trades some of it for speed, more bits and fewer tables measure
+// fewer candidates
+func BenchmarkPredictIndex(b *testing.B) {
+	settings := Settings{K: 5, Metric: MetricEuclidean, P: 2, TieBreak: TieNearest, Weighting: WeightUniform}
+
+	indexes := []IndexOptions{
+		{Kind: IndexBrute},
+		{Kind: IndexKDTree},
+		{Kind: IndexBallTree},
+		{Kind: IndexLSH, Tables: 8, Bits: 10, Probes: 2},
+		{Kind: IndexLSH, Tables: 4, Bits: 16, Probes: 2},
+		{Kind: IndexLSH, Tables: 2, Bits: 24, Probes: 2},
+	}
+
+	for _, size := range benchmark_sizes {
+		set := loadBenchmarkSet(b, size)
+		brute := NewKNN(set.X, set.y, set.categorical)
+
+		for _, options := range indexes {
+			name := options.Kind
+			if options.Kind == IndexLSH {
+				name = fmt.Sprintf("%s-tables=%d-bits=%d-probes=%d", options.Kind, options.Tables, options.Bits, options.Probes)
+			}
+
+			b.Run(fmt.Sprintf("rows=%d/index=%s", size, name), func(b *testing.B) {
+				knn, possible_error := brute.Indexed(options, settings)
+				if possible_error != nil {
+					b.Skip(possible_error)
+				}
+
+				report, possible_error := knn.Recall(set.queries, settings)
+				if possible_error != nil {
+					b.Fatal(possible_error)
+				}
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					knn.Predict(set.queries[i%len(set.queries)], settings)
+				}
+
+				b.ReportMetric(report.Recall, "recall")
+			})
+		}
+	}
+}
+
+// This function compares the brute force prediction with the predict of the service before the
+// kernel, copied below as it was: it measured every row with math.Pow on float32 values and picked
+// the k nearest by removing the closest row k times
+func BenchmarkPredictScan(b *testing.B) {
+	settings := Settings{K: 3, Metric: MetricEuclidean, TieBreak: TieNearest, Weighting: WeightUniform}
+
+	for _, size := range benchmark_sizes {
+		set := loadBenchmarkSet(b, size)
+		brute := NewKNN(set.X, set.y, set.categorical)
+
+		X_float32 := make([][]float32, len(set.X))
+		for index, row := range set.X {
+			X_float32[index] = make([]float32, len(row))
+			for feature, value := range row {
+				X_float32[index][feature] = float32(value)
+			}
+		}
+
+		queries_float32 := make([][]float32, len(set.queries))
+		for index, query := range set.queries {
+			queries_float32[index] = make([]float32, len(query))
+			for feature, value := range query {
+				queries_float32[index][feature] = float32(value)
+			}
+		}
+
+		b.Run(fmt.Sprintf("rows=%d/baseline", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				baseline_predict(queries_float32[i%len(queries_float32)], X_float32, set.y, settings.K)
+			}
+		})
+
+		b.Run(fmt.Sprintf("rows=%d/predict", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				brute.Predict(set.queries[i%len(set.queries)], settings)
+			}
+		})
+	}
+}
+
+// This function measures a prediction with a missing feature, the distances are measured over the
+// other features so the allocations must not grow with the rows
+func BenchmarkPredictPartial(b *testing.B) {
+	settings := Settings{K: 5, Metric: MetricEuclidean, P: 2, TieBreak: TieNearest, Weighting: WeightUniform}
+
+	for _, size := range benchmark_sizes {
+		set := loadBenchmarkSet(b, size)
+		knn := NewKNN(set.X, set.y, set.categorical)
+
+		present := make([]bool, len(set.categorical))
+		for feature := range present {
+			present[feature] = feature != 0
+		}
+
+		b.Run(fmt.Sprintf("rows=%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				knn.PredictPartial(set.queries[i%len(set.queries)], present, settings)
+			}
+		})
+	}
+}
+
+// This function is the calc_distance of the service before the kernel
+func baseline_calc_distance(X_to_predict []float32, X [][]float32) []float32 {
+
+	distances := make([]float32, len(X))
+
+	// Loop through all the vectors and calculate the distance with euclidean distance formula
+	for i := 0; i < len(X); i++ {
+		euclidean_distance := 0.0
+
+		x := X[i]
+		y := X_to_predict
+
+		for r := 0; r < len(x); r++ {
+			difference := x[r] - y[r]
+			euclidean_distance += math.Pow(float64(difference), 2)
+		}
+
+		euclidean_distance = math.Sqrt(float64(euclidean_distance))
+		distances[i] = float32(euclidean_distance)
+	}
+
+	return distances
+}
+
+// This function is the predict of the service before the kernel
+func baseline_predict(X_to_predict []float32, X [][]float32, y []int, k int) []int {
+	// Calculate distance between X_to_predict vector and all X vectors
+	distances_array := baseline_calc_distance(X_to_predict, X)
+
+	y_predicted := make([]int, len(y))
+
+	group_A := 0
+	group_B := 0
+
+	// Run K times and find the K neighbors of X_to_predict vector
+	for i := 0; i < k; i++ {
+		closest_index := slices.Index(distances_array, slices.Min(distances_array))
+
+		if y[closest_index] == 1 {
+			group_A += 1
+		} else {
+			group_B += 1
+		}
+
+		distances_array = append(distances_array[:closest_index], distances_array[closest_index+1:]...)
+	}
+
+	// If more neighbors are from group_A X_to_predict is also belong to group_A
+	// otherwise X_to_predict belong to group_B
+	if group_A > group_B {
+		y_predicted = append(y_predicted, 1)
+	} else {
+		y_predicted = append(y_predicted, 0)
+	}
+
+	return y_predicted
+}
@@ -0,0 +1,231 @@
+package classifier
+
+import (
+	"fmt"
+	"math"
+)
+
+// The supported distance metrics
+const (
+	MetricEuclidean = "euclidean"
+	MetricManhattan = "manhattan"
+	MetricMinkowski = "minkowski"
+	MetricChebyshev = "chebyshev"
+	MetricCosine    = "cosine"
+	MetricHamming   = "hamming"
+	MetricGower     = "gower"
+)
+
+// Metric computes the distance between two scaled feature vectors
+type Metric func(a, b []float64) float64
+
+// This function builds the metric with the given name, categorical marks which features
+// are categorical codes and ranges holds the spread of each feature in the training set
+// (both are only used by the mixed gower metric)
+func NewMetric(name string, p float64, categorical []bool, ranges []float64) (Metric, error) {
+	switch name {
+	case MetricEuclidean:
+		return euclidean, nil
+	case MetricManhattan:
+		return manhattan, nil
+	case MetricMinkowski:
+		if p < 1 {
+			return nil, fmt.Errorf("minkowski metric needs p of at least 1, got %v", p)
+		}
+		return func(a, b []float64) float64 { return minkowski(a, b, p) }, nil
+	case MetricChebyshev:
+		return chebyshev, nil
+	case MetricCosine:
+		return cosine, nil
+	case MetricHamming:
+		return hamming, nil
+	case MetricGower:
+		return func(a, b []float64) float64 { return gower(a, b, categorical, ranges) }, nil
+	default:
+		return nil, fmt.Errorf("unknown distance metric %q", name)
+	}
+}
+
+// This function builds the metric over the present features only, both vectors are reduced to
+// those features before the distance is measured. Every metric it returns reduces them into the
+// same two buffers, a goroutine scanning rows asks for its own metric once per query.
+func newPartialMetric(name string, p float64, categorical []bool, ranges []float64, present []bool) (func() Metric, error) {
+	var kept []int
+	var kept_categorical []bool
+	var kept_ranges []float64
+
+	for feature, is_present := range present {
+		if is_present {
+			kept = append(kept, feature)
+			kept_categorical = append(kept_categorical, categorical[feature])
+			kept_ranges = append(kept_ranges, ranges[feature])
+		}
+	}
+
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("at least one feature must be present to measure a distance")
+	}
+
+	metric, possible_error := NewMetric(name, p, kept_categorical, kept_ranges)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	return func() Metric {
+		reduced_a, reduced_b := make([]float64, len(kept)), make([]float64, len(kept))
+
+		return func(a, b []float64) float64 {
+			for position, feature := range kept {
+				reduced_a[position], reduced_b[position] = a[feature], b[feature]
+			}
+
+			return metric(reduced_a, reduced_b)
+		}
+	}, nil
+}
+
+// This function calculate distance with euclidean distance formula
+func euclidean(a, b []float64) float64 {
+	sum := 0.0
+
+	for r := range a {
+		difference := a[r] - b[r]
+		sum += difference * difference
+	}
+
+	return math.Sqrt(sum)
+}
+
+// This function sums the absolute differences of every feature
+func manhattan(a, b []float64) float64 {
+	sum := 0.0
+
+	for r := range a {
+		sum += math.Abs(a[r] - b[r])
+	}
+
+	return sum
+}
+
+// This function generalizes manhattan (p=1) and euclidean (p=2) distances
+func minkowski(a, b []float64, p float64) float64 {
+	return math.Pow(minkowski_sum(a, b, p), 1/p)
+}
+
+// This function returns the largest difference of a single feature
+func chebyshev(a, b []float64) float64 {
+	largest := 0.0
+
+	for r := range a {
+		largest = max(largest, math.Abs(a[r]-b[r]))
+	}
+
+	return largest
+}
+
+// This function returns one minus the cosine of the angle between the vectors
+func cosine(a, b []float64) float64 {
+	norm_a, norm_b := dot(a, a), dot(b, b)
+
+	// A zero vector has no direction, treat it as unrelated to anything
+	if norm_a == 0 || norm_b == 0 {
+		return 1
+	}
+
+	return 1 - dot(a, b)/(math.Sqrt(norm_a)*math.Sqrt(norm_b))
+}
+
+// This function returns the share of features that are not equal
+func hamming(a, b []float64) float64 {
+	different := 0
+
+	for r := range a {
+		if a[r] != b[r] {
+			different++
+		}
+	}
+
+	return float64(different) / float64(len(a))
+}
+
+// This function mixes hamming distance on the categorical features with manhattan distance
+// normalized by the feature range on the numeric ones and averages them
+func gower(a, b []float64, categorical []bool, ranges []float64) float64 {
+	sum := 0.0
+
+	for r := range a {
+		switch {
+		case categorical[r]:
+			if a[r] != b[r] {
+				sum += 1
+			}
+		case ranges[r] > 0:
+			sum += min(math.Abs(a[r]-b[r])/ranges[r], 1)
+		}
+	}
+
+	return sum / float64(len(a))
+}
+
+// This function splits the distance between a and b into one term per feature, the terms add up
+// to the distance (or to its p power for euclidean and minkowski) so they show which features
+// pulled the vectors apart, a cosine term is negative when the feature brings the vectors closer
+func feature_terms(name string, p float64, a, b []float64, categorical []bool, ranges []float64) []float64 {
+	terms := make([]float64, len(a))
+
+	switch name {
+	case MetricEuclidean:
+		for r := range a {
+			terms[r] = (a[r] - b[r]) * (a[r] - b[r])
+		}
+	case MetricMinkowski:
+		for r := range a {
+			terms[r] = power(math.Abs(a[r]-b[r]), p)
+		}
+	case MetricChebyshev:
+		// Only the largest difference counts
+		largest := 0
+		for r := range a {
+			if math.Abs(a[r]-b[r]) > math.Abs(a[largest]-b[largest]) {
+				largest = r
+			}
+		}
+		terms[largest] = math.Abs(a[largest] - b[largest])
+	case MetricCosine:
+		norm_a, norm_b := math.Sqrt(dot(a, a)), math.Sqrt(dot(b, b))
+		for r := range a {
+			if norm_a == 0 || norm_b == 0 {
+				terms[r] = 1 / float64(len(a))
+				continue
+			}
+			terms[r] = 1/float64(len(a)) - a[r]*b[r]/(norm_a*norm_b)
+		}
+	case MetricHamming:
+		for r := range a {
+			if a[r] != b[r] {
+				terms[r] = 1 / float64(len(a))
+			}
+		}
+	case MetricGower:
+		for r := range a {
+			terms[r] = gower(a[r:r+1], b[r:r+1], categorical[r:r+1], ranges[r:r+1]) / float64(len(a))
+		}
+	default:
+		for r := range a {
+			terms[r] = math.Abs(a[r] - b[r])
+		}
+	}
+
+	return terms
+}
+
+// This function returns the dot product of two vectors
+func dot(a, b []float64) float64 {
+	sum := 0.0
+
+	for r := range a {
+		sum += a[r] * b[r]
+	}
+
+	return sum
+}
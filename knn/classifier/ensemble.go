@@ -0,0 +1,282 @@
+package classifier
+
+import (
+	"fmt"
+)
+
+// The supported ways to combine the members of an ensemble
+const (
+	ModelMajorityVote = "majority_vote"
+	ModelSoftVote     = "soft_vote"
+	ModelStacking     = "stacking"
+)
+
+// The stacking model learns from predictions made on rows the members didn't see, they come from
+// a cross validation with these folds and seed
+const (
+	stacking_folds = 5
+	stacking_seed  = 42
+)
+
+// Verdict is what one member of an ensemble predicted
+type Verdict struct {
+	Model       string  `json:"model"`
+	Class       int     `json:"class"`
+	Probability float64 `json:"probability"`
+}
+
+// Ensemble combines knn, logistic regression, naive bayes and the decision tree. A majority vote
+// counts the classes they predict, a soft vote averages their probabilities and stacking feeds
+// their probabilities of the positive class to a logistic regression that learns whom to trust.
+type Ensemble struct {
+	Method      string
+	categorical []bool
+	settings    Settings
+	names       []string
+	members     []Model
+	meta        *LogisticRegression
+}
+
+// This function creates an unfitted ensemble combining its members with the method,
+// settings are the ones of the knn member
+func NewEnsemble(method string, categorical []bool, settings Settings) *Ensemble {
+	return &Ensemble{
+		Method:      method,
+		categorical: categorical,
+		settings:    settings,
+		names:       []string{ModelKNN, ModelLogistic, ModelNaiveBayes, ModelTree},
+	}
+}
+
+// This function returns a copy of a fitted ensemble that combines the same members with another
+// method, stacking needs an ensemble fitted to stack
+func (ensemble *Ensemble) As(method string) *Ensemble {
+	combined := *ensemble
+	combined.Method = method
+
+	return &combined
+}
+
+// This function returns a copy of a fitted ensemble whose knn member uses the settings, the
+// other members and the stacking model stay the ones fitted with the settings of the ensemble
+func (ensemble *Ensemble) WithSettings(settings Settings) *Ensemble {
+	combined := *ensemble
+	combined.settings = settings
+	combined.members = make([]Model, len(ensemble.members))
+
+	for position, member := range ensemble.members {
+		if knn_model, is_knn := member.(*knnModel); is_knn {
+			member = &knnModel{categorical: knn_model.categorical, settings: settings, knn: knn_model.knn}
+		}
+		combined.members[position] = member
+	}
+
+	return &combined
+}
+
+// This function returns the fitted members by name
+func (ensemble *Ensemble) Members() map[string]Model {
+	members := map[string]Model{}
+
+	for position, name := range ensemble.names {
+		members[name] = ensemble.members[position]
+	}
+
+	return members
+}
+
+// This function creates the members with their default parameters
+func (ensemble *Ensemble) new_members() ([]Model, error) {
+	members := make([]Model, len(ensemble.names))
+
+	for position, name := range ensemble.names {
+		member, possible_error := NewModel(name, ensemble.categorical, ensemble.settings)
+		if possible_error != nil {
+			return nil, possible_error
+		}
+		members[position] = member
+	}
+
+	return members, nil
+}
+
+// This function fits every member on the rows, stacking fits its model too
+func (ensemble *Ensemble) Fit(X [][]float64, y []int) error {
+	switch ensemble.Method {
+	case ModelMajorityVote, ModelSoftVote, ModelStacking:
+	default:
+		return fmt.Errorf("unknown ensemble method %q", ensemble.Method)
+	}
+
+	members, possible_error := ensemble.new_members()
+	if possible_error != nil {
+		return possible_error
+	}
+
+	for position, member := range members {
+		possible_error = member.Fit(X, y)
+		if possible_error != nil {
+			return fmt.Errorf("%s: %w", ensemble.names[position], possible_error)
+		}
+	}
+
+	ensemble.members = members
+	ensemble.meta = nil
+
+	if ensemble.Method == ModelStacking {
+		ensemble.meta, possible_error = ensemble.fit_meta(X, y)
+	}
+
+	return possible_error
+}
+
+// This function fits the stacking model on the probabilities the members give to rows left out of
+// their training so it learns how they do on new patients
+func (ensemble *Ensemble) fit_meta(X [][]float64, y []int) (*LogisticRegression, error) {
+	stacked := make([][]float64, len(X))
+	assignment := stratified_folds(y, stacking_folds, stacking_seed)
+
+	for fold := 0; fold < stacking_folds; fold++ {
+		var X_train, X_test [][]float64
+		var y_train, test []int
+		for row, assigned := range assignment {
+			if assigned == fold {
+				X_test = append(X_test, X[row])
+				test = append(test, row)
+			} else {
+				X_train = append(X_train, X[row])
+				y_train = append(y_train, y[row])
+			}
+		}
+
+		members, possible_error := ensemble.new_members()
+		if possible_error != nil {
+			return nil, possible_error
+		}
+
+		for _, member := range members {
+			possible_error = member.Fit(X_train, y_train)
+			if possible_error != nil {
+				return nil, possible_error
+			}
+		}
+
+		for position, row := range test {
+			stacked[row], possible_error = positive_probabilities(members, X_test[position])
+			if possible_error != nil {
+				return nil, possible_error
+			}
+		}
+	}
+
+	meta := NewLogisticRegression()
+	possible_error := meta.Fit(stacked, y)
+	if possible_error != nil {
+		return nil, fmt.Errorf("stacking: %w", possible_error)
+	}
+
+	return meta, nil
+}
+
+// This function returns the probability of the positive class given by every member
+func positive_probabilities(members []Model, X_to_predict []float64) ([]float64, error) {
+	probabilities := make([]float64, len(members))
+
+	for position, member := range members {
+		_, member_probabilities, possible_error := classify(member, X_to_predict)
+		if possible_error != nil {
+			return nil, possible_error
+		}
+		probabilities[position] = member_probabilities[PositiveClass]
+	}
+
+	return probabilities, nil
+}
+
+// This function returns the verdict of every member on X_to_predict
+func (ensemble *Ensemble) Verdicts(X_to_predict []float64) ([]Verdict, error) {
+	if ensemble.members == nil {
+		return nil, fmt.Errorf("ensemble is not fitted")
+	}
+
+	verdicts := make([]Verdict, len(ensemble.members))
+
+	for position, member := range ensemble.members {
+		class, probabilities, possible_error := classify(member, X_to_predict)
+		if possible_error != nil {
+			return nil, possible_error
+		}
+		verdicts[position] = Verdict{Model: ensemble.names[position], Class: class, Probability: probabilities[PositiveClass]}
+	}
+
+	return verdicts, nil
+}
+
+func (ensemble *Ensemble) Predict(X_to_predict []float64) (int, error) {
+	probabilities, possible_error := ensemble.PredictProba(X_to_predict)
+	if possible_error != nil {
+		return 0, possible_error
+	}
+
+	return most_probable(probabilities), nil
+}
+
+// This function combines the members, the probabilities of a majority vote are the share of votes
+func (ensemble *Ensemble) PredictProba(X_to_predict []float64) (map[int]float64, error) {
+	if ensemble.members == nil {
+		return nil, fmt.Errorf("ensemble is not fitted")
+	}
+
+	probabilities := map[int]float64{}
+	share := 1 / float64(len(ensemble.members))
+
+	switch ensemble.Method {
+	case ModelMajorityVote:
+		for _, member := range ensemble.members {
+			class, _, possible_error := classify(member, X_to_predict)
+			if possible_error != nil {
+				return nil, possible_error
+			}
+			probabilities[class] += share
+		}
+	case ModelSoftVote:
+		for _, member := range ensemble.members {
+			_, member_probabilities, possible_error := classify(member, X_to_predict)
+			if possible_error != nil {
+				return nil, possible_error
+			}
+			for class, probability := range member_probabilities {
+				probabilities[class] += probability * share
+			}
+		}
+	default:
+		if ensemble.meta == nil {
+			return nil, fmt.Errorf("ensemble was not fitted for stacking")
+		}
+
+		stacked, possible_error := positive_probabilities(ensemble.members, X_to_predict)
+		if possible_error != nil {
+			return nil, possible_error
+		}
+		return ensemble.meta.PredictProba(stacked)
+	}
+
+	return probabilities, nil
+}
+
+func (ensemble *Ensemble) Describe() Description {
+	members := make([]Description, len(ensemble.members))
+	for position, member := range ensemble.members {
+		members[position] = member.Describe()
+	}
+
+	parameters := map[string]any{"members": members}
+
+	// The stacking weights follow the order of the members
+	if ensemble.Method == ModelStacking && ensemble.meta != nil {
+		parameters["member_weights"] = ensemble.meta.Weights
+		parameters["bias"] = ensemble.meta.Bias
+	}
+
+	return Description{Name: ensemble.Method, Parameters: parameters}
+}
@@ -0,0 +1,122 @@
+package classifier
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// The votes combine the verdicts of the members: a majority vote gives every member an equal share
+// of its class and a soft vote averages their probabilities
+func TestEnsembleVotes(t *testing.T) {
+	X, y, categorical := scaled_heart(t)
+	settings := Settings{K: 5, Metric: MetricEuclidean, TieBreak: TieNearest, Weighting: WeightUniform}
+
+	ensemble := NewEnsemble(ModelMajorityVote, categorical, settings)
+	possible_error := ensemble.Fit(X, y)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	for _, row := range X[:50] {
+		verdicts, possible_error := ensemble.Verdicts(row)
+		if possible_error != nil {
+			t.Fatal(possible_error)
+		}
+
+		majority, soft := 0.0, 0.0
+		for _, verdict := range verdicts {
+			if verdict.Class == PositiveClass {
+				majority += 1.0 / float64(len(verdicts))
+			}
+			soft += verdict.Probability / float64(len(verdicts))
+		}
+
+		for method, expected := range map[string]float64{ModelMajorityVote: majority, ModelSoftVote: soft} {
+			probabilities, possible_error := ensemble.As(method).PredictProba(row)
+			if possible_error != nil {
+				t.Fatal(possible_error)
+			}
+			if math.Abs(probabilities[PositiveClass]-expected) > 1e-9 {
+				t.Fatalf("%s gives %v, expected %v from %+v", method, probabilities[PositiveClass], expected, verdicts)
+			}
+		}
+	}
+
+	// Only an ensemble fitted for stacking has a stacking model
+	_, possible_error = ensemble.As(ModelStacking).PredictProba(X[0])
+	if possible_error == nil {
+		t.Fatal("expected an error from a vote used to stack")
+	}
+}
+
+// The stacking model is fitted once with the settings of the ensemble, another k only changes the
+// knn member and a k the training set can't give fails without breaking the ensemble
+func TestEnsembleStackingSettings(t *testing.T) {
+	X, y, categorical := scaled_heart(t)
+	defaults := Settings{K: 5, Metric: MetricEuclidean, TieBreak: TieNearest, Weighting: WeightUniform}
+
+	ensemble := NewEnsemble(ModelStacking, categorical, defaults)
+	possible_error := ensemble.Fit(X, y)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	weights := ensemble.Describe().Parameters["member_weights"].([]float64)
+	if len(weights) != 4 {
+		t.Fatalf("%d member weights, expected one per member", len(weights))
+	}
+
+	for _, k := range []int{3, 51} {
+		settings := defaults
+		settings.K = k
+		changed := ensemble.WithSettings(settings)
+
+		if !slices.Equal(changed.Describe().Parameters["member_weights"].([]float64), weights) {
+			t.Fatalf("k=%d changed the stacking weights", k)
+		}
+
+		probabilities, possible_error := changed.PredictProba(X[0])
+		if possible_error != nil {
+			t.Fatal(possible_error)
+		}
+		if total := probabilities[0] + probabilities[1]; math.Abs(total-1) > 1e-9 {
+			t.Fatalf("k=%d probabilities %v add up to %v", k, probabilities, total)
+		}
+	}
+
+	// 300 neighbors are more than the folds the stacking model learned from hold, but the request
+	// only uses them on the whole training set
+	settings := defaults
+	settings.K = 300
+	_, possible_error = ensemble.WithSettings(settings).PredictProba(X[0])
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	settings.K = len(X) + 1
+	_, possible_error = ensemble.WithSettings(settings).PredictProba(X[0])
+	if possible_error == nil {
+		t.Fatalf("expected an error for k=%d", settings.K)
+	}
+
+	_, possible_error = ensemble.PredictProba(X[0])
+	if possible_error != nil {
+		t.Fatalf("the failed request broke the ensemble: %v", possible_error)
+	}
+}
+
+func TestEnsembleRefuses(t *testing.T) {
+	unfitted := NewEnsemble(ModelSoftVote, []bool{false}, Settings{K: 1})
+	if _, possible_error := unfitted.PredictProba([]float64{0}); possible_error == nil {
+		t.Error("expected an error from an unfitted ensemble")
+	}
+	if _, possible_error := unfitted.Verdicts([]float64{0}); possible_error == nil {
+		t.Error("expected an error for the verdicts of an unfitted ensemble")
+	}
+
+	unknown := NewEnsemble("weighted_vote", []bool{false}, Settings{K: 1, Metric: MetricEuclidean, TieBreak: TieNearest, Weighting: WeightUniform})
+	if possible_error := unknown.Fit([][]float64{{0}, {1}}, []int{0, 1}); possible_error == nil {
+		t.Error("expected an error for an unknown method")
+	}
+}
@@ -0,0 +1,345 @@
+package classifier
+
+import (
+	"cmp"
+	"fmt"
+	"knn/data"
+	"math/rand/v2"
+	"slices"
+)
+
+// The supported evaluation methods
+const (
+	EvaluationCrossValidation = "cross_validation"
+	EvaluationHoldout         = "holdout"
+)
+
+// Confusion counts the predictions of the positive class against the truth
+type Confusion struct {
+	TruePositive  int `json:"true_positive"`
+	FalsePositive int `json:"false_positive"`
+	TrueNegative  int `json:"true_negative"`
+	FalseNegative int `json:"false_negative"`
+}
+
+// Metrics are the scores of a set of predictions, the positive class is PositiveClass
+type Metrics struct {
+	Samples     int       `json:"samples"`
+	Accuracy    float64   `json:"accuracy"`
+	Precision   float64   `json:"precision"`
+	Recall      float64   `json:"recall"`
+	F1          float64   `json:"f1"`
+	Specificity float64   `json:"specificity"`
+	AUC         float64   `json:"auc"`
+	Confusion   Confusion `json:"confusion"`
+}
+
+// Evaluation describes how a configuration was evaluated and how well it did,
+// Metrics are computed over every test prediction and Folds holds each fold on its own
+type Evaluation struct {
+	Model     string    `json:"model"`
+	Method    string    `json:"method"`
+	Folds     int       `json:"folds,omitempty"`
+	TestShare float64   `json:"test_share,omitempty"`
+	Seed      uint64    `json:"seed"`
+	Scaler    string    `json:"scaler"`
+	Settings  Settings  `json:"settings"`
+	Metrics   Metrics   `json:"metrics"`
+	PerFold   []Metrics `json:"per_fold,omitempty"`
+}
+
+// outcome is the prediction of one test row
+type outcome struct {
+	truth       int
+	predicted   int
+	probability float64
+}
+
+// This function runs stratified k-fold cross validation of the named model, every row is tested once
+// by a model fitted (scaler included) on the other folds so nothing leaks from the test rows.
+// settings are only used by knn.
+func CrossValidate(dataset *data.Dataset, model_name string, scaler_method string, settings Settings, folds int, seed uint64) (*Evaluation, error) {
+	if folds < 2 || folds > len(dataset.Labels) {
+		return nil, fmt.Errorf("folds must be between 2 and %d, got %d", len(dataset.Labels), folds)
+	}
+
+	assignment := stratified_folds(dataset.Labels, folds, seed)
+
+	evaluation := &Evaluation{
+		Model:    model_name,
+		Method:   EvaluationCrossValidation,
+		Folds:    folds,
+		Seed:     seed,
+		Scaler:   scaler_method,
+		Settings: settings,
+	}
+
+	var all []outcome
+
+	for fold := 0; fold < folds; fold++ {
+		var train, test []int
+		for index, assigned := range assignment {
+			if assigned == fold {
+				test = append(test, index)
+			} else {
+				train = append(train, index)
+			}
+		}
+
+		outcomes, possible_error := evaluate_split(dataset, model_name, scaler_method, settings, train, test)
+		if possible_error != nil {
+			return nil, fmt.Errorf("fold %d: %w", fold+1, possible_error)
+		}
+
+		evaluation.PerFold = append(evaluation.PerFold, score(outcomes))
+		all = append(all, outcomes...)
+	}
+
+	evaluation.Metrics = score(all)
+
+	return evaluation, nil
+}
+
+// This function keeps a stratified share of the rows aside, fits the named model on the rest and tests on them
+func Holdout(dataset *data.Dataset, model_name string, scaler_method string, settings Settings, test_share float64, seed uint64) (*Evaluation, error) {
+	if test_share <= 0 || test_share >= 1 {
+		return nil, fmt.Errorf("test share must be between 0 and 1, got %v", test_share)
+	}
+
+	train, test := stratified_split(dataset.Labels, test_share, seed)
+	if len(test) == 0 || len(train) == 0 {
+		return nil, fmt.Errorf("test share %v leaves an empty split", test_share)
+	}
+
+	outcomes, possible_error := evaluate_split(dataset, model_name, scaler_method, settings, train, test)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	evaluation := &Evaluation{
+		Model:     model_name,
+		Method:    EvaluationHoldout,
+		TestShare: test_share,
+		Seed:      seed,
+		Scaler:    scaler_method,
+		Settings:  settings,
+		Metrics:   score(outcomes),
+	}
+
+	return evaluation, nil
+}
+
+// fittedSplit is a model fitted on the train rows of a split with the encoder and scaler it needs
+type fittedSplit struct {
+	encoder *data.Encoder
+	scaler  *data.Scaler
+	model   Model
+}
+
+// This function encodes the rows like the schema asks, fits the scaler and the named model on the
+// train rows and predicts every test row
+func evaluate_split(dataset *data.Dataset, model_name string, scaler_method string, settings Settings, train []int, test []int) ([]outcome, error) {
+	fitted, possible_error := fit_split(dataset, model_name, scaler_method, settings, train)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	X_test, y_test := subset(dataset, test)
+
+	return fitted.predict(X_test, y_test)
+}
+
+// This function fits the encoder, the scaler and the named model on the train rows
+func fit_split(dataset *data.Dataset, model_name string, scaler_method string, settings Settings, train []int) (*fittedSplit, error) {
+	X_train, y_train := subset(dataset, train)
+
+	encoder := data.NewEncoder(dataset.Schema)
+	X_encoded := encoder.EncodeAll(X_train)
+
+	scaler, possible_error := data.FitScaler(scaler_method, X_encoded)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	model, possible_error := NewModel(model_name, encoder.Categorical(), settings)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	possible_error = model.Fit(scaler.TransformAll(X_encoded), y_train)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	return &fittedSplit{encoder: encoder, scaler: scaler, model: model}, nil
+}
+
+// This function predicts unscaled rows in schema order and pairs every prediction with its truth
+func (fitted *fittedSplit) predict(X [][]float64, y []int) ([]outcome, error) {
+	outcomes := make([]outcome, len(X))
+
+	for index, row := range X {
+		class, probabilities, possible_error := classify(fitted.model, fitted.scaler.Transform(fitted.encoder.Encode(row)))
+		if possible_error != nil {
+			return nil, possible_error
+		}
+
+		outcomes[index] = outcome{
+			truth:       y[index],
+			predicted:   class,
+			probability: probabilities[PositiveClass],
+		}
+	}
+
+	return outcomes, nil
+}
+
+// This function returns the features and labels of the given rows
+func subset(dataset *data.Dataset, rows []int) ([][]float64, []int) {
+	X := make([][]float64, len(rows))
+	y := make([]int, len(rows))
+
+	for position, index := range rows {
+		X[position] = dataset.Features[index]
+		y[position] = dataset.Labels[index]
+	}
+
+	return X, y
+}
+
+// This function shuffles the rows of every class with the seed and returns them grouped by class
+func shuffled_classes(labels []int, seed uint64) [][]int {
+	by_class := map[int][]int{}
+	for index, label := range labels {
+		by_class[label] = append(by_class[label], index)
+	}
+
+	// Walk the classes in order so the same seed always gives the same result
+	classes := make([]int, 0, len(by_class))
+	for class := range by_class {
+		classes = append(classes, class)
+	}
+	slices.Sort(classes)
+
+	random := rand.New(rand.NewPCG(seed, seed))
+	grouped := make([][]int, len(classes))
+
+	for position, class := range classes {
+		rows := by_class[class]
+		random.Shuffle(len(rows), func(i, j int) { rows[i], rows[j] = rows[j], rows[i] })
+		grouped[position] = rows
+	}
+
+	return grouped
+}
+
+// This function assigns every row to a fold so each fold keeps the class balance of the dataset
+func stratified_folds(labels []int, folds int, seed uint64) []int {
+	assignment := make([]int, len(labels))
+
+	// Deal the rows of every class to the folds like cards, continuing where the previous class stopped
+	next := 0
+	for _, rows := range shuffled_classes(labels, seed) {
+		for _, index := range rows {
+			assignment[index] = next % folds
+			next++
+		}
+	}
+
+	return assignment
+}
+
+// This function splits the rows in train and test keeping the class balance in both
+func stratified_split(labels []int, test_share float64, seed uint64) ([]int, []int) {
+	var train, test []int
+
+	for _, rows := range shuffled_classes(labels, seed) {
+		test_size := int(float64(len(rows))*test_share + 0.5)
+		test = append(test, rows[:test_size]...)
+		train = append(train, rows[test_size:]...)
+	}
+
+	slices.Sort(train)
+	slices.Sort(test)
+
+	return train, test
+}
+
+// This function computes the metrics of a set of predictions
+func score(outcomes []outcome) Metrics {
+	metrics := Metrics{Samples: len(outcomes)}
+
+	for _, result := range outcomes {
+		switch {
+		case result.truth == PositiveClass && result.predicted == PositiveClass:
+			metrics.Confusion.TruePositive++
+		case result.truth != PositiveClass && result.predicted == PositiveClass:
+			metrics.Confusion.FalsePositive++
+		case result.truth != PositiveClass && result.predicted != PositiveClass:
+			metrics.Confusion.TrueNegative++
+		default:
+			metrics.Confusion.FalseNegative++
+		}
+	}
+
+	confusion := metrics.Confusion
+	metrics.Accuracy = ratio(confusion.TruePositive+confusion.TrueNegative, len(outcomes))
+	metrics.Precision = ratio(confusion.TruePositive, confusion.TruePositive+confusion.FalsePositive)
+	metrics.Recall = ratio(confusion.TruePositive, confusion.TruePositive+confusion.FalseNegative)
+	metrics.Specificity = ratio(confusion.TrueNegative, confusion.TrueNegative+confusion.FalsePositive)
+
+	if metrics.Precision+metrics.Recall > 0 {
+		metrics.F1 = 2 * metrics.Precision * metrics.Recall / (metrics.Precision + metrics.Recall)
+	}
+
+	metrics.AUC = roc_auc(outcomes)
+
+	return metrics
+}
+
+// This function divides two counts and returns zero when there is nothing to divide
+func ratio(part int, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+
+	return float64(part) / float64(whole)
+}
+
+// This function computes the area under the ROC curve with the rank sum of the positive rows,
+// it is the chance a random positive row gets a higher probability than a random negative one
+func roc_auc(outcomes []outcome) float64 {
+	sorted := slices.Clone(outcomes)
+	slices.SortFunc(sorted, func(a, b outcome) int {
+		return cmp.Compare(a.probability, b.probability)
+	})
+
+	positives, negatives := 0, 0
+	rank_sum := 0.0
+
+	// Rows with the same probability share the average of their ranks
+	for start := 0; start < len(sorted); {
+		end := start
+		for end < len(sorted) && sorted[end].probability == sorted[start].probability {
+			end++
+		}
+
+		average_rank := float64(start+end+1) / 2
+		for _, result := range sorted[start:end] {
+			if result.truth == PositiveClass {
+				positives++
+				rank_sum += average_rank
+			} else {
+				negatives++
+			}
+		}
+
+		start = end
+	}
+
+	if positives == 0 || negatives == 0 {
+		return 0
+	}
+
+	return (rank_sum - float64(positives*(positives+1))/2) / float64(positives*negatives)
+}
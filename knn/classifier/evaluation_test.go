@@ -0,0 +1,179 @@
+package classifier
+
+import (
+	"fmt"
+	"knn/data"
+	"math"
+	"testing"
+)
+
+// heart_file is the dataset the tests and the benchmarks learn from
+const heart_file = "../../heart.csv"
+
+// This function loads heart.csv with its default schema
+func load_heart(t testing.TB) *data.Dataset {
+	t.Helper()
+
+	schema, possible_error := data.DefaultSchema()
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	dataset, possible_error := data.LoadDataset(heart_file, schema)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	return dataset
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name      string
+		outcomes  []outcome
+		confusion Confusion
+		accuracy  float64
+		precision float64
+		recall    float64
+		f1        float64
+	}{
+		{
+			name:      "all right",
+			outcomes:  []outcome{{1, 1, 0.9}, {0, 0, 0.2}},
+			confusion: Confusion{TruePositive: 1, TrueNegative: 1},
+			accuracy:  1, precision: 1, recall: 1, f1: 1,
+		},
+		{
+			name:      "one of each",
+			outcomes:  []outcome{{1, 1, 0.9}, {0, 1, 0.6}, {0, 0, 0.1}, {1, 0, 0.4}},
+			confusion: Confusion{TruePositive: 1, FalsePositive: 1, TrueNegative: 1, FalseNegative: 1},
+			accuracy:  0.5, precision: 0.5, recall: 0.5, f1: 0.5,
+		},
+		{
+			name:      "never positive",
+			outcomes:  []outcome{{1, 0, 0.3}, {0, 0, 0.1}, {0, 0, 0.2}},
+			confusion: Confusion{TrueNegative: 2, FalseNegative: 1},
+			accuracy:  2.0 / 3, precision: 0, recall: 0, f1: 0,
+		},
+		{
+			name:      "no predictions",
+			outcomes:  nil,
+			confusion: Confusion{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metrics := score(test.outcomes)
+
+			if metrics.Samples != len(test.outcomes) || metrics.Confusion != test.confusion {
+				t.Fatalf("%d samples with %+v, expected %d with %+v", metrics.Samples, metrics.Confusion, len(test.outcomes), test.confusion)
+			}
+
+			for name, pair := range map[string][2]float64{
+				"accuracy":  {metrics.Accuracy, test.accuracy},
+				"precision": {metrics.Precision, test.precision},
+				"recall":    {metrics.Recall, test.recall},
+				"f1":        {metrics.F1, test.f1},
+			} {
+				if math.Abs(pair[0]-pair[1]) > 1e-12 {
+					t.Errorf("%s is %v, expected %v", name, pair[0], pair[1])
+				}
+			}
+		})
+	}
+}
+
+func TestROCAUC(t *testing.T) {
+	tests := []struct {
+		name     string
+		outcomes []outcome
+		expected float64
+	}{
+		{"perfect ranking", []outcome{{0, 0, 0.1}, {0, 0, 0.2}, {1, 1, 0.8}, {1, 1, 0.9}}, 1},
+		{"inverted ranking", []outcome{{1, 0, 0.1}, {1, 0, 0.2}, {0, 1, 0.8}, {0, 1, 0.9}}, 0},
+		{"every probability tied", []outcome{{0, 0, 0.5}, {1, 0, 0.5}, {0, 0, 0.5}, {1, 0, 0.5}}, 0.5},
+		{"one pair out of order", []outcome{{0, 0, 0.1}, {1, 0, 0.3}, {0, 1, 0.6}, {1, 1, 0.9}}, 0.75},
+		{"tie between a positive and a negative", []outcome{{0, 0, 0.1}, {0, 1, 0.7}, {1, 1, 0.7}}, 0.75},
+		{"only positives", []outcome{{1, 1, 0.9}, {1, 1, 0.8}}, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if auc := roc_auc(test.outcomes); math.Abs(auc-test.expected) > 1e-12 {
+				t.Fatalf("auc is %v, expected %v", auc, test.expected)
+			}
+		})
+	}
+}
+
+func TestCrossValidate(t *testing.T) {
+	dataset := load_heart(t)
+	settings := Settings{K: 5, Metric: MetricEuclidean, TieBreak: TieNearest, Weighting: WeightUniform}
+
+	tests := []struct {
+		model string
+		folds int
+	}{
+		{ModelKNN, 2},
+		{ModelKNN, 5},
+		{ModelKNN, 10},
+		{ModelLogistic, 5},
+		{ModelNaiveBayes, 5},
+		{ModelTree, 5},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s/folds=%d", test.model, test.folds), func(t *testing.T) {
+			evaluation, possible_error := CrossValidate(dataset, test.model, data.ScalerMinMax, settings, test.folds, 42)
+			if possible_error != nil {
+				t.Fatal(possible_error)
+			}
+
+			// Every row is tested exactly once
+			if evaluation.Metrics.Samples != len(dataset.Labels) {
+				t.Fatalf("tested %d rows, expected %d", evaluation.Metrics.Samples, len(dataset.Labels))
+			}
+
+			if len(evaluation.PerFold) != test.folds {
+				t.Fatalf("%d folds scored, expected %d", len(evaluation.PerFold), test.folds)
+			}
+
+			// The folds are stratified so their sizes differ by at most one row per class
+			tested := 0
+			for _, fold := range evaluation.PerFold {
+				tested += fold.Samples
+				if difference := fold.Samples - len(dataset.Labels)/test.folds; difference < -2 || difference > 2 {
+					t.Errorf("fold of %d rows, expected about %d", fold.Samples, len(dataset.Labels)/test.folds)
+				}
+			}
+			if tested != len(dataset.Labels) {
+				t.Fatalf("the folds tested %d rows, expected %d", tested, len(dataset.Labels))
+			}
+
+			if evaluation.Metrics.Accuracy < 0.6 {
+				t.Fatalf("accuracy %v is no better than guessing", evaluation.Metrics.Accuracy)
+			}
+
+			// The same seed gives the same folds and so the same metrics
+			again, possible_error := CrossValidate(dataset, test.model, data.ScalerMinMax, settings, test.folds, 42)
+			if possible_error != nil {
+				t.Fatal(possible_error)
+			}
+			if again.Metrics != evaluation.Metrics {
+				t.Fatalf("metrics %+v changed to %+v with the same seed", evaluation.Metrics, again.Metrics)
+			}
+		})
+	}
+}
+
+func TestCrossValidateRefusesFolds(t *testing.T) {
+	dataset := &data.Dataset{Features: [][]float64{{0}, {1}, {2}}, Labels: []int{0, 1, 0}}
+
+	for _, folds := range []int{-1, 0, 1, 4} {
+		_, possible_error := CrossValidate(dataset, ModelKNN, data.ScalerMinMax, Settings{K: 1}, folds, 1)
+		if possible_error == nil {
+			t.Errorf("%d folds: expected an error", folds)
+		}
+	}
+}
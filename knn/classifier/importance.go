@@ -0,0 +1,134 @@
+package classifier
+
+import (
+	"cmp"
+	"fmt"
+	"knn/data"
+	"math/rand/v2"
+	"slices"
+)
+
+// The scores a permutation importance can measure the drop of
+const (
+	ImportanceAccuracy = "accuracy"
+	ImportanceAUC      = "auc"
+)
+
+// FeatureImportance is how much the score of the model drops when the values of a feature are
+// shuffled between the test rows, a feature the model ignores drops nothing and can even go negative
+type FeatureImportance struct {
+	Feature string    `json:"feature"`
+	Mean    float64   `json:"mean"`
+	Std     float64   `json:"std"`
+	Drops   []float64 `json:"drops"`
+}
+
+// ImportanceReport ranks the features by their mean drop, the most important first
+type ImportanceReport struct {
+	Model     string              `json:"model"`
+	Score     string              `json:"score"`
+	Baseline  float64             `json:"baseline"`
+	Samples   int                 `json:"samples"`
+	TestShare float64             `json:"test_share"`
+	Repeats   int                 `json:"repeats"`
+	Seed      uint64              `json:"seed"`
+	Scaler    string              `json:"scaler"`
+	Settings  Settings            `json:"settings"`
+	Features  []FeatureImportance `json:"features"`
+}
+
+// This function measures the permutation importance of every feature of the dataset: the named model
+// is fitted on a stratified split and scored on the held out rows, then every feature is shuffled
+// between those rows repeats times and the drop of the score is recorded each time.
+// The features are shuffled before encoding so a one-hot column moves as a whole.
+func PermutationImportance(dataset *data.Dataset, model_name string, scaler_method string, settings Settings, score_name string, test_share float64, repeats int, seed uint64) (*ImportanceReport, error) {
+	if test_share <= 0 || test_share >= 1 {
+		return nil, fmt.Errorf("test share must be between 0 and 1, got %v", test_share)
+	}
+
+	if repeats < 1 {
+		return nil, fmt.Errorf("repeats must be at least 1, got %d", repeats)
+	}
+
+	measure, possible_error := importance_score(score_name)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	train, test := stratified_split(dataset.Labels, test_share, seed)
+	if len(test) < 2 || len(train) == 0 {
+		return nil, fmt.Errorf("test share %v leaves too few rows to shuffle", test_share)
+	}
+
+	fitted, possible_error := fit_split(dataset, model_name, scaler_method, settings, train)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	X_test, y_test := subset(dataset, test)
+
+	outcomes, possible_error := fitted.predict(X_test, y_test)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	report := &ImportanceReport{
+		Model:     model_name,
+		Score:     score_name,
+		Baseline:  measure(outcomes),
+		Samples:   len(test),
+		TestShare: test_share,
+		Repeats:   repeats,
+		Seed:      seed,
+		Scaler:    scaler_method,
+		Settings:  settings,
+	}
+
+	random := rand.New(rand.NewPCG(seed, seed))
+	X_shuffled := make([][]float64, len(X_test))
+	for index, row := range X_test {
+		X_shuffled[index] = slices.Clone(row)
+	}
+
+	for feature, field := range dataset.Schema.FeatureFields() {
+		importance := FeatureImportance{Feature: field, Drops: make([]float64, repeats)}
+
+		for repeat := range importance.Drops {
+			random.Shuffle(len(X_shuffled), func(i, j int) {
+				X_shuffled[i][feature], X_shuffled[j][feature] = X_shuffled[j][feature], X_shuffled[i][feature]
+			})
+
+			outcomes, possible_error := fitted.predict(X_shuffled, y_test)
+			if possible_error != nil {
+				return nil, possible_error
+			}
+
+			importance.Drops[repeat] = report.Baseline - measure(outcomes)
+		}
+
+		importance.Mean, importance.Std = data.MeanStd(importance.Drops)
+
+		// Put the column back before shuffling the next one
+		for index, row := range X_test {
+			X_shuffled[index][feature] = row[feature]
+		}
+
+		report.Features = append(report.Features, importance)
+	}
+
+	slices.SortStableFunc(report.Features, func(a, b FeatureImportance) int { return cmp.Compare(b.Mean, a.Mean) })
+
+	return report, nil
+}
+
+// This function returns how to compute the named score from the predictions
+func importance_score(name string) (func([]outcome) float64, error) {
+	switch name {
+	case ImportanceAccuracy:
+		return func(outcomes []outcome) float64 { return score(outcomes).Accuracy }, nil
+	case ImportanceAUC:
+		return roc_auc, nil
+	default:
+		return nil, fmt.Errorf("unknown importance score %q, must be %s or %s", name, ImportanceAccuracy, ImportanceAUC)
+	}
+}
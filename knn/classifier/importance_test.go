@@ -0,0 +1,101 @@
+package classifier
+
+import (
+	"knn/data"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"testing"
+)
+
+// This function returns a dataset whose label only follows the signal feature, the noise feature
+// is random
+func signal_dataset() *data.Dataset {
+	schema := &data.Schema{
+		Label: "target",
+		Columns: []data.Column{
+			{Name: "noise", Field: "noise", Type: data.TypeFloat},
+			{Name: "signal", Field: "signal", Type: data.TypeFloat},
+			{Name: "target", Field: "target", Type: data.TypeCategorical, Values: []float64{0, 1}},
+		},
+	}
+
+	random := rand.New(rand.NewPCG(5, 6))
+	dataset := &data.Dataset{Schema: schema}
+
+	for row := 0; row < 200; row++ {
+		signal := random.Float64()
+		label := 0
+		if signal > 0.5 {
+			label = 1
+		}
+
+		dataset.Features = append(dataset.Features, []float64{random.Float64(), signal})
+		dataset.Labels = append(dataset.Labels, label)
+	}
+
+	return dataset
+}
+
+func TestPermutationImportance(t *testing.T) {
+	dataset := signal_dataset()
+	settings := Settings{K: 5, Metric: MetricEuclidean, TieBreak: TieNearest, Weighting: WeightUniform}
+
+	for _, model := range []string{ModelKNN, ModelLogistic, ModelTree} {
+		t.Run(model, func(t *testing.T) {
+			report, possible_error := PermutationImportance(dataset, model, data.ScalerMinMax, settings, ImportanceAccuracy, 0.3, 5, 42)
+			if possible_error != nil {
+				t.Fatal(possible_error)
+			}
+
+			if report.Samples != 60 || report.Baseline < 0.8 {
+				t.Fatalf("baseline %v on %d rows, expected a good model on 60", report.Baseline, report.Samples)
+			}
+
+			signal, noise := report.Features[0], report.Features[1]
+			if signal.Feature != "signal" || noise.Feature != "noise" {
+				t.Fatalf("ranked %s before %s", signal.Feature, noise.Feature)
+			}
+			if signal.Mean < 0.2 || math.Abs(noise.Mean) > 0.1 || len(signal.Drops) != 5 {
+				t.Fatalf("signal drops %v and noise %v", signal.Drops, noise.Drops)
+			}
+
+			// The same seed shuffles the same way
+			again, possible_error := PermutationImportance(dataset, model, data.ScalerMinMax, settings, ImportanceAccuracy, 0.3, 5, 42)
+			if possible_error != nil {
+				t.Fatal(possible_error)
+			}
+			if !reflect.DeepEqual(again, report) {
+				t.Fatal("the same seed gave another report")
+			}
+		})
+	}
+}
+
+func TestPermutationImportanceRefuses(t *testing.T) {
+	dataset := signal_dataset()
+	settings := Settings{K: 5, Metric: MetricEuclidean, TieBreak: TieNearest, Weighting: WeightUniform}
+
+	tests := []struct {
+		name       string
+		model      string
+		score      string
+		test_share float64
+		repeats    int
+	}{
+		{"no test rows", ModelKNN, ImportanceAccuracy, 0, 5},
+		{"no training rows", ModelKNN, ImportanceAccuracy, 1, 5},
+		{"no repeat", ModelKNN, ImportanceAccuracy, 0.3, 0},
+		{"unknown score", ModelKNN, "f1", 0.3, 5},
+		{"unknown model", "svm", ImportanceAccuracy, 0.3, 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, possible_error := PermutationImportance(dataset, test.model, data.ScalerMinMax, settings, test.score, test.test_share, test.repeats, 42)
+			if possible_error == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
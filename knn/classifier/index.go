@@ -0,0 +1,387 @@
+package classifier
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// The supported neighbor search structures
+const (
+	IndexBrute    = "brute"
+	IndexKDTree   = "kdtree"
+	IndexBallTree = "balltree"
+	IndexLSH      = "lsh"
+)
+
+// IndexOptions chooses the neighbor index and tunes it, tables, bits, probes and seed
+// are only used by the approximate lsh index
+type IndexOptions struct {
+	Kind   string `json:"kind"`
+	Tables int    `json:"tables,omitempty"`
+	Bits   int    `json:"bits,omitempty"`
+	Probes int    `json:"probes,omitempty"`
+	Seed   uint64 `json:"seed,omitempty"`
+}
+
+// This function returns the options used when nothing else is configured, a brute force scan
+// and the lsh knobs to use when the kind is switched to lsh
+func DefaultIndexOptions() IndexOptions {
+	return IndexOptions{
+		Kind:   IndexBrute,
+		Tables: default_lsh_tables,
+		Bits:   default_lsh_bits,
+		Probes: default_lsh_probes,
+	}
+}
+
+// This function clears the knobs the kind of index doesn't use so only the relevant ones are reported
+func (options IndexOptions) Resolve() IndexOptions {
+	if options.Kind == "" {
+		options.Kind = IndexBrute
+	}
+
+	if options.Kind != IndexLSH {
+		return IndexOptions{Kind: options.Kind}
+	}
+
+	return options
+}
+
+// leaf_size is the number of rows under which a tree stops splitting and scans its rows
+const leaf_size = 16
+
+// index finds the k nearest training rows of a query. The neighbors are sorted by distance and
+// then by row, the exact indexes return exactly what a full scan would while the lsh index may
+// miss some of them. ok is false when the index can't search with the given metric and the
+// caller has to scan every row instead.
+type index interface {
+	search(query []float64, k int, settings Settings, metric Metric) (neighbors []neighbor, ok bool)
+}
+
+// This function builds the index of the given kind over X, settings are the default settings of
+// the model since a ball tree is built for one metric
+func newIndex(options IndexOptions, X [][]float64, settings Settings, categorical []bool, ranges []float64) (index, error) {
+	switch options.Kind {
+	case "", IndexBrute:
+		return nil, nil
+	case IndexKDTree:
+		return newKDTree(X), nil
+	case IndexBallTree:
+		if settings.Metric == MetricCosine {
+			return nil, fmt.Errorf("balltree can't index the %s metric, it breaks the triangle inequality", settings.Metric)
+		}
+
+		metric, possible_error := NewMetric(settings.Metric, settings.P, categorical, ranges)
+		if possible_error != nil {
+			return nil, possible_error
+		}
+
+		return newBallTree(X, settings, metric), nil
+	case IndexLSH:
+		return newLSH(X, options)
+	default:
+		return nil, fmt.Errorf("unknown neighbor index %q", options.Kind)
+	}
+}
+
+// top_k keeps the k closest neighbors seen so far in a max heap, the farthest one is at the root
+type top_k struct {
+	k     int
+	items []neighbor
+}
+
+// This function returns an empty heap keeping the k closest neighbors
+func newTopK(k int) *top_k {
+	return &top_k{k: k, items: make([]neighbor, 0, k)}
+}
+
+// This function orders neighbors by distance and then by row
+func closer(a, b neighbor) bool {
+	return a.distance < b.distance || (a.distance == b.distance && a.index < b.index)
+}
+
+// This function returns the distance a new neighbor has to beat, infinity until the heap is full
+func (heap *top_k) worst() float64 {
+	if len(heap.items) < heap.k {
+		return math.Inf(1)
+	}
+
+	return heap.items[0].distance
+}
+
+// This function adds the candidate if it is closer than the farthest kept neighbor
+func (heap *top_k) push(candidate neighbor) {
+	if len(heap.items) < heap.k {
+		heap.items = append(heap.items, candidate)
+
+		// Move the new neighbor up while it is farther than its parent
+		child := len(heap.items) - 1
+		for child > 0 {
+			parent := (child - 1) / 2
+			if !closer(heap.items[parent], heap.items[child]) {
+				break
+			}
+			heap.items[parent], heap.items[child] = heap.items[child], heap.items[parent]
+			child = parent
+		}
+		return
+	}
+
+	if !closer(candidate, heap.items[0]) {
+		return
+	}
+
+	// Replace the farthest neighbor and move the candidate down to its place
+	heap.items[0] = candidate
+	parent := 0
+	for {
+		farthest := parent
+		for _, child := range []int{2*parent + 1, 2*parent + 2} {
+			if child < len(heap.items) && closer(heap.items[farthest], heap.items[child]) {
+				farthest = child
+			}
+		}
+		if farthest == parent {
+			return
+		}
+		heap.items[parent], heap.items[farthest] = heap.items[farthest], heap.items[parent]
+		parent = farthest
+	}
+}
+
+// This function returns the kept neighbors from the closest to the farthest
+func (heap *top_k) sorted() []neighbor {
+	neighbors := slices.Clone(heap.items)
+
+	slices.SortFunc(neighbors, func(a, b neighbor) int {
+		return cmp.Or(cmp.Compare(a.distance, b.distance), cmp.Compare(a.index, b.index))
+	})
+
+	return neighbors
+}
+
+// tree_node is a node of a kd tree or a ball tree, a leaf has no children and scans
+// the rows order[start:end]
+type tree_node struct {
+	start, end  int
+	left, right int
+
+	// kd tree split
+	dimension int
+	split     float64
+
+	// ball tree bounding ball
+	center []float64
+	radius float64
+}
+
+// This function sorts order[start:end] along the dimension where the rows spread the most
+// and returns that dimension and the middle position
+func split_rows(X [][]float64, order []int, start int, end int) (int, int) {
+	dimension, widest := 0, -1.0
+
+	for feature := range X[order[start]] {
+		low, high := math.Inf(1), math.Inf(-1)
+		for _, row := range order[start:end] {
+			low = min(low, X[row][feature])
+			high = max(high, X[row][feature])
+		}
+		if high-low > widest {
+			dimension, widest = feature, high-low
+		}
+	}
+
+	slices.SortFunc(order[start:end], func(a, b int) int {
+		return cmp.Compare(X[a][dimension], X[b][dimension])
+	})
+
+	return dimension, (start + end) / 2
+}
+
+// This function returns the identity permutation of n rows
+func all_rows(n int) []int {
+	order := make([]int, n)
+	for row := range order {
+		order[row] = row
+	}
+
+	return order
+}
+
+// kd_tree splits the space along one feature at a time, it can prune with any metric where
+// the difference on a single feature is never more than the distance
+type kd_tree struct {
+	X     [][]float64
+	order []int
+	nodes []tree_node
+}
+
+// This function builds a kd tree over X
+func newKDTree(X [][]float64) *kd_tree {
+	tree := &kd_tree{X: X, order: all_rows(len(X))}
+	tree.build(0, len(X))
+
+	return tree
+}
+
+// This function builds the node of order[start:end] and returns its position
+func (tree *kd_tree) build(start int, end int) int {
+	position := len(tree.nodes)
+	tree.nodes = append(tree.nodes, tree_node{start: start, end: end, left: -1, right: -1})
+
+	if end-start <= leaf_size {
+		return position
+	}
+
+	dimension, middle := split_rows(tree.X, tree.order, start, end)
+
+	// Rows left of the middle are not above the split and rows right of it are not below it
+	tree.nodes[position].dimension = dimension
+	tree.nodes[position].split = tree.X[tree.order[middle]][dimension]
+
+	left := tree.build(start, middle)
+	right := tree.build(middle, end)
+	tree.nodes[position].left = left
+	tree.nodes[position].right = right
+
+	return position
+}
+
+func (tree *kd_tree) search(query []float64, k int, settings Settings, metric Metric) ([]neighbor, bool) {
+	switch settings.Metric {
+	case MetricEuclidean, MetricManhattan, MetricMinkowski, MetricChebyshev:
+	default:
+		return nil, false
+	}
+
+	heap := newTopK(k)
+	tree.visit(0, query, heap, metric)
+
+	return heap.sorted(), true
+}
+
+// This function scans a leaf or visits the side of the split holding the query first,
+// the other side is skipped when the split alone is farther than the kept neighbors
+func (tree *kd_tree) visit(position int, query []float64, heap *top_k, metric Metric) {
+	node := &tree.nodes[position]
+
+	if node.left < 0 {
+		for _, row := range tree.order[node.start:node.end] {
+			heap.push(neighbor{index: row, distance: metric(tree.X[row], query)})
+		}
+		return
+	}
+
+	difference := query[node.dimension] - node.split
+	near, far := node.left, node.right
+	if difference > 0 {
+		near, far = far, near
+	}
+
+	tree.visit(near, query, heap, metric)
+
+	if math.Abs(difference) <= heap.worst() {
+		tree.visit(far, query, heap, metric)
+	}
+}
+
+// ball_tree wraps groups of rows in balls, it can prune with any true metric thanks to the
+// triangle inequality but the radiuses only hold for the metric it was built with
+type ball_tree struct {
+	X      [][]float64
+	order  []int
+	nodes  []tree_node
+	metric string
+	p      float64
+}
+
+// This function builds a ball tree over X for the metric of the settings
+func newBallTree(X [][]float64, settings Settings, metric Metric) *ball_tree {
+	tree := &ball_tree{X: X, order: all_rows(len(X)), metric: settings.Metric, p: settings.P}
+	tree.build(0, len(X), metric)
+
+	return tree
+}
+
+// This function builds the node of order[start:end] and returns its position
+func (tree *ball_tree) build(start int, end int, metric Metric) int {
+	// The ball is centered on the mean of its rows and reaches the farthest one
+	center := make([]float64, len(tree.X[0]))
+	for _, row := range tree.order[start:end] {
+		for feature, value := range tree.X[row] {
+			center[feature] += value
+		}
+	}
+	for feature := range center {
+		center[feature] /= float64(end - start)
+	}
+
+	radius := 0.0
+	for _, row := range tree.order[start:end] {
+		radius = max(radius, metric(tree.X[row], center))
+	}
+
+	position := len(tree.nodes)
+	tree.nodes = append(tree.nodes, tree_node{start: start, end: end, left: -1, right: -1, center: center, radius: radius})
+
+	if end-start <= leaf_size {
+		return position
+	}
+
+	_, middle := split_rows(tree.X, tree.order, start, end)
+
+	left := tree.build(start, middle, metric)
+	right := tree.build(middle, end, metric)
+	tree.nodes[position].left = left
+	tree.nodes[position].right = right
+
+	return position
+}
+
+func (tree *ball_tree) search(query []float64, k int, settings Settings, metric Metric) ([]neighbor, bool) {
+	if settings.Metric != tree.metric || (tree.metric == MetricMinkowski && settings.P != tree.p) {
+		return nil, false
+	}
+
+	heap := newTopK(k)
+	tree.visit(0, query, heap, metric, tree.bound(0, query, metric))
+
+	return heap.sorted(), true
+}
+
+// This function returns the smallest distance a row of the node can have to the query
+func (tree *ball_tree) bound(position int, query []float64, metric Metric) float64 {
+	node := &tree.nodes[position]
+
+	// Leave some room for rounding so a row at exactly the kept distance isn't skipped
+	return max(0, metric(node.center, query)-node.radius-distance_epsilon)
+}
+
+// This function scans a leaf or visits the closest child ball first, a ball is skipped
+// when even its closest possible row is farther than the kept neighbors
+func (tree *ball_tree) visit(position int, query []float64, heap *top_k, metric Metric, bound float64) {
+	if bound > heap.worst() {
+		return
+	}
+
+	node := &tree.nodes[position]
+
+	if node.left < 0 {
+		for _, row := range tree.order[node.start:node.end] {
+			heap.push(neighbor{index: row, distance: metric(tree.X[row], query)})
+		}
+		return
+	}
+
+	near, far := node.left, node.right
+	near_bound, far_bound := tree.bound(near, query, metric), tree.bound(far, query, metric)
+	if far_bound < near_bound {
+		near, far = far, near
+		near_bound, far_bound = far_bound, near_bound
+	}
+
+	tree.visit(near, query, heap, metric, near_bound)
+	tree.visit(far, query, heap, metric, far_bound)
+}
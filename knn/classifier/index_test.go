@@ -0,0 +1,136 @@
+package classifier
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// This function returns n random rows with a few repeated values so some distances tie
+func random_rows(n int, features int, random *rand.Rand) [][]float64 {
+	rows := make([][]float64, n)
+
+	for index := range rows {
+		rows[index] = make([]float64, features)
+		for feature := range rows[index] {
+			rows[index][feature] = float64(random.IntN(20)) / 19
+		}
+	}
+
+	return rows
+}
+
+// The exact indexes must find the same neighbors as the brute force scan, in the same order
+func TestIndexMatchesBruteForce(t *testing.T) {
+	random := rand.New(rand.NewPCG(3, 4))
+
+	X := random_rows(500, 6, random)
+	y := make([]int, len(X))
+	for index := range y {
+		y[index] = random.IntN(2)
+	}
+	categorical := make([]bool, 6)
+	queries := random_rows(50, 6, random)
+
+	brute := NewKNN(X, y, categorical)
+
+	tests := []struct {
+		kind   string
+		metric string
+		k      int
+	}{
+		{IndexKDTree, MetricEuclidean, 1},
+		{IndexKDTree, MetricEuclidean, 7},
+		{IndexKDTree, MetricManhattan, 5},
+		{IndexKDTree, MetricChebyshev, 5},
+		{IndexKDTree, MetricMinkowski, 9},
+		{IndexBallTree, MetricEuclidean, 1},
+		{IndexBallTree, MetricEuclidean, 7},
+		{IndexBallTree, MetricManhattan, 5},
+		{IndexBallTree, MetricChebyshev, 5},
+		{IndexBallTree, MetricMinkowski, 9},
+		{IndexBallTree, MetricGower, 5},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s/%s/k=%d", test.kind, test.metric, test.k), func(t *testing.T) {
+			settings := Settings{K: test.k, Metric: test.metric, P: 3, TieBreak: TieNearest, Weighting: WeightUniform}
+
+			indexed, possible_error := brute.Indexed(IndexOptions{Kind: test.kind}, settings)
+			if possible_error != nil {
+				t.Fatal(possible_error)
+			}
+
+			for _, query := range queries {
+				expected, possible_error := brute.Nearest(query, nil, settings)
+				if possible_error != nil {
+					t.Fatal(possible_error)
+				}
+
+				found, possible_error := indexed.Nearest(query, nil, settings)
+				if possible_error != nil {
+					t.Fatal(possible_error)
+				}
+
+				if !slices.Equal(found, expected) {
+					t.Fatalf("query %v: found %v, brute force found %v", query, found, expected)
+				}
+			}
+		})
+	}
+}
+
+// A ball tree can't be built for the cosine metric
+func TestBallTreeRefusesCosine(t *testing.T) {
+	knn := NewKNN([][]float64{{0, 1}, {1, 0}}, []int{0, 1}, []bool{false, false})
+
+	_, possible_error := knn.Indexed(IndexOptions{Kind: IndexBallTree}, Settings{K: 1, Metric: MetricCosine})
+	if possible_error == nil {
+		t.Fatal("expected an error for a cosine ball tree")
+	}
+}
+
+func TestTopK(t *testing.T) {
+	tests := []struct {
+		name      string
+		k         int
+		distances []float64
+		expected  []neighbor
+	}{
+		{"fewer than k", 3, []float64{0.5, 0.1}, []neighbor{{1, 0.1}, {0, 0.5}}},
+		{"keeps the closest", 2, []float64{0.9, 0.3, 0.7, 0.1, 0.5}, []neighbor{{3, 0.1}, {1, 0.3}}},
+		{"ties go to the first row", 2, []float64{0.2, 0.2, 0.2, 0.2}, []neighbor{{0, 0.2}, {1, 0.2}}},
+		{"tie with the farthest is refused", 1, []float64{0.4, 0.4}, []neighbor{{0, 0.4}}},
+		{"k of one", 1, []float64{3, 2, 1, 2, 3}, []neighbor{{2, 1}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			heap := newTopK(test.k)
+
+			for index, distance := range test.distances {
+				heap.push(neighbor{index: index, distance: distance})
+			}
+
+			found := heap.sorted()
+			if !slices.Equal(found, test.expected) {
+				t.Fatalf("kept %v, expected %v", found, test.expected)
+			}
+
+			if len(test.distances) >= test.k && heap.worst() != test.expected[len(test.expected)-1].distance {
+				t.Fatalf("worst is %v, expected %v", heap.worst(), test.expected[len(test.expected)-1].distance)
+			}
+		})
+	}
+}
+
+// An empty heap accepts any neighbor
+func TestTopKWorstUntilFull(t *testing.T) {
+	heap := newTopK(2)
+	heap.push(neighbor{index: 0, distance: 5})
+
+	if worst := heap.worst(); worst < 1e300 {
+		t.Fatalf("worst of a heap that isn't full is %v, expected infinity", worst)
+	}
+}
@@ -0,0 +1,171 @@
+package classifier
+
+import (
+	"math"
+	"runtime"
+	"sync"
+)
+
+// parallel_rows is the training set size from which a scan is split between goroutines,
+// below it starting them costs more than they save
+const parallel_rows = 20000
+
+// kernel is a distance computed straight on the flat training matrix. reduced orders the rows
+// like the metric but skips its final root, finish turns a reduced distance into the real one
+// and reduce turns a real distance back, so the root is only paid for the rows that come close
+// to the kept neighbors.
+type kernel struct {
+	reduced func(row, query []float64) float64
+	finish  func(reduced float64) float64
+	reduce  func(distance float64) float64
+}
+
+// reduced_slack widens the reduced bound of the farthest kept neighbor: reduced distances a few
+// roundings apart can finish equal, and a row tying the farthest one on a lower row must still
+// get in. The rows inside the slack are compared on their real distance.
+const reduced_slack = 1e-9
+
+// This function returns the kernel of the metric, ok is false for the metrics without one
+// (cosine, hamming and gower) which are computed with their Metric instead
+func newKernel(name string, p float64) (kernel, bool) {
+	identity := func(reduced float64) float64 { return reduced }
+
+	switch {
+	case name == MetricEuclidean || (name == MetricMinkowski && p == 2):
+		return kernel{reduced: squared_euclidean, finish: math.Sqrt, reduce: func(distance float64) float64 { return distance * distance }}, true
+	case name == MetricManhattan || (name == MetricMinkowski && p == 1):
+		return kernel{reduced: manhattan, finish: identity, reduce: identity}, true
+	case name == MetricChebyshev:
+		return kernel{reduced: chebyshev, finish: identity, reduce: identity}, true
+	case name == MetricMinkowski:
+		return kernel{
+			reduced: func(row, query []float64) float64 { return minkowski_sum(row, query, p) },
+			finish:  func(reduced float64) float64 { return math.Pow(reduced, 1/p) },
+			reduce:  func(distance float64) float64 { return math.Pow(distance, p) },
+		}, true
+	default:
+		return kernel{}, false
+	}
+}
+
+// This function returns the euclidean distance without its square root
+func squared_euclidean(a, b []float64) float64 {
+	sum := 0.0
+
+	for r := range a {
+		difference := a[r] - b[r]
+		sum += difference * difference
+	}
+
+	return sum
+}
+
+// This function returns the minkowski distance without its p root
+func minkowski_sum(a, b []float64, p float64) float64 {
+	sum := 0.0
+
+	for r := range a {
+		sum += power(math.Abs(a[r]-b[r]), p)
+	}
+
+	return sum
+}
+
+// This function raises x to the power p, whole powers are multiplied out since math.Pow
+// is far slower than a few multiplications
+func power(x float64, p float64) float64 {
+	if p != math.Trunc(p) || p > 16 {
+		return math.Pow(x, p)
+	}
+
+	result := 1.0
+	for exponent := int(p); exponent > 0; exponent >>= 1 {
+		if exponent&1 == 1 {
+			result *= x
+		}
+		x *= x
+	}
+
+	return result
+}
+
+// This function checks every training row and returns the k closest to X_to_predict sorted by
+// distance. Large training sets are split in chunks scanned by one goroutine each, every chunk
+// keeps its own k best rows and the chunks are merged at the end.
+func (knn *KNN) scan(X_to_predict []float64, settings Settings, metric Metric) []neighbor {
+	kernel, fast := newKernel(settings.Metric, settings.P)
+
+	return knn.scan_rows(X_to_predict, settings.K, func() Metric { return metric }, kernel, fast)
+}
+
+// This function scans every row with the kernel when fast is set and otherwise with a metric
+// built by metrics for each goroutine, so a metric may keep buffers between the rows it measures
+func (knn *KNN) scan_rows(X_to_predict []float64, k int, metrics func() Metric, kernel kernel, fast bool) []neighbor {
+	rows := len(knn.y)
+
+	workers := 1
+	if rows >= parallel_rows {
+		workers = min(runtime.NumCPU(), rows/(parallel_rows/4))
+	}
+
+	chunk := (rows + workers - 1) / workers
+	heaps := make([]*top_k, workers)
+
+	scan_chunk := func(worker int) {
+		start, end := worker*chunk, min((worker+1)*chunk, rows)
+		heaps[worker] = newTopK(k)
+
+		if fast {
+			knn.scan_flat(X_to_predict, start, end, kernel, heaps[worker])
+			return
+		}
+
+		metric := metrics()
+		for index := start; index < end; index++ {
+			heaps[worker].push(neighbor{index: index, distance: metric(knn.X[index], X_to_predict)})
+		}
+	}
+
+	if workers == 1 {
+		scan_chunk(0)
+	} else {
+		var wait_group sync.WaitGroup
+		for worker := range heaps {
+			wait_group.Add(1)
+			go func() {
+				defer wait_group.Done()
+				scan_chunk(worker)
+			}()
+		}
+		wait_group.Wait()
+	}
+
+	merged := heaps[0]
+	for _, heap := range heaps[1:] {
+		for _, kept := range heap.items {
+			merged.push(kept)
+		}
+	}
+
+	return merged.sorted()
+}
+
+// This function pushes the rows start to end of the flat matrix that may be among the nearest,
+// the heap keeps real distances so the ties are broken by row like the other searches
+func (knn *KNN) scan_flat(X_to_predict []float64, start int, end int, kernel kernel, heap *top_k) {
+	features := len(X_to_predict)
+	bound := math.Inf(1)
+
+	for index := start; index < end; index++ {
+		row := knn.flat[index*features : (index+1)*features]
+		distance := kernel.reduced(row, X_to_predict)
+
+		// Most rows are farther than the kept ones once the heap is full, skip the root for them
+		if distance > bound {
+			continue
+		}
+
+		heap.push(neighbor{index: index, distance: kernel.finish(distance)})
+		bound = kernel.reduce(heap.worst()) * (1 + reduced_slack)
+	}
+}
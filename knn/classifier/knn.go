@@ -0,0 +1,398 @@
+package classifier
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// The supported rules to break a tie between classes with the same number of votes
+const (
+	TieNearest  = "nearest"
+	TiePositive = "positive"
+	TieNegative = "negative"
+)
+
+// The supported ways to weigh the vote of each neighbor
+const (
+	WeightUniform  = "uniform"
+	WeightDistance = "distance"
+	WeightGaussian = "gaussian"
+	WeightRank     = "rank"
+)
+
+// PositiveClass is the label of the class whose probability is reported, in heart.csv 1 means heart disease
+const PositiveClass = 1
+
+// distance_epsilon keeps the weight of a neighbor at distance zero finite
+const distance_epsilon = 1e-9
+
+// Settings are the knobs of a KNN prediction, a zero value means "use the default"
+type Settings struct {
+	K         int     `json:"k,omitempty"`
+	Metric    string  `json:"metric,omitempty"`
+	P         float64 `json:"p,omitempty"`
+	TieBreak  string  `json:"tie_break,omitempty"`
+	Weighting string  `json:"weighting,omitempty"`
+	Bandwidth float64 `json:"bandwidth,omitempty"`
+}
+
+// This function fills every setting left empty with the matching default
+func (settings Settings) Resolve(defaults Settings) Settings {
+	if settings.K == 0 {
+		settings.K = defaults.K
+	}
+	if settings.Metric == "" {
+		settings.Metric = defaults.Metric
+	}
+	if settings.P == 0 {
+		settings.P = defaults.P
+	}
+	if settings.TieBreak == "" {
+		settings.TieBreak = defaults.TieBreak
+	}
+	if settings.Weighting == "" {
+		settings.Weighting = defaults.Weighting
+	}
+	if settings.Bandwidth == 0 {
+		settings.Bandwidth = defaults.Bandwidth
+	}
+
+	// p only means something to the minkowski metric, don't echo it otherwise
+	if settings.Metric != MetricMinkowski {
+		settings.P = 0
+	}
+
+	// Same for the bandwidth of the gaussian kernel
+	if settings.Weighting != WeightGaussian {
+		settings.Bandwidth = 0
+	}
+
+	return settings
+}
+
+// This function makes sure the settings can be used on a training set of the given size
+func (settings Settings) Validate(rows int) error {
+	if settings.K < 1 || settings.K > rows {
+		return fmt.Errorf("k must be between 1 and %d, got %d", rows, settings.K)
+	}
+
+	if settings.TieBreak != TieNearest && settings.TieBreak != TiePositive && settings.TieBreak != TieNegative {
+		return fmt.Errorf("unknown tie break rule %q", settings.TieBreak)
+	}
+
+	switch settings.Weighting {
+	case WeightUniform, WeightDistance, WeightGaussian, WeightRank:
+	default:
+		return fmt.Errorf("unknown weighting %q", settings.Weighting)
+	}
+
+	if settings.Bandwidth < 0 {
+		return fmt.Errorf("bandwidth can't be negative, got %v", settings.Bandwidth)
+	}
+
+	_, possible_error := NewMetric(settings.Metric, settings.P, nil, nil)
+	return possible_error
+}
+
+// KNN predicts the class of a vector from the classes of its nearest training vectors.
+// It only reads its training set so it is safe to share between goroutines.
+type KNN struct {
+	X             [][]float64
+	flat          []float64
+	y             []int
+	categorical   []bool
+	ranges        []float64
+	index         index
+	index_options IndexOptions
+}
+
+// Prediction is the outcome of a prediction, Probability is the one of the positive class.
+// The votes, neighbors, k and settings behind it are only filled by a KNN.
+type Prediction struct {
+	Model         string          `json:"model"`
+	Class         int             `json:"class"`
+	Label         string          `json:"label,omitempty"`
+	Probability   float64         `json:"probability"`
+	Probabilities map[int]float64 `json:"probabilities"`
+	Votes         map[int]int     `json:"votes,omitempty"`
+	Scores        map[int]float64 `json:"scores,omitempty"`
+	Neighbors     []Neighbor      `json:"neighbors,omitempty"`
+	K             int             `json:"k,omitempty"`
+	Settings      *Settings       `json:"settings,omitempty"`
+}
+
+// Neighbor is one of the nearest training rows and the weight of its vote
+type Neighbor struct {
+	Index    int     `json:"index"`
+	Class    int     `json:"class"`
+	Distance float64 `json:"distance"`
+	Weight   float64 `json:"weight"`
+}
+
+// neighbor is a training row and its distance to the vector being predicted
+type neighbor struct {
+	index    int
+	distance float64
+}
+
+// This function creates a KNN over an already scaled training set, categorical marks which
+// features are categorical codes
+func NewKNN(X [][]float64, y []int, categorical []bool) *KNN {
+	// Keep the spread of every feature for the metrics that normalize by it
+	ranges := make([]float64, len(categorical))
+	for feature := range ranges {
+		low, high := X[0][feature], X[0][feature]
+		for _, row := range X {
+			low = min(low, row[feature])
+			high = max(high, row[feature])
+		}
+		ranges[feature] = high - low
+	}
+
+	// Keep the rows back to back too so a scan walks one contiguous block of memory
+	flat := make([]float64, 0, len(X)*len(categorical))
+	for _, row := range X {
+		flat = append(flat, row...)
+	}
+
+	return &KNN{
+		X:             X,
+		flat:          flat,
+		y:             y,
+		categorical:   categorical,
+		ranges:        ranges,
+		index_options: IndexOptions{Kind: IndexBrute},
+	}
+}
+
+// This function returns a copy of the KNN that finds neighbors with the index described by the
+// options, settings are the defaults the index is built for. Requests using a metric the index
+// can't handle still get an exact answer by scanning every row.
+func (knn *KNN) Indexed(options IndexOptions, settings Settings) (*KNN, error) {
+	options = options.Resolve()
+
+	built, possible_error := newIndex(options, knn.X, settings, knn.categorical, knn.ranges)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	indexed := *knn
+	indexed.index = built
+	indexed.index_options = options
+
+	return &indexed, nil
+}
+
+// This function returns the options of the index used to find the neighbors
+func (knn *KNN) Index() IndexOptions {
+	return knn.index_options
+}
+
+// This function will predict the class of X_to_predict based on the classes of its k nearest neighbors
+func (knn *KNN) Predict(X_to_predict []float64, settings Settings) (Prediction, error) {
+	return knn.PredictPartial(X_to_predict, nil, settings)
+}
+
+// This function predicts like Predict but measures the distances over the present features only,
+// the other values of X_to_predict are ignored. A nil present means every feature is present.
+func (knn *KNN) PredictPartial(X_to_predict []float64, present []bool, settings Settings) (Prediction, error) {
+	neighbors, possible_error := knn.nearest(X_to_predict, present, settings)
+	if possible_error != nil {
+		return Prediction{}, possible_error
+	}
+
+	weights := vote_weights(neighbors, settings)
+
+	// Count the votes and add up the weights of every class, the probability of a class is its
+	// share of the weights that elected the verdict so both always agree
+	votes := map[int]int{}
+	scores := map[int]float64{}
+	probabilities := map[int]float64{}
+	total_weight := 0.0
+	explained := make([]Neighbor, len(neighbors))
+
+	for index, neighbor := range neighbors {
+		class := knn.y[neighbor.index]
+		votes[class]++
+		scores[class] += weights[index]
+
+		total_weight += weights[index]
+
+		explained[index] = Neighbor{
+			Index:    neighbor.index,
+			Class:    class,
+			Distance: neighbor.distance,
+			Weight:   weights[index],
+		}
+	}
+
+	for class, score := range scores {
+		probabilities[class] = score / total_weight
+	}
+
+	prediction := Prediction{
+		Model:         ModelKNN,
+		Class:         knn.elect(scores, neighbors, settings.TieBreak),
+		Probability:   probabilities[PositiveClass],
+		Probabilities: probabilities,
+		Votes:         votes,
+		Scores:        scores,
+		Neighbors:     explained,
+		K:             settings.K,
+		Settings:      &settings,
+	}
+
+	return prediction, nil
+}
+
+// This function returns the k nearest training rows of X_to_predict measured over the present
+// features, they are used to fill the missing features of a patient with those of similar ones
+func (knn *KNN) Nearest(X_to_predict []float64, present []bool, settings Settings) ([]Neighbor, error) {
+	neighbors, possible_error := knn.nearest(X_to_predict, present, settings)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	nearest := make([]Neighbor, len(neighbors))
+	for index, neighbor := range neighbors {
+		nearest[index] = Neighbor{Index: neighbor.index, Class: knn.y[neighbor.index], Distance: neighbor.distance}
+	}
+
+	return nearest, nil
+}
+
+// This function checks the settings and finds the nearest rows, only a full vector can use the
+// index and the distance kernels since both are built for every feature
+func (knn *KNN) nearest(X_to_predict []float64, present []bool, settings Settings) ([]neighbor, error) {
+	possible_error := settings.Validate(len(knn.X))
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	if present == nil {
+		metric, possible_error := NewMetric(settings.Metric, settings.P, knn.categorical, knn.ranges)
+		if possible_error != nil {
+			return nil, possible_error
+		}
+
+		return knn.neighbors(X_to_predict, settings, metric), nil
+	}
+
+	metrics, possible_error := newPartialMetric(settings.Metric, settings.P, knn.categorical, knn.ranges, present)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	return knn.scan_rows(X_to_predict, settings.K, metrics, kernel{}, false), nil
+}
+
+// This function returns the share of the distance between X_to_predict and the training row
+// at index that comes from each feature, the shares add up to 1. Features that are not present
+// (when present isn't nil) didn't take part in the distance and get no share.
+func (knn *KNN) Contributions(X_to_predict []float64, present []bool, index int, settings Settings) []float64 {
+	terms := feature_terms(settings.Metric, settings.P, knn.X[index], X_to_predict, knn.categorical, knn.ranges)
+
+	for feature := range terms {
+		if present != nil && !present[feature] {
+			terms[feature] = 0
+		}
+	}
+
+	total := 0.0
+	for _, term := range terms {
+		total += term
+	}
+
+	// Identical vectors have nothing to explain
+	if total == 0 {
+		return make([]float64, len(terms))
+	}
+
+	for feature := range terms {
+		terms[feature] /= total
+	}
+
+	return terms
+}
+
+// This function returns the weight of the vote of every neighbor, the neighbors are sorted by distance
+func vote_weights(neighbors []neighbor, settings Settings) []float64 {
+	weights := make([]float64, len(neighbors))
+
+	// Without a bandwidth the gaussian kernel adapts to the distance of the farthest neighbor
+	bandwidth := settings.Bandwidth
+	if bandwidth == 0 {
+		bandwidth = max(neighbors[len(neighbors)-1].distance, distance_epsilon)
+	}
+
+	total := 0.0
+	for index, neighbor := range neighbors {
+		switch settings.Weighting {
+		case WeightDistance:
+			weights[index] = 1 / (neighbor.distance + distance_epsilon)
+		case WeightGaussian:
+			weights[index] = math.Exp(-(neighbor.distance * neighbor.distance) / (2 * bandwidth * bandwidth))
+		case WeightRank:
+			weights[index] = float64(len(neighbors)-index) / float64(len(neighbors))
+		default:
+			weights[index] = 1
+		}
+		total += weights[index]
+	}
+
+	// A narrow kernel can round every weight down to zero, fall back to an equal vote
+	if total == 0 {
+		for index := range weights {
+			weights[index] = 1
+		}
+	}
+
+	return weights
+}
+
+// This function returns the k training rows closest to X_to_predict sorted by distance,
+// with the index when it can handle the metric and by checking every row otherwise
+func (knn *KNN) neighbors(X_to_predict []float64, settings Settings, metric Metric) []neighbor {
+	if knn.index != nil {
+		if found, ok := knn.index.search(X_to_predict, settings.K, settings, metric); ok {
+			return found
+		}
+	}
+
+	return knn.scan(X_to_predict, settings, metric)
+}
+
+// This function returns the class with the highest score and uses the tie break rule
+// when several classes share it
+func (knn *KNN) elect(scores map[int]float64, neighbors []neighbor, tie_break string) int {
+	highest := math.Inf(-1)
+	for _, score := range scores {
+		highest = max(highest, score)
+	}
+
+	var tied []int
+	for class, score := range scores {
+		if score == highest {
+			tied = append(tied, class)
+		}
+	}
+
+	switch {
+	case len(tied) == 1:
+		return tied[0]
+	case tie_break == TiePositive:
+		return slices.Max(tied)
+	case tie_break == TieNegative:
+		return slices.Min(tied)
+	}
+
+	// The class of the closest neighbor among the tied classes wins
+	for _, neighbor := range neighbors {
+		if slices.Contains(tied, knn.y[neighbor.index]) {
+			return knn.y[neighbor.index]
+		}
+	}
+
+	return tied[0]
+}
@@ -0,0 +1,151 @@
+package classifier
+
+import (
+	"math"
+	"testing"
+)
+
+// This function returns a knn on a single feature, the rows 0, 1 and 2 are mostly negative and
+// 10 and 11 positive
+func line_knn() *KNN {
+	return NewKNN([][]float64{{0}, {1}, {2}, {10}, {11}}, []int{0, 0, 1, 1, 1}, []bool{false})
+}
+
+func TestPredict(t *testing.T) {
+	knn := line_knn()
+
+	tests := []struct {
+		name        string
+		query       []float64
+		settings    Settings
+		class       int
+		probability float64
+		votes       map[int]int
+	}{
+		{"majority of the closest", []float64{0.4}, Settings{K: 3, TieBreak: TieNearest}, 0, 1.0 / 3, map[int]int{0: 2, 1: 1}},
+		{"unanimous", []float64{10.5}, Settings{K: 2, TieBreak: TieNearest}, 1, 1, map[int]int{1: 2}},
+		{"every row", []float64{5}, Settings{K: 5, TieBreak: TieNearest}, 1, 0.6, map[int]int{0: 2, 1: 3}},
+		{"tie goes to the nearest", []float64{1.5}, Settings{K: 2, TieBreak: TieNearest}, 0, 0.5, map[int]int{0: 1, 1: 1}},
+		{"tie goes to the positive class", []float64{1.5}, Settings{K: 2, TieBreak: TiePositive}, 1, 0.5, map[int]int{0: 1, 1: 1}},
+		{"tie goes to the negative class", []float64{1.5}, Settings{K: 2, TieBreak: TieNegative}, 0, 0.5, map[int]int{0: 1, 1: 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.settings.Metric = MetricEuclidean
+			test.settings.Weighting = WeightUniform
+
+			prediction, possible_error := knn.Predict(test.query, test.settings)
+			if possible_error != nil {
+				t.Fatal(possible_error)
+			}
+
+			if prediction.Class != test.class || math.Abs(prediction.Probability-test.probability) > 1e-12 {
+				t.Fatalf("class %d with probability %v, expected %d with %v", prediction.Class, prediction.Probability, test.class, test.probability)
+			}
+
+			for class, count := range test.votes {
+				if prediction.Votes[class] != count {
+					t.Fatalf("votes %v, expected %v", prediction.Votes, test.votes)
+				}
+			}
+
+			// The probabilities of the classes add up to 1
+			total := 0.0
+			for _, probability := range prediction.Probabilities {
+				total += probability
+			}
+			if math.Abs(total-1) > 1e-12 {
+				t.Fatalf("probabilities %v add up to %v", prediction.Probabilities, total)
+			}
+		})
+	}
+}
+
+func TestPredictRefuses(t *testing.T) {
+	knn := line_knn()
+
+	tests := []struct {
+		name     string
+		settings Settings
+	}{
+		{"k of zero", Settings{K: 0, Metric: MetricEuclidean, TieBreak: TieNearest, Weighting: WeightUniform}},
+		{"k above the rows", Settings{K: 6, Metric: MetricEuclidean, TieBreak: TieNearest, Weighting: WeightUniform}},
+		{"unknown metric", Settings{K: 3, Metric: "jaccard", TieBreak: TieNearest, Weighting: WeightUniform}},
+		{"unknown tie break", Settings{K: 3, Metric: MetricEuclidean, TieBreak: "random", Weighting: WeightUniform}},
+		{"unknown weighting", Settings{K: 3, Metric: MetricEuclidean, TieBreak: TieNearest, Weighting: "inverse"}},
+		{"negative bandwidth", Settings{K: 3, Metric: MetricEuclidean, TieBreak: TieNearest, Weighting: WeightGaussian, Bandwidth: -1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, possible_error := knn.Predict([]float64{1}, test.settings)
+			if possible_error == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestWeighting(t *testing.T) {
+	knn := line_knn()
+
+	// The neighbors of 0.4 are 0, 1 and 2 at 0.4, 0.6 and 1.6, only the last one is positive
+	gaussian := func(distance float64, bandwidth float64) float64 {
+		return math.Exp(-distance * distance / (2 * bandwidth * bandwidth))
+	}
+
+	tests := []struct {
+		name      string
+		weighting string
+		bandwidth float64
+		weights   []float64
+	}{
+		{"uniform", WeightUniform, 0, []float64{1, 1, 1}},
+		{"distance", WeightDistance, 0, []float64{1 / (0.4 + distance_epsilon), 1 / (0.6 + distance_epsilon), 1 / (1.6 + distance_epsilon)}},
+		{"rank", WeightRank, 0, []float64{1, 2.0 / 3, 1.0 / 3}},
+		{"gaussian adapted to the farthest", WeightGaussian, 0, []float64{gaussian(0.4, 1.6), gaussian(0.6, 1.6), gaussian(1.6, 1.6)}},
+		{"gaussian with a bandwidth", WeightGaussian, 0.5, []float64{gaussian(0.4, 0.5), gaussian(0.6, 0.5), gaussian(1.6, 0.5)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings := Settings{K: 3, Metric: MetricEuclidean, TieBreak: TieNearest, Weighting: test.weighting, Bandwidth: test.bandwidth}
+
+			prediction, possible_error := knn.Predict([]float64{0.4}, settings)
+			if possible_error != nil {
+				t.Fatal(possible_error)
+			}
+
+			total := 0.0
+			for index, neighbor := range prediction.Neighbors {
+				if math.Abs(neighbor.Weight-test.weights[index]) > 1e-9 {
+					t.Fatalf("neighbor %d weighs %v, expected %v", neighbor.Index, neighbor.Weight, test.weights[index])
+				}
+				total += neighbor.Weight
+			}
+
+			// The probability is the share of the weights of the positive votes
+			if probability := test.weights[2] / total; math.Abs(prediction.Probability-probability) > 1e-9 {
+				t.Fatalf("probability %v, expected %v", prediction.Probability, probability)
+			}
+			if prediction.Class != 0 {
+				t.Fatalf("class %d, the negative neighbors are closer", prediction.Class)
+			}
+		})
+	}
+}
+
+// A gaussian kernel too narrow for every neighbor falls back to an equal vote
+func TestWeightingNarrowKernel(t *testing.T) {
+	prediction, possible_error := line_knn().Predict([]float64{5}, Settings{K: 3, Metric: MetricEuclidean, TieBreak: TieNearest, Weighting: WeightGaussian, Bandwidth: 1e-3})
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	for _, neighbor := range prediction.Neighbors {
+		if neighbor.Weight != 1 {
+			t.Fatalf("neighbor %d weighs %v, expected an equal vote", neighbor.Index, neighbor.Weight)
+		}
+	}
+}
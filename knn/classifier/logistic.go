@@ -0,0 +1,103 @@
+package classifier
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// LogisticRegression is a linear baseline: it learns one weight per feature and a bias so that
+// the sigmoid of their sum is the probability of the positive class against every other class.
+// It is fitted by full batch gradient descent with an L2 penalty, which is deterministic.
+type LogisticRegression struct {
+	LearningRate float64   `json:"learning_rate"`
+	Epochs       int       `json:"epochs"`
+	L2           float64   `json:"l2"`
+	Weights      []float64 `json:"weights"`
+	Bias         float64   `json:"bias"`
+	negative     int
+}
+
+// This function creates a logistic regression with parameters that converge on scaled features
+func NewLogisticRegression() *LogisticRegression {
+	return &LogisticRegression{LearningRate: 0.5, Epochs: 2000, L2: 0.001}
+}
+
+func (model *LogisticRegression) Fit(X [][]float64, y []int) error {
+	classes := classes_of(y)
+	if len(classes) != 2 || !slices.Contains(classes, PositiveClass) {
+		return fmt.Errorf("logistic regression needs the positive class %d and one other class, got %v", PositiveClass, classes)
+	}
+
+	model.negative = classes[0]
+	if model.negative == PositiveClass {
+		model.negative = classes[1]
+	}
+
+	features := len(X[0])
+	model.Weights = make([]float64, features)
+	model.Bias = 0
+	gradient := make([]float64, features)
+
+	for epoch := 0; epoch < model.Epochs; epoch++ {
+		clear(gradient)
+		bias_gradient := 0.0
+
+		for row, values := range X {
+			target := 0.0
+			if y[row] == PositiveClass {
+				target = 1
+			}
+
+			difference := model.probability(values) - target
+			for feature, value := range values {
+				gradient[feature] += difference * value
+			}
+			bias_gradient += difference
+		}
+
+		for feature := range model.Weights {
+			model.Weights[feature] -= model.LearningRate * (gradient[feature]/float64(len(X)) + model.L2*model.Weights[feature])
+		}
+		model.Bias -= model.LearningRate * bias_gradient / float64(len(X))
+	}
+
+	return nil
+}
+
+// This function returns the probability of the positive class
+func (model *LogisticRegression) probability(X_to_predict []float64) float64 {
+	return 1 / (1 + math.Exp(-(dot(model.Weights, X_to_predict) + model.Bias)))
+}
+
+func (model *LogisticRegression) Predict(X_to_predict []float64) (int, error) {
+	probabilities, possible_error := model.PredictProba(X_to_predict)
+	if possible_error != nil {
+		return 0, possible_error
+	}
+
+	return most_probable(probabilities), nil
+}
+
+func (model *LogisticRegression) PredictProba(X_to_predict []float64) (map[int]float64, error) {
+	if model.Weights == nil {
+		return nil, fmt.Errorf("logistic regression is not fitted")
+	}
+
+	positive := model.probability(X_to_predict)
+
+	return map[int]float64{PositiveClass: positive, model.negative: 1 - positive}, nil
+}
+
+func (model *LogisticRegression) Describe() Description {
+	return Description{
+		Name: ModelLogistic,
+		Parameters: map[string]any{
+			"learning_rate": model.LearningRate,
+			"epochs":        model.Epochs,
+			"l2":            model.L2,
+			"weights":       model.Weights,
+			"bias":          model.Bias,
+		},
+	}
+}
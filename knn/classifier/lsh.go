@@ -0,0 +1,239 @@
+package classifier
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Defaults of the lsh index, more tables and probes find more true neighbors, more bits make
+// the buckets smaller and the search faster
+const (
+	default_lsh_tables = 8
+	default_lsh_bits   = 10
+	default_lsh_probes = 2
+)
+
+// lsh is an approximate index: every table hashes the rows with the sides of random hyperplanes
+// going through the mean row, rows close to each other tend to share buckets. A query only measures
+// the rows of its buckets (and of the nearby buckets when probing) so it can miss true neighbors.
+type lsh struct {
+	X      [][]float64
+	mean   []float64
+	planes [][][]float64
+	tables []map[uint64][]int
+	probes int
+	marks  sync.Pool
+}
+
+// visited marks the rows a search already measured: a row is marked when it holds the stamp of the
+// search. The marks are reused by the next searches so a search doesn't clear one mark per row.
+type visited struct {
+	stamps []uint32
+	stamp  uint32
+}
+
+// This function starts a new search, every row is unmarked
+func (marks *visited) next() {
+	marks.stamp++
+
+	// After 2^32 searches the stamps come around again, the old ones must go
+	if marks.stamp == 0 {
+		clear(marks.stamps)
+		marks.stamp = 1
+	}
+}
+
+// This function marks the row and tells if it was marked already
+func (marks *visited) visit(row int) bool {
+	if marks.stamps[row] == marks.stamp {
+		return true
+	}
+	marks.stamps[row] = marks.stamp
+
+	return false
+}
+
+// This function hashes every row of X in the tables of the index
+func newLSH(X [][]float64, options IndexOptions) (*lsh, error) {
+	if options.Tables < 1 || options.Bits < 1 || options.Bits > 64 {
+		return nil, fmt.Errorf("lsh needs at least one table and between 1 and 64 bits, got %d tables and %d bits", options.Tables, options.Bits)
+	}
+
+	if options.Probes < 0 || options.Probes > options.Bits {
+		return nil, fmt.Errorf("lsh probes must be between 0 and the number of bits, got %d", options.Probes)
+	}
+
+	features := len(X[0])
+	index := &lsh{
+		X:      X,
+		mean:   make([]float64, features),
+		planes: make([][][]float64, options.Tables),
+		tables: make([]map[uint64][]int, options.Tables),
+		probes: options.Probes,
+	}
+	index.marks.New = func() any { return &visited{stamps: make([]uint32, len(X))} }
+
+	for _, row := range X {
+		for feature, value := range row {
+			index.mean[feature] += value / float64(len(X))
+		}
+	}
+
+	random := rand.New(rand.NewPCG(options.Seed, options.Seed))
+
+	for table := range index.planes {
+		index.planes[table] = make([][]float64, options.Bits)
+		for bit := range index.planes[table] {
+			plane := make([]float64, features)
+			for feature := range plane {
+				plane[feature] = random.NormFloat64()
+			}
+			index.planes[table][bit] = plane
+		}
+
+		index.tables[table] = map[uint64][]int{}
+		for row, values := range X {
+			code, _ := index.hash(table, values)
+			index.tables[table][code] = append(index.tables[table][code], row)
+		}
+	}
+
+	return index, nil
+}
+
+// This function returns the bucket of a vector in the table and how far the vector is from
+// each hyperplane, the closest hyperplanes are the bits worth flipping when probing
+func (index *lsh) hash(table int, vector []float64) (uint64, []float64) {
+	var code uint64
+	margins := make([]float64, len(index.planes[table]))
+
+	for bit, plane := range index.planes[table] {
+		projection := 0.0
+		for feature, value := range vector {
+			projection += (value - index.mean[feature]) * plane[feature]
+		}
+
+		if projection > 0 {
+			code |= 1 << bit
+		}
+		margins[bit] = math.Abs(projection)
+	}
+
+	return code, margins
+}
+
+func (index *lsh) search(query []float64, k int, settings Settings, metric Metric) ([]neighbor, bool) {
+	marks := index.marks.Get().(*visited)
+	defer index.marks.Put(marks)
+	marks.next()
+
+	heap := newTopK(k)
+	candidates := 0
+
+	for table := range index.tables {
+		code, margins := index.hash(table, query)
+
+		// Probe the query bucket and then the buckets across the closest hyperplanes
+		bits := make([]int, len(margins))
+		for bit := range bits {
+			bits[bit] = bit
+		}
+		slices.SortFunc(bits, func(a, b int) int { return cmp.Compare(margins[a], margins[b]) })
+
+		buckets := []uint64{code}
+		for _, bit := range bits[:index.probes] {
+			buckets = append(buckets, code^(1<<bit))
+		}
+
+		for _, bucket := range buckets {
+			for _, row := range index.tables[table][bucket] {
+				if marks.visit(row) {
+					continue
+				}
+				candidates++
+				heap.push(neighbor{index: row, distance: metric(index.X[row], query)})
+			}
+		}
+	}
+
+	// Too few candidates to answer, let the caller scan every row
+	if candidates < k {
+		return nil, false
+	}
+
+	return heap.sorted(), true
+}
+
+// RecallReport compares the neighbors found by an index with the exact ones
+type RecallReport struct {
+	Index       IndexOptions `json:"index"`
+	Queries     int          `json:"queries"`
+	K           int          `json:"k"`
+	Recall      float64      `json:"recall"`
+	ExactNsOp   int64        `json:"exact_ns_per_query"`
+	IndexedNsOp int64        `json:"indexed_ns_per_query"`
+	Speedup     float64      `json:"speedup"`
+	Settings    Settings     `json:"settings"`
+}
+
+// This function measures the share of the exact k nearest neighbors the index of the KNN finds
+// for every query, and how long both searches take
+func (knn *KNN) Recall(queries [][]float64, settings Settings) (*RecallReport, error) {
+	possible_error := settings.Validate(len(knn.X))
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("recall needs at least one query")
+	}
+
+	metric, possible_error := NewMetric(settings.Metric, settings.P, knn.categorical, knn.ranges)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	exact := make([][]neighbor, len(queries))
+	started := time.Now()
+	for position, query := range queries {
+		exact[position] = knn.scan(query, settings, metric)
+	}
+	exact_time := time.Since(started)
+
+	found := make([][]neighbor, len(queries))
+	started = time.Now()
+	for position, query := range queries {
+		found[position] = knn.neighbors(query, settings, metric)
+	}
+	indexed_time := time.Since(started)
+
+	hits := 0
+	for position := range queries {
+		for _, expected := range exact[position] {
+			if slices.ContainsFunc(found[position], func(candidate neighbor) bool { return candidate.index == expected.index }) {
+				hits++
+			}
+		}
+	}
+
+	report := &RecallReport{
+		Index:       knn.index_options,
+		Queries:     len(queries),
+		K:           settings.K,
+		Recall:      float64(hits) / float64(len(queries)*settings.K),
+		ExactNsOp:   exact_time.Nanoseconds() / int64(len(queries)),
+		IndexedNsOp: indexed_time.Nanoseconds() / int64(len(queries)),
+		Settings:    settings,
+	}
+
+	if indexed_time > 0 {
+		report.Speedup = float64(exact_time) / float64(indexed_time)
+	}
+
+	return report, nil
+}
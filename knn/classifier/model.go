@@ -0,0 +1,137 @@
+package classifier
+
+import (
+	"fmt"
+	"slices"
+)
+
+// The supported algorithms
+const (
+	ModelKNN        = "knn"
+	ModelLogistic   = "logistic"
+	ModelNaiveBayes = "naive_bayes"
+	ModelTree       = "tree"
+)
+
+// Model is a classifier that learns from a scaled training set. Predict returns the most likely
+// class and PredictProba the probability of every class seen in training. A fitted model only
+// reads its parameters so it is safe to share between goroutines.
+type Model interface {
+	Fit(X [][]float64, y []int) error
+	Predict(X_to_predict []float64) (int, error)
+	PredictProba(X_to_predict []float64) (map[int]float64, error)
+	Describe() Description
+}
+
+// Description tells what a model is and what it learned, the parameters depend on the algorithm
+type Description struct {
+	Name       string         `json:"name"`
+	Parameters map[string]any `json:"parameters"`
+}
+
+// This function returns the names of the supported algorithms, the single models come first
+// and then the ways to combine them
+func ModelNames() []string {
+	return []string{ModelKNN, ModelLogistic, ModelNaiveBayes, ModelTree, ModelMajorityVote, ModelSoftVote, ModelStacking}
+}
+
+// This function creates an unfitted model of the named algorithm with its default parameters,
+// categorical marks the categorical features and settings are only used by knn
+func NewModel(name string, categorical []bool, settings Settings) (Model, error) {
+	switch name {
+	case ModelKNN:
+		return &knnModel{categorical: categorical, settings: settings}, nil
+	case ModelLogistic:
+		return NewLogisticRegression(), nil
+	case ModelNaiveBayes:
+		return NewNaiveBayes(categorical), nil
+	case ModelTree:
+		return NewDecisionTree(), nil
+	case ModelMajorityVote, ModelSoftVote, ModelStacking:
+		return NewEnsemble(name, categorical, settings), nil
+	default:
+		return nil, fmt.Errorf("unknown model %q", name)
+	}
+}
+
+// knnModel puts a KNN with fixed settings behind the Model interface
+type knnModel struct {
+	categorical []bool
+	settings    Settings
+	knn         *KNN
+}
+
+// This function keeps the training set, a KNN has nothing else to learn
+func (model *knnModel) Fit(X [][]float64, y []int) error {
+	possible_error := model.settings.Validate(len(X))
+	if possible_error != nil {
+		return possible_error
+	}
+
+	model.knn = NewKNN(X, y, model.categorical)
+
+	return nil
+}
+
+func (model *knnModel) Predict(X_to_predict []float64) (int, error) {
+	prediction, possible_error := model.knn.Predict(X_to_predict, model.settings)
+	return prediction.Class, possible_error
+}
+
+func (model *knnModel) PredictProba(X_to_predict []float64) (map[int]float64, error) {
+	prediction, possible_error := model.knn.Predict(X_to_predict, model.settings)
+	return prediction.Probabilities, possible_error
+}
+
+func (model *knnModel) Describe() Description {
+	return Description{
+		Name:       ModelKNN,
+		Parameters: map[string]any{"settings": model.settings, "rows": len(model.knn.X)},
+	}
+}
+
+// This function returns the class and the probabilities predicted by a model in one pass. A knn
+// elects its class with its own weights and tie break rule so it isn't always the most probable one.
+func classify(model Model, X_to_predict []float64) (int, map[int]float64, error) {
+	if knn_model, is_knn := model.(*knnModel); is_knn {
+		prediction, possible_error := knn_model.knn.Predict(X_to_predict, knn_model.settings)
+		return prediction.Class, prediction.Probabilities, possible_error
+	}
+
+	probabilities, possible_error := model.PredictProba(X_to_predict)
+	if possible_error != nil {
+		return 0, nil, possible_error
+	}
+
+	return most_probable(probabilities), probabilities, nil
+}
+
+// This function returns the class with the highest probability, the smallest class wins a tie
+func most_probable(probabilities map[int]float64) int {
+	best, best_probability := 0, -1.0
+
+	for class, probability := range probabilities {
+		if probability > best_probability || (probability == best_probability && class < best) {
+			best, best_probability = class, probability
+		}
+	}
+
+	return best
+}
+
+// This function returns the distinct classes of y in increasing order
+func classes_of(y []int) []int {
+	seen := map[int]bool{}
+	var classes []int
+
+	for _, class := range y {
+		if !seen[class] {
+			seen[class] = true
+			classes = append(classes, class)
+		}
+	}
+
+	slices.Sort(classes)
+
+	return classes
+}
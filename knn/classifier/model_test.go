@@ -0,0 +1,116 @@
+package classifier
+
+import (
+	"knn/data"
+	"math"
+	"testing"
+)
+
+// This function returns heart.csv scaled with min-max and which of its features are categorical
+func scaled_heart(t testing.TB) ([][]float64, []int, []bool) {
+	t.Helper()
+
+	dataset := load_heart(t)
+
+	scaler, possible_error := data.FitScaler(data.ScalerMinMax, dataset.Features)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	return scaler.TransformAll(dataset.Features), dataset.Labels, dataset.Schema.Categorical()
+}
+
+// Every single model learns two groups far apart and tells how sure it is
+func TestModels(t *testing.T) {
+	X := [][]float64{{0, 0}, {0.05, 1}, {0.1, 0}, {0.15, 1}, {0.2, 0}, {0.25, 1}, {0.75, 0}, {0.8, 1}, {0.85, 0}, {0.9, 1}, {0.95, 0}, {1, 1}}
+	y := []int{0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 1, 1}
+	categorical := []bool{false, true}
+
+	tests := []struct {
+		query []float64
+		class int
+	}{
+		{[]float64{0.05, 0}, 0},
+		{[]float64{0.2, 1}, 0},
+		{[]float64{0.8, 0}, 1},
+		{[]float64{0.95, 1}, 1},
+	}
+
+	for _, name := range []string{ModelKNN, ModelLogistic, ModelNaiveBayes, ModelTree} {
+		t.Run(name, func(t *testing.T) {
+			model, possible_error := NewModel(name, categorical, Settings{K: 3, Metric: MetricEuclidean, TieBreak: TieNearest, Weighting: WeightUniform})
+			if possible_error != nil {
+				t.Fatal(possible_error)
+			}
+
+			possible_error = model.Fit(X, y)
+			if possible_error != nil {
+				t.Fatal(possible_error)
+			}
+
+			if description := model.Describe(); description.Name != name {
+				t.Fatalf("described as %s", description.Name)
+			}
+
+			for _, test := range tests {
+				class, possible_error := model.Predict(test.query)
+				if possible_error != nil {
+					t.Fatal(possible_error)
+				}
+
+				probabilities, possible_error := model.PredictProba(test.query)
+				if possible_error != nil {
+					t.Fatal(possible_error)
+				}
+
+				if class != test.class || probabilities[test.class] <= 0.5 {
+					t.Errorf("%v is class %d with probabilities %v, expected %d", test.query, class, probabilities, test.class)
+				}
+				if total := probabilities[0] + probabilities[1]; math.Abs(total-1) > 1e-9 {
+					t.Errorf("probabilities %v add up to %v", probabilities, total)
+				}
+			}
+		})
+	}
+}
+
+// Every model learns heart.csv well beyond the share of the most frequent class
+func TestModelsOnHeart(t *testing.T) {
+	X, y, categorical := scaled_heart(t)
+
+	for _, name := range []string{ModelKNN, ModelLogistic, ModelNaiveBayes, ModelTree} {
+		t.Run(name, func(t *testing.T) {
+			model, possible_error := NewModel(name, categorical, Settings{K: 5, Metric: MetricEuclidean, TieBreak: TieNearest, Weighting: WeightUniform})
+			if possible_error != nil {
+				t.Fatal(possible_error)
+			}
+
+			possible_error = model.Fit(X, y)
+			if possible_error != nil {
+				t.Fatal(possible_error)
+			}
+
+			right := 0
+			for row := range X {
+				class, possible_error := model.Predict(X[row])
+				if possible_error != nil {
+					t.Fatal(possible_error)
+				}
+				if class == y[row] {
+					right++
+				}
+			}
+
+			if accuracy := float64(right) / float64(len(X)); accuracy < 0.75 {
+				t.Fatalf("training accuracy %v", accuracy)
+			}
+		})
+	}
+}
+
+func TestNewModelRefuses(t *testing.T) {
+	_, possible_error := NewModel("svm", nil, Settings{})
+	if possible_error == nil {
+		t.Fatal("expected an error for an unknown model")
+	}
+}
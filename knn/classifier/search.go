@@ -0,0 +1,231 @@
+package classifier
+
+import (
+	"cmp"
+	"fmt"
+	"knn/data"
+	"math/rand/v2"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// The supported search strategies
+const (
+	SearchGrid   = "grid"
+	SearchRandom = "random"
+)
+
+// max_candidates keeps a single search from running for hours, max_grid keeps the
+// space of a random search from filling the memory
+const (
+	max_candidates = 5000
+	max_grid       = 100000
+)
+
+// SearchSpace lists the values tried for every knob, p is only used by the minkowski metric
+type SearchSpace struct {
+	K          []int     `json:"k"`
+	Metrics    []string  `json:"metrics"`
+	P          []float64 `json:"p,omitempty"`
+	Weightings []string  `json:"weightings"`
+	Scalers    []string  `json:"scalers"`
+}
+
+// Candidate is one configuration tried by a search and how it scored
+type Candidate struct {
+	Scaler   string   `json:"scaler"`
+	Settings Settings `json:"settings"`
+	Score    float64  `json:"score"`
+	Metrics  Metrics  `json:"metrics"`
+}
+
+// SearchResult ranks the tried configurations from best to worst
+type SearchResult struct {
+	Strategy   string      `json:"strategy"`
+	Objective  string      `json:"objective"`
+	Folds      int         `json:"folds"`
+	Seed       uint64      `json:"seed"`
+	Space      SearchSpace `json:"space"`
+	Best       Candidate   `json:"best"`
+	Candidates []Candidate `json:"candidates"`
+}
+
+// This function returns the search space used when a request doesn't give one
+func DefaultSearchSpace() SearchSpace {
+	return SearchSpace{
+		K:          []int{1, 3, 5, 7, 9, 11, 15, 21},
+		Metrics:    []string{MetricEuclidean, MetricManhattan, MetricChebyshev, MetricCosine, MetricGower},
+		P:          []float64{3},
+		Weightings: []string{WeightUniform, WeightDistance, WeightGaussian, WeightRank},
+		Scalers:    []string{data.ScalerMinMax, data.ScalerStandard, data.ScalerRobust},
+	}
+}
+
+// This function returns the value of the named metric, it is used to rank configurations
+func (metrics Metrics) Value(name string) (float64, error) {
+	switch name {
+	case "accuracy":
+		return metrics.Accuracy, nil
+	case "precision":
+		return metrics.Precision, nil
+	case "recall":
+		return metrics.Recall, nil
+	case "f1":
+		return metrics.F1, nil
+	case "specificity":
+		return metrics.Specificity, nil
+	case "auc":
+		return metrics.AUC, nil
+	default:
+		return 0, fmt.Errorf("unknown objective %q", name)
+	}
+}
+
+// This function cross validates the configurations of the space and ranks them by the objective.
+// A grid search tries all of them, a random search tries trials of them picked with the seed.
+// Every configuration is evaluated on the same folds so their scores can be compared.
+func Search(dataset *data.Dataset, space SearchSpace, strategy string, trials int, objective string, folds int, seed uint64) (*SearchResult, error) {
+	if _, possible_error := (Metrics{}).Value(objective); possible_error != nil {
+		return nil, possible_error
+	}
+
+	if folds < 2 {
+		return nil, fmt.Errorf("folds must be at least 2, got %d", folds)
+	}
+
+	candidates, possible_error := expand(space, len(dataset.Features)*(folds-1)/folds)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	switch strategy {
+	case SearchGrid:
+	case SearchRandom:
+		if trials < 1 {
+			return nil, fmt.Errorf("random search needs at least one trial, got %d", trials)
+		}
+		random := rand.New(rand.NewPCG(seed, seed))
+		random.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+		candidates = candidates[:min(trials, len(candidates))]
+	default:
+		return nil, fmt.Errorf("unknown search strategy %q", strategy)
+	}
+
+	if len(candidates) > max_candidates {
+		return nil, fmt.Errorf("search has %d configurations, the limit is %d", len(candidates), max_candidates)
+	}
+
+	// Evaluate the configurations in parallel, each one only reads the dataset
+	failures := make([]error, len(candidates))
+	jobs := make(chan int)
+
+	var wait_group sync.WaitGroup
+	for worker := 0; worker < runtime.NumCPU(); worker++ {
+		wait_group.Add(1)
+		go func() {
+			defer wait_group.Done()
+
+			for index := range jobs {
+				candidate := &candidates[index]
+
+				evaluation, possible_error := CrossValidate(dataset, ModelKNN, candidate.Scaler, candidate.Settings, folds, seed)
+				if possible_error != nil {
+					failures[index] = possible_error
+					continue
+				}
+
+				candidate.Metrics = evaluation.Metrics
+				candidate.Score, _ = evaluation.Metrics.Value(objective)
+			}
+		}()
+	}
+
+	for index := range candidates {
+		jobs <- index
+	}
+	close(jobs)
+	wait_group.Wait()
+
+	for _, possible_error := range failures {
+		if possible_error != nil {
+			return nil, possible_error
+		}
+	}
+
+	// Best score first, then best accuracy, then the smallest k as the simplest model
+	slices.SortStableFunc(candidates, func(a, b Candidate) int {
+		return cmp.Or(
+			cmp.Compare(b.Score, a.Score),
+			cmp.Compare(b.Metrics.Accuracy, a.Metrics.Accuracy),
+			cmp.Compare(a.Settings.K, b.Settings.K),
+		)
+	})
+
+	result := &SearchResult{
+		Strategy:   strategy,
+		Objective:  objective,
+		Folds:      folds,
+		Seed:       seed,
+		Space:      space,
+		Best:       candidates[0],
+		Candidates: candidates,
+	}
+
+	return result, nil
+}
+
+// This function lists every configuration of the space and checks they are all valid
+// for a training set of the given size
+func expand(space SearchSpace, rows int) ([]Candidate, error) {
+	if len(space.K) == 0 || len(space.Metrics) == 0 || len(space.Weightings) == 0 || len(space.Scalers) == 0 {
+		return nil, fmt.Errorf("search space needs at least one k, metric, weighting and scaler")
+	}
+
+	p_values := space.P
+	if len(p_values) == 0 {
+		p_values = []float64{2}
+	}
+
+	// The size is multiplied one knob at a time so a huge space stops before it overflows
+	size := 1
+	for _, values := range []int{len(space.K), len(space.Metrics), len(p_values), len(space.Weightings), len(space.Scalers)} {
+		size *= values
+		if size > max_grid {
+			return nil, fmt.Errorf("search space has more than %d configurations", max_grid)
+		}
+	}
+
+	var candidates []Candidate
+
+	for _, scaler := range space.Scalers {
+		if !data.ValidScalerMethod(scaler) {
+			return nil, fmt.Errorf("unknown scaler method %q", scaler)
+		}
+
+		for _, metric := range space.Metrics {
+			// Only minkowski is expanded over p
+			metric_p := []float64{0}
+			if metric == MetricMinkowski {
+				metric_p = p_values
+			}
+
+			for _, p := range metric_p {
+				for _, weighting := range space.Weightings {
+					for _, k := range space.K {
+						settings := Settings{K: k, Metric: metric, P: p, TieBreak: TieNearest, Weighting: weighting}
+
+						possible_error := settings.Validate(rows)
+						if possible_error != nil {
+							return nil, possible_error
+						}
+
+						candidates = append(candidates, Candidate{Scaler: scaler, Settings: settings})
+					}
+				}
+			}
+		}
+	}
+
+	return candidates, nil
+}
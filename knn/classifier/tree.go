@@ -0,0 +1,221 @@
+package classifier
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// DecisionTree is a CART classifier: every node splits its rows on the feature and threshold that
+// lower the gini impurity the most, until MaxDepth is reached or a split would leave fewer than
+// MinLeaf rows on one side. A leaf predicts the class shares of its training rows.
+type DecisionTree struct {
+	MaxDepth int `json:"max_depth"`
+	MinLeaf  int `json:"min_leaf"`
+	nodes    []cart_node
+	classes  []int
+	features int
+}
+
+// cart_node is a split when left is set, rows with the feature not above the threshold go left.
+// A leaf holds the probability of every class.
+type cart_node struct {
+	feature       int
+	threshold     float64
+	left, right   int
+	probabilities map[int]float64
+	decrease      float64
+}
+
+// This function creates a decision tree shallow enough to be read by a clinician
+func NewDecisionTree() *DecisionTree {
+	return &DecisionTree{MaxDepth: 5, MinLeaf: 5}
+}
+
+func (model *DecisionTree) Fit(X [][]float64, y []int) error {
+	model.nodes = nil
+	model.classes = classes_of(y)
+	model.features = len(X[0])
+
+	model.build(X, y, all_rows(len(X)), 0)
+
+	return nil
+}
+
+// This function builds the node of the rows and returns its position
+func (model *DecisionTree) build(X [][]float64, y []int, rows []int, depth int) int {
+	position := len(model.nodes)
+	model.nodes = append(model.nodes, cart_node{left: -1, right: -1, probabilities: model.shares(y, rows)})
+
+	if depth >= model.MaxDepth || len(rows) < 2*model.MinLeaf {
+		return position
+	}
+
+	feature, threshold, decrease, found := model.best_split(X, y, rows)
+	if !found {
+		return position
+	}
+
+	var left_rows, right_rows []int
+	for _, row := range rows {
+		if X[row][feature] <= threshold {
+			left_rows = append(left_rows, row)
+		} else {
+			right_rows = append(right_rows, row)
+		}
+	}
+
+	model.nodes[position].feature = feature
+	model.nodes[position].threshold = threshold
+	model.nodes[position].decrease = decrease
+
+	left := model.build(X, y, left_rows, depth+1)
+	right := model.build(X, y, right_rows, depth+1)
+	model.nodes[position].left = left
+	model.nodes[position].right = right
+
+	return position
+}
+
+// This function returns the share of every class among the rows
+func (model *DecisionTree) shares(y []int, rows []int) map[int]float64 {
+	probabilities := map[int]float64{}
+	for _, class := range model.classes {
+		probabilities[class] = 0
+	}
+
+	for _, row := range rows {
+		probabilities[y[row]] += 1 / float64(len(rows))
+	}
+
+	return probabilities
+}
+
+// This function finds the split of the rows with the largest decrease of gini impurity weighted
+// by the number of rows, found is false when no split improves the node
+func (model *DecisionTree) best_split(X [][]float64, y []int, rows []int) (int, float64, float64, bool) {
+	class_position := map[int]int{}
+	for position, class := range model.classes {
+		class_position[class] = position
+	}
+
+	total := make([]float64, len(model.classes))
+	for _, row := range rows {
+		total[class_position[y[row]]]++
+	}
+	parent := gini(total, float64(len(rows))) * float64(len(rows))
+
+	best_feature, best_threshold, best_decrease := -1, 0.0, 0.0
+	sorted := slices.Clone(rows)
+	left := make([]float64, len(model.classes))
+	right := make([]float64, len(model.classes))
+
+	for feature := 0; feature < model.features; feature++ {
+		slices.SortFunc(sorted, func(a, b int) int { return cmp.Compare(X[a][feature], X[b][feature]) })
+
+		clear(left)
+		copy(right, total)
+
+		// Move the rows to the left side one at a time, a threshold sits between two different values
+		for index := 0; index < len(sorted)-1; index++ {
+			class := class_position[y[sorted[index]]]
+			left[class]++
+			right[class]--
+
+			left_size, right_size := float64(index+1), float64(len(sorted)-index-1)
+			current, next := X[sorted[index]][feature], X[sorted[index+1]][feature]
+
+			if current == next || int(left_size) < model.MinLeaf || int(right_size) < model.MinLeaf {
+				continue
+			}
+
+			decrease := parent - gini(left, left_size)*left_size - gini(right, right_size)*right_size
+			if decrease > best_decrease+1e-12 {
+				best_feature, best_threshold, best_decrease = feature, (current+next)/2, decrease
+			}
+		}
+	}
+
+	return best_feature, best_threshold, best_decrease, best_feature >= 0
+}
+
+// This function returns the gini impurity of class counts
+func gini(counts []float64, size float64) float64 {
+	impurity := 1.0
+
+	for _, count := range counts {
+		impurity -= (count / size) * (count / size)
+	}
+
+	return impurity
+}
+
+func (model *DecisionTree) Predict(X_to_predict []float64) (int, error) {
+	probabilities, possible_error := model.PredictProba(X_to_predict)
+	if possible_error != nil {
+		return 0, possible_error
+	}
+
+	return most_probable(probabilities), nil
+}
+
+func (model *DecisionTree) PredictProba(X_to_predict []float64) (map[int]float64, error) {
+	if model.nodes == nil {
+		return nil, fmt.Errorf("decision tree is not fitted")
+	}
+
+	node := &model.nodes[0]
+	for node.left >= 0 {
+		if X_to_predict[node.feature] <= node.threshold {
+			node = &model.nodes[node.left]
+		} else {
+			node = &model.nodes[node.right]
+		}
+	}
+
+	// The leaf is shared by every prediction, hand out a copy
+	return maps.Clone(node.probabilities), nil
+}
+
+// This function describes the tree with the share of the impurity decrease owed to every feature
+func (model *DecisionTree) Describe() Description {
+	importances := make([]float64, model.features)
+	total, leaves, depth := 0.0, 0, 0
+
+	var walk func(position int, level int)
+	walk = func(position int, level int) {
+		node := model.nodes[position]
+		depth = max(depth, level)
+
+		if node.left < 0 {
+			leaves++
+			return
+		}
+
+		importances[node.feature] += node.decrease
+		total += node.decrease
+		walk(node.left, level+1)
+		walk(node.right, level+1)
+	}
+	if model.nodes != nil {
+		walk(0, 0)
+	}
+
+	for feature := range importances {
+		if total > 0 {
+			importances[feature] /= total
+		}
+	}
+
+	return Description{
+		Name: ModelTree,
+		Parameters: map[string]any{
+			"max_depth":   model.MaxDepth,
+			"min_leaf":    model.MinLeaf,
+			"depth":       depth,
+			"leaves":      leaves,
+			"importances": importances,
+		},
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"knn/classifier"
+	"net/http"
+)
+
+// modelsResponse lists the algorithms of the live model, the learned parameters indexed by feature
+// (weights, importances...) follow the order of features
+type modelsResponse struct {
+	Default  string                   `json:"default"`
+	Features []string                 `json:"features"`
+	Models   []classifier.Description `json:"models"`
+}
+
+// This function describes every algorithm the requests can choose with options.model
+func (app *Config) Models(write http.ResponseWriter, read *http.Request) {
+	model := app.Model()
+
+	response := modelsResponse{Default: model.Algorithm, Features: model.Encoder.Names}
+
+	for _, name := range classifier.ModelNames() {
+		if name == classifier.ModelKNN {
+			response.Models = append(response.Models, classifier.Description{
+				Name:       name,
+				Parameters: map[string]any{"settings": model.Defaults, "index": model.KNN.Index(), "rows": len(model.X_scaled)},
+			})
+			continue
+		}
+
+		response.Models = append(response.Models, model.Classifiers[name].Describe())
+	}
+
+	pay_load := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d models available, %s answers by default", len(response.Models), model.Algorithm),
+		Data:    response,
+	}
+
+	app.writeJSON(write, http.StatusOK, pay_load)
+}
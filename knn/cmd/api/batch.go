@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"knn/data"
+	"log"
+	"mime"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const max_batch_bytes = 10 << 20 // ten megabytes
+
+// Every row of a batch is predicted and kept for feedback, a batch can't hold more patients than this
+const max_batch_rows = 10000
+
+// batchRow is one patient of a batch, Error is set when the row couldn't be read
+type batchRow struct {
+	Row     int
+	Payload requestsPayload
+	Error   string
+}
+
+// batchResult is the outcome of one patient of a batch
+type batchResult struct {
+	Row        int                 `json:"row"`
+	Prediction *predictionResponse `json:"prediction,omitempty"`
+	Error      string              `json:"error,omitempty"`
+	Fields     []data.FieldError   `json:"fields,omitempty"`
+}
+
+// This function scores many patients at once, the body is either a json array of knn payloads
+// or a csv file (raw or uploaded as "file") with the same columns as heart.csv.
+// The results are returned as json, or as csv with ?format=csv
+func (app *Config) KNNBatch(write http.ResponseWriter, read *http.Request) {
+	model := app.Model()
+
+	rows, possible_error := readBatch(write, read, model.Dataset.Schema)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	if len(rows) > max_batch_rows {
+		app.errorJSON(write, fmt.Errorf("batch has %d patients, at most %d are accepted", len(rows), max_batch_rows), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	results := model.predictBatch(rows)
+
+	var payloads []requestsPayload
+	var predictions []*predictionResponse
+	for index, result := range results {
+		if result.Prediction != nil {
+			payloads = append(payloads, rows[index].Payload)
+			predictions = append(predictions, result.Prediction)
+		}
+	}
+	app.record(payloads, predictions)
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+
+	// The status of the csv is sent before its lines, a failure past that point can only be logged
+	if read.URL.Query().Get("format") == "csv" {
+		possible_error = writeBatchCSV(write, results)
+		if possible_error != nil {
+			log.Printf("Can't write the csv results of %d patients: %v", len(results), possible_error)
+		}
+		return
+	}
+
+	pay_load := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Scored %d patients, %d failed", len(results)-failed, failed),
+		Data:    results,
+	}
+
+	app.writeJSON(write, http.StatusAccepted, pay_load)
+}
+
+// This function scores every row of the batch in parallel, the results keep the order of the rows
+func (model *Model) predictBatch(rows []batchRow) []batchResult {
+	results := make([]batchResult, len(rows))
+	jobs := make(chan int)
+
+	var wait_group sync.WaitGroup
+	for worker := 0; worker < runtime.NumCPU(); worker++ {
+		wait_group.Add(1)
+		go func() {
+			defer wait_group.Done()
+
+			for index := range jobs {
+				row := rows[index]
+				results[index].Row = row.Row
+
+				if row.Error != "" {
+					results[index].Error = row.Error
+					continue
+				}
+
+				prediction, possible_error := model.predict(row.Payload)
+				if possible_error != nil {
+					results[index].Error = possible_error.Error()
+
+					var validation_error *data.ValidationError
+					if errors.As(possible_error, &validation_error) {
+						results[index].Fields = validation_error.Fields
+					}
+					continue
+				}
+				results[index].Prediction = &prediction
+			}
+		}()
+	}
+
+	for index := range rows {
+		jobs <- index
+	}
+	close(jobs)
+	wait_group.Wait()
+
+	return results
+}
+
+// This function reads the patients of a batch request from json or csv depending on its content type
+func readBatch(write http.ResponseWriter, read *http.Request, schema *data.Schema) ([]batchRow, error) {
+	read.Body = http.MaxBytesReader(write, read.Body, max_batch_bytes)
+
+	media_type, _, _ := mime.ParseMediaType(read.Header.Get("Content-Type"))
+
+	switch media_type {
+	case "multipart/form-data":
+		file, _, possible_error := read.FormFile("file")
+		if possible_error != nil {
+			return nil, fmt.Errorf("can't read uploaded file: %w", possible_error)
+		}
+		defer file.Close()
+
+		return readBatchCSV(file, schema)
+	case "text/csv":
+		return readBatchCSV(read.Body, schema)
+	}
+
+	var payloads []requestsPayload
+
+	decoded_data := json.NewDecoder(read.Body)
+	possible_error := decoded_data.Decode(&payloads)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	possible_error = decoded_data.Decode(&struct{}{})
+	if possible_error != io.EOF {
+		return nil, errors.New("body must have only a single JSON value")
+	}
+
+	// The json rows are numbered by their position in the array, starting at 1
+	rows := make([]batchRow, len(payloads))
+	for index, payload := range payloads {
+		rows[index] = batchRow{Row: index + 1, Payload: payload}
+	}
+
+	return rows, nil
+}
+
+// This function reads the patients of a csv file, the rows are numbered like in a spreadsheet
+func readBatchCSV(input io.Reader, schema *data.Schema) ([]batchRow, error) {
+	records, possible_error := data.ReadRecords(input, schema)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	rows := make([]batchRow, len(records))
+	for index, record := range records {
+		rows[index] = batchRow{Row: record.Row, Payload: requestsPayload{Features: record.Values}}
+
+		if len(record.Errors) > 0 {
+			var messages []string
+			for _, cell_error := range record.Errors {
+				messages = append(messages, fmt.Sprintf("column %s value %q %s", cell_error.Column, cell_error.Value, cell_error.Reason))
+			}
+			rows[index].Error = strings.Join(messages, "; ")
+		}
+	}
+
+	return rows, nil
+}
+
+// This function writes the batch results as a csv file with one line per patient
+func writeBatchCSV(write http.ResponseWriter, results []batchResult) error {
+	write.Header().Set("Content-Type", "text/csv")
+	write.WriteHeader(http.StatusAccepted)
+
+	writer := csv.NewWriter(write)
+	writer.Write([]string{"row", "prediction_id", "class", "label", "probability", "model_version", "error"})
+
+	for _, result := range results {
+		line := []string{strconv.Itoa(result.Row), "", "", "", "", "", result.Error}
+
+		if result.Prediction != nil {
+			line[1] = result.Prediction.PredictionID
+			line[2] = strconv.Itoa(result.Prediction.Class)
+			line[3] = result.Prediction.Label
+			line[4] = strconv.FormatFloat(result.Prediction.Probability, 'f', 4, 64)
+			line[5] = result.Prediction.ModelVersion
+		}
+
+		writer.Write(line)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
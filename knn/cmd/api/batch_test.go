@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Two patients of heart.csv and a third one with an invalid chest pain
+const batch_csv = `age,sex,cp,trtbps,chol,fbs,restecg,thalachh,exng,oldpeak,slp,caa,thall
+63,1,3,145,233,1,0,150,0,2.3,0,0,1
+67,1,0,160,286,0,0,108,1,1.5,1,3,2
+57,0,9,120,354,0,1,163,1,0.6,2,0,2
+`
+
+func TestKNNBatch(t *testing.T) {
+	app := new_test_app(t)
+
+	form := &bytes.Buffer{}
+	writer := multipart.NewWriter(form)
+	file, _ := writer.CreateFormFile("file", "patients.csv")
+	file.Write([]byte(batch_csv))
+	writer.Close()
+
+	csv_request := httptest.NewRequest(http.MethodPost, "/knn/batch", strings.NewReader(batch_csv))
+	csv_request.Header.Set("Content-Type", "text/csv")
+
+	form_request := httptest.NewRequest(http.MethodPost, "/knn/batch", form)
+	form_request.Header.Set("Content-Type", writer.FormDataContentType())
+
+	json_patients := []any{patient(nil), patient(map[string]any{"age": 67, "chest_pain": 0}), patient(map[string]any{"chest_pain": 9})}
+
+	tests := []struct {
+		name    string
+		request *http.Request
+		field   string
+	}{
+		{"json", json_request(t, http.MethodPost, "/knn/batch", json_patients), "chest_pain"},
+		{"csv", csv_request, ""},
+		{"multipart", form_request, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var results []batchResult
+			decode(t, serve(app, test.request), http.StatusAccepted, &results)
+
+			if len(results) != 3 {
+				t.Fatalf("%d results, expected 3", len(results))
+			}
+
+			for index, result := range results[:2] {
+				if result.Prediction == nil || result.Error != "" || result.Prediction.PredictionID == "" {
+					t.Errorf("row %d: %+v, expected a prediction", result.Row, result)
+				}
+				if result.Row != index+1 && result.Row != index+2 {
+					t.Errorf("row %d reported for patient %d", result.Row, index+1)
+				}
+			}
+
+			failed := results[2]
+			if failed.Prediction != nil || !strings.Contains(failed.Error, "chest_pain") && !strings.Contains(failed.Error, "cp") {
+				t.Fatalf("%+v, expected the invalid chest pain", failed)
+			}
+			if test.field != "" && (len(failed.Fields) != 1 || failed.Fields[0].Field != test.field) {
+				t.Fatalf("fields %+v, expected %s", failed.Fields, test.field)
+			}
+		})
+	}
+}
+
+func TestKNNBatchCSV(t *testing.T) {
+	app := new_test_app(t)
+
+	request := httptest.NewRequest(http.MethodPost, "/knn/batch?format=csv", strings.NewReader(batch_csv))
+	request.Header.Set("Content-Type", "text/csv")
+
+	recorder := serve(app, request)
+	if recorder.Code != http.StatusAccepted || recorder.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("status %d with %s", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+
+	lines, possible_error := csv.NewReader(recorder.Body).ReadAll()
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	if len(lines) != 4 || lines[0][0] != "row" || lines[1][3] != "Heart disease" || lines[3][2] != "" || lines[3][6] == "" {
+		t.Fatalf("csv %v, expected a header, two predictions and an error", lines)
+	}
+}
+
+func TestKNNBatchRefuses(t *testing.T) {
+	app := new_test_app(t)
+
+	too_many := make([]map[string]any, max_batch_rows+1)
+	for index := range too_many {
+		too_many[index] = map[string]any{}
+	}
+
+	decode(t, serve(app, json_request(t, http.MethodPost, "/knn/batch", "{}")), http.StatusBadRequest, nil)
+	decode(t, serve(app, json_request(t, http.MethodPost, "/knn/batch", too_many)), http.StatusRequestEntityTooLarge, nil)
+}
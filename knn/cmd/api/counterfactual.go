@@ -0,0 +1,255 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"knn/classifier"
+	"knn/data"
+	"math"
+	"math/bits"
+	"net/http"
+	"slices"
+)
+
+const (
+	default_counterfactuals = 5
+	max_counterfactuals     = 20
+)
+
+// featureChange is a field a counterfactual changes, from the patient value to the suggested one
+type featureChange struct {
+	Field string  `json:"field"`
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+}
+
+// counterfactual is the patient with a few modifiable fields changed so the knn verdict flips,
+// Cost adds up how far every change goes as a share of its modifiable range
+type counterfactual struct {
+	Features    map[string]float64 `json:"features"`
+	Changes     []featureChange    `json:"changes"`
+	Cost        float64            `json:"cost"`
+	Class       int                `json:"class"`
+	Label       string             `json:"label"`
+	Probability float64            `json:"probability"`
+}
+
+// counterfactualResponse is the verdict of the patient by the model version and the changes that
+// would flip it, the fewest changed fields first and then the smallest changes. Fixed fields are
+// never changed.
+type counterfactualResponse struct {
+	ModelVersion    string                `json:"model_version"`
+	Prediction      classifier.Prediction `json:"prediction"`
+	Modifiable      []string              `json:"modifiable"`
+	Fixed           []string              `json:"fixed"`
+	Counterfactuals []counterfactual      `json:"counterfactuals"`
+}
+
+// This function searches the smallest healthy changes of the modifiable fields (lower cholesterol,
+// blood pressure and fasting blood sugar, higher max heart rate) that would turn a heart disease verdict of the knn into no heart
+// disease, the other fields like age and sex are kept as given. The body is a knn payload and
+// ?limit= caps the number of suggestions, for example /knn/counterfactuals?limit=3
+func (app *Config) Counterfactuals(write http.ResponseWriter, read *http.Request) {
+	limit, possible_error := queryInteger(read.URL.Query(), "limit", default_counterfactuals)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	if limit < 1 || limit > max_counterfactuals {
+		app.errorJSON(write, fmt.Errorf("limit must be between 1 and %d", max_counterfactuals), http.StatusBadRequest)
+		return
+	}
+
+	var requests_payload requestsPayload
+
+	possible_error = app.readJSON(write, read, &requests_payload)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	response, possible_error := app.Model().counterfactuals(requests_payload, limit)
+	var validation_error *data.ValidationError
+	if errors.As(possible_error, &validation_error) {
+		app.validationJSON(write, validation_error)
+		return
+	}
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	message := fmt.Sprintf("The result is: No, risk of heart disease %.0f%%, there is nothing to change", response.Prediction.Probability*100)
+	if response.Prediction.Class == classifier.PositiveClass {
+		message = fmt.Sprintf("The result is: Yes, risk of heart disease %.0f%%, found %d ways to change it", response.Prediction.Probability*100, len(response.Counterfactuals))
+	}
+
+	pay_load := jsonResponse{
+		Error:   false,
+		Message: message,
+		Data:    response,
+	}
+
+	app.writeJSON(write, http.StatusAccepted, pay_load)
+}
+
+// This function predicts the patient of the payload with the knn and, when the verdict is heart
+// disease, searches up to limit counterfactuals. Every error is caused by the payload.
+func (model *Model) counterfactuals(requests_payload requestsPayload, limit int) (counterfactualResponse, error) {
+	if requests_payload.Options.Model != "" && requests_payload.Options.Model != classifier.ModelKNN {
+		return counterfactualResponse{}, fmt.Errorf("counterfactuals are searched with the %s model only", classifier.ModelKNN)
+	}
+
+	// A counterfactual of guessed values would mislead, every field must be given
+	X_to_predict, possible_error := model.Dataset.Schema.Vector(requests_payload.Features)
+	if possible_error != nil || len(requests_payload.Invalid) > 0 {
+		return counterfactualResponse{}, merge_invalid(requests_payload.Invalid, possible_error)
+	}
+
+	settings := requests_payload.Options.Settings.Resolve(model.Defaults)
+
+	prediction, possible_error := model.KNN.Predict(model.scale(X_to_predict), settings)
+	if possible_error != nil {
+		return counterfactualResponse{}, possible_error
+	}
+
+	label_column := model.Dataset.Schema.LabelColumn()
+	prediction.Label = label_column.LabelOf(float64(prediction.Class))
+
+	response := counterfactualResponse{ModelVersion: model.Artifact.Version, Prediction: prediction, Counterfactuals: []counterfactual{}}
+
+	features := model.Dataset.Schema.Features()
+	var modifiable []int
+
+	for feature, column := range features {
+		if column.Modifiable != nil {
+			modifiable = append(modifiable, feature)
+			response.Modifiable = append(response.Modifiable, column.Field)
+		} else {
+			response.Fixed = append(response.Fixed, column.Field)
+		}
+	}
+
+	if prediction.Class != classifier.PositiveClass {
+		return response, nil
+	}
+
+	// Try every set of modifiable fields, the smaller sets first, and stop once a size gives enough
+	// suggestions since any larger set changes more of the patient
+	for size := 1; size <= len(modifiable) && len(response.Counterfactuals) < limit; size++ {
+		var found []counterfactual
+
+		for set := uint64(1); set < 1<<len(modifiable); set++ {
+			if bits.OnesCount64(set) != size {
+				continue
+			}
+
+			var changed []int
+			for position, feature := range modifiable {
+				if set&(1<<position) != 0 {
+					changed = append(changed, feature)
+				}
+			}
+
+			flipped, possible_error := model.flip(X_to_predict, changed, settings)
+			if possible_error != nil {
+				return counterfactualResponse{}, possible_error
+			}
+			found = append(found, flipped...)
+		}
+
+		slices.SortStableFunc(found, func(a, b counterfactual) int { return cmp.Compare(a.Cost, b.Cost) })
+
+		for _, candidate := range found {
+			if len(response.Counterfactuals) == limit {
+				break
+			}
+
+			dominated := slices.ContainsFunc(response.Counterfactuals, func(kept counterfactual) bool { return dominates(kept, candidate) })
+			if !dominated {
+				response.Counterfactuals = append(response.Counterfactuals, candidate)
+			}
+		}
+	}
+
+	return response, nil
+}
+
+// This function tries every combination of candidate values of the changed features, each one moved
+// from the patient's value in its healthy direction, and returns the combinations the knn doesn't see as heart disease
+func (model *Model) flip(X_to_predict []float64, changed []int, settings classifier.Settings) ([]counterfactual, error) {
+	features := model.Dataset.Schema.Features()
+	label_column := model.Dataset.Schema.LabelColumn()
+	candidate := slices.Clone(X_to_predict)
+
+	var flipped []counterfactual
+
+	var walk func(position int) error
+	walk = func(position int) error {
+		if position == len(changed) {
+			prediction, possible_error := model.KNN.Predict(model.scale(candidate), settings)
+			if possible_error != nil {
+				return possible_error
+			}
+
+			if prediction.Class == classifier.PositiveClass {
+				return nil
+			}
+
+			result := counterfactual{
+				Features:    map[string]float64{},
+				Class:       prediction.Class,
+				Label:       label_column.LabelOf(float64(prediction.Class)),
+				Probability: prediction.Probability,
+			}
+
+			for feature, column := range features {
+				result.Features[column.Field] = candidate[feature]
+			}
+
+			for _, feature := range changed {
+				column := features[feature]
+				result.Changes = append(result.Changes, featureChange{Field: column.Field, From: X_to_predict[feature], To: candidate[feature]})
+				result.Cost += column.ChangeCost(X_to_predict[feature], candidate[feature])
+			}
+
+			flipped = append(flipped, result)
+			return nil
+		}
+
+		feature := changed[position]
+		for _, value := range features[feature].Candidates(X_to_predict[feature]) {
+			candidate[feature] = value
+			possible_error := walk(position + 1)
+			if possible_error != nil {
+				return possible_error
+			}
+		}
+		candidate[feature] = X_to_predict[feature]
+
+		return nil
+	}
+
+	return flipped, walk(0)
+}
+
+// This function tells if a kept counterfactual makes a candidate pointless: it changes only fields the
+// candidate changes too, in the same direction and no further
+func dominates(kept counterfactual, candidate counterfactual) bool {
+	for _, change := range kept.Changes {
+		index := slices.IndexFunc(candidate.Changes, func(other featureChange) bool { return other.Field == change.Field })
+		if index < 0 {
+			return false
+		}
+
+		other := candidate.Changes[index]
+		same_direction := (change.To > change.From) == (other.To > other.From)
+		if !same_direction || math.Abs(change.To-change.From) > math.Abs(other.To-other.From) {
+			return false
+		}
+	}
+
+	return true
+}
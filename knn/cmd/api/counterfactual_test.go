@@ -0,0 +1,70 @@
+package main
+
+import (
+	"knn/classifier"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestCounterfactuals(t *testing.T) {
+	app := new_test_app(t)
+
+	// A patient of heart.csv whose cholestoral is far above the usual
+	at_risk := patient(map[string]any{
+		"age": 67, "gender": 0, "chest_pain": 2, "resting_blood_pressure": 115, "cholestoral_in_mg": 564,
+		"fasting_blood_sugar": 0, "maximum_heart_rate_achieved": 160, "previous_peak": 1.6,
+		"slope_of_the_peak_exercise": 1, "thalassemia": 3,
+	})
+
+	var response counterfactualResponse
+	decode(t, serve(app, json_request(t, http.MethodPost, "/knn/counterfactuals?limit=3", at_risk)), http.StatusAccepted, &response)
+
+	if response.Prediction.Class != classifier.PositiveClass || len(response.Counterfactuals) == 0 || len(response.Counterfactuals) > 3 {
+		t.Fatalf("class %d with %d counterfactuals, expected at most 3 for the heart disease", response.Prediction.Class, len(response.Counterfactuals))
+	}
+
+	for index, found := range response.Counterfactuals {
+		if found.Class == response.Prediction.Class || len(found.Changes) == 0 {
+			t.Errorf("counterfactual %d keeps class %d with changes %+v", index, found.Class, found.Changes)
+		}
+
+		// Only the features a patient can act on change
+		for _, change := range found.Changes {
+			if !slices.Contains(response.Modifiable, change.Field) || change.From == change.To {
+				t.Errorf("counterfactual %d changes %+v", index, change)
+			}
+		}
+
+		if index > 0 && found.Cost < response.Counterfactuals[index-1].Cost {
+			t.Errorf("counterfactual %d costs %v, less than the one before", index, found.Cost)
+		}
+	}
+
+	if slices.Contains(response.Modifiable, "age") || !slices.Contains(response.Fixed, "age") {
+		t.Fatalf("age is modifiable %v", response.Modifiable)
+	}
+}
+
+func TestCounterfactualsRefuses(t *testing.T) {
+	app := new_test_app(t)
+
+	tests := []struct {
+		name   string
+		path   string
+		body   any
+		status int
+	}{
+		{"no limit", "/knn/counterfactuals?limit=0", patient(nil), http.StatusBadRequest},
+		{"fractional limit", "/knn/counterfactuals?limit=2.5", patient(nil), http.StatusBadRequest},
+		{"limit too large", "/knn/counterfactuals?limit=21", patient(nil), http.StatusBadRequest},
+		{"other model", "/knn/counterfactuals", patient(map[string]any{"options": map[string]any{"model": classifier.ModelTree}}), http.StatusBadRequest},
+		{"missing field", "/knn/counterfactuals", patient(map[string]any{"age": nil}), http.StatusUnprocessableEntity},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decode(t, serve(app, json_request(t, http.MethodPost, test.path, test.body)), test.status, nil)
+		})
+	}
+}
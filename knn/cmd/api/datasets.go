@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"knn/artifact"
+	"knn/data"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const max_dataset_bytes = 50 << 20 // fifty megabytes
+
+// The header naming the admin behind a request, it is recorded with every switch
+const admin_user_header = "X-Admin-User"
+
+// adminKey keys the name of the admin in the context of a request that went through requireAdmin
+type adminKey struct{}
+
+// datasetVersion is a version of the store and whether it is the one answering the requests
+type datasetVersion struct {
+	artifact.Version
+	Active bool `json:"active"`
+}
+
+// datasetUpload is the version created by an upload and the switch to it when it was activated
+type datasetUpload struct {
+	Version artifact.Version `json:"version"`
+	Switch  *artifact.Switch `json:"switch,omitempty"`
+}
+
+// This function lets only the admins through: they send the KNN_ADMIN_TOKEN as a bearer token and
+// say who they are in the X-Admin-User header, the name is kept in the request context. Without a
+// token the admin endpoints are disabled.
+func (app *Config) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(write http.ResponseWriter, read *http.Request) {
+		if app.admin_token == "" {
+			app.errorJSON(write, errors.New("admin endpoints are disabled, set KNN_ADMIN_TOKEN to enable them"), http.StatusForbidden)
+			return
+		}
+
+		if !hasBearer(read, app.admin_token) {
+			app.errorJSON(write, errors.New("invalid admin token"), http.StatusUnauthorized)
+			return
+		}
+
+		admin := strings.TrimSpace(read.Header.Get(admin_user_header))
+		if admin == "" {
+			app.errorJSON(write, fmt.Errorf("the %s header must name the admin", admin_user_header), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(write, read.WithContext(context.WithValue(read.Context(), adminKey{}, admin)))
+	})
+}
+
+// This function lets only the clinicians through, they send the KNN_CLINICIAN_TOKEN as a bearer
+// token. Without a token nobody can confirm a diagnosis.
+func (app *Config) requireClinician(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(write http.ResponseWriter, read *http.Request) {
+		if app.clinician_token == "" {
+			app.errorJSON(write, errors.New("feedback is disabled, set KNN_CLINICIAN_TOKEN to enable it"), http.StatusForbidden)
+			return
+		}
+
+		if !hasBearer(read, app.clinician_token) {
+			app.errorJSON(write, errors.New("invalid clinician token"), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(write, read)
+	})
+}
+
+// This function tells if the request carries the token as its bearer token
+func hasBearer(read *http.Request, token string) bool {
+	sent, found := strings.CutPrefix(read.Header.Get("Authorization"), "Bearer ")
+
+	return found && subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1
+}
+
+// This function returns the admin behind a request that went through requireAdmin
+func adminOf(read *http.Request) (string, bool) {
+	admin, is_admin := read.Context().Value(adminKey{}).(string)
+	return admin, is_admin
+}
+
+// This function keeps an uploaded training csv (raw or uploaded as "file") as a new dataset version:
+// it is validated against the schema of the live model and a model is trained on it with the live
+// hyperparameters and cross validated. With ?activate=true the new version answers right away.
+func (app *Config) UploadDataset(write http.ResponseWriter, read *http.Request) {
+	model := app.Model()
+	admin := strings.TrimSpace(read.Header.Get(admin_user_header))
+
+	input, source, possible_error := readDatasetUpload(write, read)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+	defer input.Close()
+
+	dataset, possible_error := data.ReadDataset(input, model.Dataset.Schema)
+	var dataset_error *data.DatasetError
+	if errors.As(possible_error, &dataset_error) {
+		app.writeJSON(write, http.StatusUnprocessableEntity, jsonResponse{Error: true, Message: dataset_error.Error(), Data: dataset_error.Cells})
+		return
+	}
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	trained, possible_error := artifact.Train(dataset, source, model.Hyperparameters, default_folds, default_seed)
+	if possible_error != nil {
+		app.errorJSON(write, fmt.Errorf("can't train on the dataset: %w", possible_error), http.StatusUnprocessableEntity)
+		return
+	}
+
+	version, possible_error := app.store.Add(trained, admin, nil)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Dataset version %s uploaded by %s: %d rows, model %s", version.ID, admin, version.Dataset.Rows, version.Model)
+
+	upload := datasetUpload{Version: version}
+	message := fmt.Sprintf("Dataset version %s kept with %d rows", version.ID, version.Dataset.Rows)
+
+	if read.URL.Query().Get("activate") == "true" {
+		change, possible_error := app.switchTo(version.ID, admin, false)
+		if possible_error != nil {
+			app.errorJSON(write, possible_error, http.StatusInternalServerError)
+			return
+		}
+		upload.Switch = &change
+		message += " and activated"
+	}
+
+	app.writeJSON(write, http.StatusCreated, jsonResponse{Error: false, Message: message, Data: upload})
+}
+
+// This function lists the dataset versions kept on disk, the oldest first
+func (app *Config) Datasets(write http.ResponseWriter, read *http.Request) {
+	versions, possible_error := app.store.Versions()
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusInternalServerError)
+		return
+	}
+
+	active, possible_error := app.store.Active()
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusInternalServerError)
+		return
+	}
+
+	listed := make([]datasetVersion, len(versions))
+	for index, version := range versions {
+		listed[index] = datasetVersion{Version: version, Active: version.ID == active}
+	}
+
+	pay_load := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d dataset versions, %s is active", len(listed), active),
+		Data:    listed,
+	}
+
+	app.writeJSON(write, http.StatusOK, pay_load)
+}
+
+// This function makes a kept dataset version the one answering the requests
+func (app *Config) ActivateDataset(write http.ResponseWriter, read *http.Request) {
+	admin := strings.TrimSpace(read.Header.Get(admin_user_header))
+
+	change, possible_error := app.switchTo(chi.URLParam(read, "version"), admin, false)
+	if errors.Is(possible_error, artifact.ErrUnknownVersion) {
+		app.errorJSON(write, possible_error, http.StatusNotFound)
+		return
+	}
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(write, http.StatusOK, jsonResponse{Error: false, Message: fmt.Sprintf("Dataset version %s activated", change.To), Data: change})
+}
+
+// This function activates again the dataset version that was active before the current one, a
+// second rollback goes back further until no earlier version is left
+func (app *Config) RollbackDataset(write http.ResponseWriter, read *http.Request) {
+	admin := strings.TrimSpace(read.Header.Get(admin_user_header))
+
+	previous, possible_error := app.store.Previous()
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusInternalServerError)
+		return
+	}
+
+	if previous == "" {
+		app.errorJSON(write, errors.New("no earlier dataset version to roll back to"), http.StatusConflict)
+		return
+	}
+
+	change, possible_error := app.switchTo(previous, admin, true)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(write, http.StatusOK, jsonResponse{Error: false, Message: fmt.Sprintf("Rolled back to dataset version %s", change.To), Data: change})
+}
+
+// This function returns every switch between dataset versions, the oldest first
+func (app *Config) DatasetHistory(write http.ResponseWriter, read *http.Request) {
+	switches, possible_error := app.store.History()
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(write, http.StatusOK, jsonResponse{Error: false, Message: fmt.Sprintf("%d switches", len(switches)), Data: switches})
+}
+
+// This function builds the model of a dataset version and swaps it with the live one, the requests
+// already running finish with the model they started with. The version only becomes active once its
+// model is ready so a broken version never answers.
+func (app *Config) switchTo(id string, admin string, rollback bool) (artifact.Switch, error) {
+	app.switching.Lock()
+	defer app.switching.Unlock()
+
+	return app.activateVersion(id, admin, rollback)
+}
+
+// This function builds the model of a dataset version and activates it, the caller holds the
+// switching lock
+func (app *Config) activateVersion(id string, admin string, rollback bool) (artifact.Switch, error) {
+	trained, possible_error := app.store.Load(id)
+	if possible_error != nil {
+		return artifact.Switch{}, possible_error
+	}
+
+	model, possible_error := newModel(trained)
+	if possible_error != nil {
+		return artifact.Switch{}, fmt.Errorf("can't prepare the model of dataset version %s: %w", id, possible_error)
+	}
+
+	return app.activate(id, admin, rollback, model)
+}
+
+// This function makes a dataset version active with its model already built and swaps the model
+// with the live one, the caller holds the switching lock
+func (app *Config) activate(id string, admin string, rollback bool, model *Model) (artifact.Switch, error) {
+	change, possible_error := app.store.Activate(id, admin, rollback)
+	if possible_error != nil {
+		return artifact.Switch{}, possible_error
+	}
+
+	app.live.Store(model)
+
+	metrics := "no evaluation"
+	if change.Metrics != nil {
+		metrics = fmt.Sprintf("accuracy %.3f, ROC AUC %.3f", change.Metrics.Accuracy, change.Metrics.AUC)
+	}
+	log.Printf("Dataset version %s activated by %s (was %s, rollback %t): model %s, %s", change.To, admin, change.From, rollback, change.Model, metrics)
+
+	return change, nil
+}
+
+// This function returns the csv content of an upload, raw or as the "file" of a form, and where it came from
+func readDatasetUpload(write http.ResponseWriter, read *http.Request) (io.ReadCloser, string, error) {
+	read.Body = http.MaxBytesReader(write, read.Body, max_dataset_bytes)
+
+	media_type, _, _ := mime.ParseMediaType(read.Header.Get("Content-Type"))
+	if media_type != "multipart/form-data" {
+		return read.Body, "upload", nil
+	}
+
+	file, header, possible_error := read.FormFile("file")
+	if possible_error != nil {
+		return nil, "", fmt.Errorf("can't read uploaded file: %w", possible_error)
+	}
+
+	return file, "upload:" + header.Filename, nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"knn/artifact"
+	"knn/data"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+// This function returns the first rows of heart.csv with its header as an upload
+func heart_rows(t *testing.T, rows int) string {
+	t.Helper()
+
+	content, possible_error := os.ReadFile(heart_file)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+
+	return strings.Join(lines[:rows+1], "")
+}
+
+func TestDatasets(t *testing.T) {
+	app := new_test_app(t)
+	deployed, _ := app.store.Active()
+
+	// A version is kept without answering until it is activated
+	var upload datasetUpload
+	decode(t, serve(app, as_admin(json_request(t, http.MethodPost, "/knn/admin/datasets/", heart_rows(t, 200)))), http.StatusCreated, &upload)
+
+	if upload.Version.Dataset.Rows != 200 || upload.Version.UploadedBy != "ada" || upload.Switch != nil {
+		t.Fatalf("version %+v switched by %+v", upload.Version, upload.Switch)
+	}
+	if app.Model().Artifact.Version == upload.Version.Model {
+		t.Fatal("the uploaded version answers before its activation")
+	}
+
+	var change artifact.Switch
+	decode(t, serve(app, as_admin(json_request(t, http.MethodPost, "/knn/admin/datasets/"+upload.Version.ID+"/activate", nil))), http.StatusOK, &change)
+
+	if change.From != deployed || change.To != upload.Version.ID || app.Model().Artifact.Version != upload.Version.Model || len(app.Model().Dataset.Labels) != 200 {
+		t.Fatalf("switch %+v, expected the uploaded version to answer", change)
+	}
+
+	// Uploaded with ?activate=true a version answers right away
+	decode(t, serve(app, as_admin(json_request(t, http.MethodPost, "/knn/admin/datasets/?activate=true", heart_rows(t, 250)))), http.StatusCreated, &upload)
+
+	if upload.Switch == nil || app.Model().Artifact.Version != upload.Version.Model {
+		t.Fatalf("switch %+v, expected the version of 250 rows to answer", upload.Switch)
+	}
+
+	var versions []datasetVersion
+	decode(t, serve(app, as_admin(json_request(t, http.MethodGet, "/knn/admin/datasets/", nil))), http.StatusOK, &versions)
+
+	if len(versions) != 3 || !versions[2].Active || versions[0].Active || versions[1].Active {
+		t.Fatalf("versions %+v, expected the last of three to be active", versions)
+	}
+
+	// Every rollback goes back one activation further until none is left
+	for _, expected := range []string{versions[1].ID, deployed} {
+		decode(t, serve(app, as_admin(json_request(t, http.MethodPost, "/knn/admin/datasets/rollback", nil))), http.StatusOK, &change)
+
+		if change.To != expected || !change.Rollback {
+			t.Fatalf("rolled back to %s, expected %s", change.To, expected)
+		}
+	}
+	decode(t, serve(app, as_admin(json_request(t, http.MethodPost, "/knn/admin/datasets/rollback", nil))), http.StatusConflict, nil)
+
+	if len(app.Model().Dataset.Labels) != 303 {
+		t.Fatalf("%d rows answer, expected the deployed 303", len(app.Model().Dataset.Labels))
+	}
+
+	var history []artifact.Switch
+	decode(t, serve(app, as_admin(json_request(t, http.MethodGet, "/knn/admin/datasets/history", nil))), http.StatusOK, &history)
+
+	if len(history) != 5 || history[0].By != "deployment" || history[4].By != "ada" || !history[4].Rollback {
+		t.Fatalf("history %+v, expected the deployment, two activations and two rollbacks", history)
+	}
+}
+
+func TestDatasetsRefuses(t *testing.T) {
+	app := new_test_app(t)
+
+	// The cells failing the schema are all reported
+	var cells []data.CellError
+	decode(t, serve(app, as_admin(json_request(t, http.MethodPost, "/knn/admin/datasets/", "age,sex,cp,trtbps,chol,fbs,restecg,thalachh,exng,oldpeak,slp,caa,thall,output\n63,1,7,145,233,1,0,150,0,2.3,0,0,1,1\n"))), http.StatusUnprocessableEntity, &cells)
+
+	if len(cells) != 1 || cells[0].Column != "cp" || cells[0].Row != 2 {
+		t.Fatalf("cells %+v, expected the chest pain of row 2", cells)
+	}
+
+	decode(t, serve(app, as_admin(json_request(t, http.MethodPost, "/knn/admin/datasets/unknown/activate", nil))), http.StatusNotFound, nil)
+	decode(t, serve(app, as_admin(json_request(t, http.MethodPost, "/knn/admin/datasets/rollback", nil))), http.StatusConflict, nil)
+
+	// Only the admins manage the versions
+	request := json_request(t, http.MethodGet, "/knn/admin/datasets/", nil)
+	decode(t, serve(app, request), http.StatusUnauthorized, nil)
+
+	request.Header.Set("Authorization", "Bearer "+admin_token)
+	decode(t, serve(app, request), http.StatusUnauthorized, nil)
+
+	app.admin_token = ""
+	decode(t, serve(app, as_admin(json_request(t, http.MethodGet, "/knn/admin/datasets/", nil))), http.StatusForbidden, nil)
+}
+
+func TestLoadActive(t *testing.T) {
+	app := new_test_app(t)
+	deployed := app.Model().Artifact
+
+	artifact_file := t.TempDir() + "/knn-model.json"
+	possible_error := deployed.Save(artifact_file)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	var upload datasetUpload
+	decode(t, serve(app, as_admin(json_request(t, http.MethodPost, "/knn/admin/datasets/?activate=true", heart_rows(t, 200)))), http.StatusCreated, &upload)
+
+	tests := []struct {
+		name     string
+		artifact string
+		expected string
+	}{
+		// A restart keeps the version an admin activated, the training variables are ignored
+		{"restart", "", upload.Version.Model},
+		// The artifact deployed before is known to the store, the admin choice stays
+		{"known artifact", artifact_file, upload.Version.Model},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("KNN_ARTIFACT", test.artifact)
+			t.Setenv("KNN_K", "99")
+
+			trained, possible_error := app.loadActive()
+			if possible_error != nil {
+				t.Fatal(possible_error)
+			}
+
+			if trained.Version != test.expected {
+				t.Fatalf("model %s loaded, expected %s", trained.Version, test.expected)
+			}
+		})
+	}
+
+	// A new artifact takes over the versions activated by hand
+	config := deployed.Hyperparameters
+	config.Defaults.K = 11
+
+	other, possible_error := artifact.Train(deployed.TrainingSet(), heart_file, config, 0, default_seed)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	possible_error = other.Save(artifact_file)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+	t.Setenv("KNN_ARTIFACT", artifact_file)
+
+	trained, possible_error := app.loadActive()
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	active, _ := app.store.Active()
+	version, _ := app.store.Version(active)
+	if trained.Hyperparameters.Defaults.K != 11 || version.Model != trained.Version || version.UploadedBy != "deployment" {
+		t.Fatalf("version %+v active with k=%d, expected the new artifact", version, trained.Hyperparameters.Defaults.K)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"knn/drift"
+	"net/http"
+	"strings"
+)
+
+// This function compares the features of the last predicted patients with the training set of the
+// live model and lists the features whose distribution moved past the thresholds, for example
+// /knn/drift?psi=0.25&alpha=0.05&min_samples=100
+func (app *Config) Drift(write http.ResponseWriter, read *http.Request) {
+	model := app.Model()
+	query := read.URL.Query()
+	thresholds := drift.DefaultThresholds()
+
+	var possible_error error
+
+	thresholds.PSI, possible_error = queryNumber(query, "psi", thresholds.PSI)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	thresholds.KSAlpha, possible_error = queryNumber(query, "alpha", thresholds.KSAlpha)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	thresholds.MinSamples, possible_error = queryInteger(query, "min_samples", thresholds.MinSamples)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	possible_error = thresholds.Validate()
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	recent, observed := app.drift.Snapshot()
+
+	report := drift.Report{
+		Window:     app.drift.Size(),
+		Observed:   observed,
+		Thresholds: thresholds,
+		Features:   drift.Compare(model.Dataset.Schema, model.Dataset.Features, recent, thresholds),
+		Alerts:     []string{},
+	}
+
+	for _, feature := range report.Features {
+		if feature.Alert {
+			report.Alerts = append(report.Alerts, feature.Feature)
+		}
+	}
+
+	message := fmt.Sprintf("No drift from the training set of model %s in the last %d patients", model.Artifact.Version, min(observed, int64(report.Window)))
+	if len(report.Alerts) > 0 {
+		message = fmt.Sprintf("Drift from the training set of model %s in %s", model.Artifact.Version, strings.Join(report.Alerts, ", "))
+	}
+
+	app.writeJSON(write, http.StatusOK, jsonResponse{Error: false, Message: message, Data: report})
+}
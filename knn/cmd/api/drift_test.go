@@ -0,0 +1,44 @@
+package main
+
+import (
+	"knn/drift"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestDrift(t *testing.T) {
+	app := new_test_app(t)
+
+	// Too few patients were predicted to tell anything
+	var report drift.Report
+	decode(t, serve(app, json_request(t, http.MethodGet, "/knn/drift", nil)), http.StatusOK, &report)
+
+	if report.Window != 50 || report.Observed != 0 || len(report.Alerts) > 0 {
+		t.Fatalf("report of %d patients in a window of %d with alerts %v", report.Observed, report.Window, report.Alerts)
+	}
+
+	// Far older patients than the training set ones
+	patients := make([]any, 50)
+	for index := range patients {
+		patients[index] = patient(map[string]any{"age": 90 + index%10})
+	}
+	decode(t, serve(app, json_request(t, http.MethodPost, "/knn/batch", patients)), http.StatusAccepted, nil)
+
+	decode(t, serve(app, json_request(t, http.MethodGet, "/knn/drift", nil)), http.StatusOK, &report)
+
+	if report.Observed != 50 || !slices.Contains(report.Alerts, "age") {
+		t.Fatalf("alerts %v on %d patients, expected the age", report.Alerts, report.Observed)
+	}
+
+	// Asking for more patients than were predicted silences every alert
+	decode(t, serve(app, json_request(t, http.MethodGet, "/knn/drift?min_samples=51", nil)), http.StatusOK, &report)
+
+	if len(report.Alerts) > 0 || report.Thresholds.MinSamples != 51 {
+		t.Fatalf("alerts %v with thresholds %+v", report.Alerts, report.Thresholds)
+	}
+
+	for _, query := range []string{"?psi=0", "?psi=high", "?alpha=2", "?min_samples=0", "?min_samples=1.5"} {
+		decode(t, serve(app, json_request(t, http.MethodGet, "/knn/drift"+query, nil)), http.StatusBadRequest, nil)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"knn/classifier"
+	"knn/data"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	default_folds      = 5
+	default_test_share = 0.2
+	default_seed       = 42
+)
+
+// This function evaluates a model (the default one unless "model" is given) on the loaded dataset
+// with cross validation (default) or with a holdout split. Every setting can be given in the query
+// string, for example /knn/evaluation?method=holdout&test_share=0.3&seed=7&k=5&metric=manhattan&scaler=standard
+// or /knn/evaluation?model=logistic to compare the linear baseline with knn on the same folds
+func (app *Config) Evaluation(write http.ResponseWriter, read *http.Request) {
+	model := app.Model()
+	query := read.URL.Query()
+
+	overrides, possible_error := settingsFromQuery(query)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+	settings := overrides.Resolve(model.Defaults)
+
+	model_name := cmp.Or(query.Get("model"), model.Algorithm)
+
+	scaler_method := query.Get("scaler")
+	if scaler_method == "" {
+		scaler_method = model.Scaler.Method
+	}
+
+	seed, possible_error := querySeed(query)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	folds, possible_error := queryInteger(query, "folds", default_folds)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	test_share, possible_error := queryNumber(query, "test_share", default_test_share)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	var evaluation *classifier.Evaluation
+
+	switch query.Get("method") {
+	case "", classifier.EvaluationCrossValidation, "cv":
+		evaluation, possible_error = classifier.CrossValidate(model.Dataset, model_name, scaler_method, settings, folds, seed)
+	case classifier.EvaluationHoldout:
+		evaluation, possible_error = classifier.Holdout(model.Dataset, model_name, scaler_method, settings, test_share, seed)
+	default:
+		possible_error = fmt.Errorf("unknown evaluation method %q", query.Get("method"))
+	}
+
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	pay_load := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("%s accuracy %.3f, ROC AUC %.3f", evaluation.Model, evaluation.Metrics.Accuracy, evaluation.Metrics.AUC),
+		Data:    evaluation,
+	}
+
+	app.writeJSON(write, http.StatusOK, pay_load)
+}
+
+// This function reads the knn settings given in a query string, the missing ones stay empty
+func settingsFromQuery(query url.Values) (classifier.Settings, error) {
+	settings := classifier.Settings{
+		Metric:    query.Get("metric"),
+		TieBreak:  query.Get("tie_break"),
+		Weighting: query.Get("weighting"),
+	}
+
+	var possible_error error
+
+	settings.K, possible_error = queryInteger(query, "k", 0)
+	if possible_error != nil {
+		return settings, possible_error
+	}
+
+	settings.P, possible_error = queryNumber(query, "p", 0)
+	if possible_error != nil {
+		return settings, possible_error
+	}
+
+	settings.Bandwidth, possible_error = queryNumber(query, "bandwidth", 0)
+	if possible_error != nil {
+		return settings, possible_error
+	}
+
+	if scaler_method := query.Get("scaler"); scaler_method != "" && !data.ValidScalerMethod(scaler_method) {
+		return settings, fmt.Errorf("unknown scaler method %q", scaler_method)
+	}
+
+	return settings, nil
+}
+
+// This function reads a number from the query string or returns the fallback when it is missing
+func queryNumber(query url.Values, key string, fallback float64) (float64, error) {
+	value := query.Get(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	number, possible_error := strconv.ParseFloat(value, 64)
+	if possible_error != nil {
+		return 0, fmt.Errorf("%s must be a number", key)
+	}
+
+	return number, nil
+}
+
+// This function reads a whole number from the query string or returns the fallback when it is missing
+func queryInteger(query url.Values, key string, fallback int) (int, error) {
+	value := query.Get(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	number, possible_error := strconv.Atoi(value)
+	if possible_error != nil {
+		return 0, fmt.Errorf("%s must be a whole number", key)
+	}
+
+	return number, nil
+}
+
+// This function reads the random seed from the query string so an evaluation can be reproduced
+func querySeed(query url.Values) (uint64, error) {
+	value := query.Get("seed")
+	if value == "" {
+		return default_seed, nil
+	}
+
+	seed, possible_error := strconv.ParseUint(value, 10, 64)
+	if possible_error != nil {
+		return 0, fmt.Errorf("seed must be a non-negative whole number")
+	}
+
+	return seed, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"knn/classifier"
+	"net/http"
+	"testing"
+)
+
+func TestEvaluation(t *testing.T) {
+	app := new_test_app(t)
+
+	tests := []struct {
+		name   string
+		query  string
+		method string
+		model  string
+		folds  int
+	}{
+		{"cross validation", "", classifier.EvaluationCrossValidation, classifier.ModelKNN, default_folds},
+		{"holdout", "?method=holdout&test_share=0.3&seed=7", classifier.EvaluationHoldout, classifier.ModelKNN, 0},
+		{"settings", "?folds=3&k=9&metric=manhattan&scaler=standard", classifier.EvaluationCrossValidation, classifier.ModelKNN, 3},
+		{"other model", "?model=logistic", classifier.EvaluationCrossValidation, classifier.ModelLogistic, default_folds},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var evaluation classifier.Evaluation
+			decode(t, serve(app, json_request(t, http.MethodGet, "/knn/evaluation"+test.query, nil)), http.StatusOK, &evaluation)
+
+			if evaluation.Method != test.method || evaluation.Model != test.model || evaluation.Folds != test.folds {
+				t.Fatalf("%s of %s on %d folds, expected %s of %s on %d", evaluation.Method, evaluation.Model, evaluation.Folds, test.method, test.model, test.folds)
+			}
+
+			if evaluation.Metrics.Accuracy < 0.6 || evaluation.Metrics.AUC < 0.6 {
+				t.Fatalf("accuracy %.3f and ROC AUC %.3f", evaluation.Metrics.Accuracy, evaluation.Metrics.AUC)
+			}
+		})
+	}
+}
+
+func TestEvaluationRefuses(t *testing.T) {
+	app := new_test_app(t)
+
+	for _, query := range []string{"?method=bootstrap", "?folds=1", "?folds=two", "?k=-3", "?scaler=log", "?method=holdout&test_share=1.5", "?seed=-1"} {
+		t.Run(query, func(t *testing.T) {
+			decode(t, serve(app, json_request(t, http.MethodGet, "/knn/evaluation"+query, nil)), http.StatusBadRequest, nil)
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"knn/classifier"
+)
+
+// explainedNeighbor is a training record behind a prediction, shown with its original values
+// so a clinician can compare it to the patient. The contributions are keyed by encoded feature,
+// a one-hot column shows one share per value like "chest_pain=2".
+type explainedNeighbor struct {
+	classifier.Neighbor
+	Label         string             `json:"label"`
+	Features      map[string]float64 `json:"features"`
+	Contributions map[string]float64 `json:"contributions"`
+}
+
+// predictionResponse is the prediction of the model version with the optional explanation of its
+// neighbors, the missing features that were either filled (Imputed) or left out of the distances
+// (Ignored) and the verdict of every member when an ensemble answers. The id lets a clinician
+// confirm the diagnosis later.
+type predictionResponse struct {
+	classifier.Prediction
+	PredictionID string               `json:"prediction_id,omitempty"`
+	ModelVersion string               `json:"model_version"`
+	Members      []classifier.Verdict `json:"members,omitempty"`
+	Imputed      []imputedField       `json:"imputed,omitempty"`
+	Ignored      []string             `json:"ignored,omitempty"`
+	Explanation  []explainedNeighbor  `json:"explanation,omitempty"`
+}
+
+// This function describes every neighbor of the prediction: its unscaled features, its label and
+// how much each encoded feature added to its distance from the scaled query, present marks the encoded
+// features the distance was measured on (nil for all of them)
+func (model *Model) explain(X_scaled_to_predict []float64, present []bool, prediction classifier.Prediction) []explainedNeighbor {
+	schema := model.Dataset.Schema
+	fields := schema.FeatureFields()
+	label_column := schema.LabelColumn()
+
+	explanation := make([]explainedNeighbor, len(prediction.Neighbors))
+
+	for index, neighbor := range prediction.Neighbors {
+		contributions := model.KNN.Contributions(X_scaled_to_predict, present, neighbor.Index, *prediction.Settings)
+
+		explained := explainedNeighbor{
+			Neighbor:      neighbor,
+			Label:         label_column.LabelOf(float64(neighbor.Class)),
+			Features:      map[string]float64{},
+			Contributions: map[string]float64{},
+		}
+
+		for feature, field := range fields {
+			explained.Features[field] = model.Dataset.Features[neighbor.Index][feature]
+		}
+
+		for feature, name := range model.Encoder.Names {
+			explained.Contributions[name] = contributions[feature]
+		}
+
+		explanation[index] = explained
+	}
+
+	return explanation
+}
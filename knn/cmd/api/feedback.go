@@ -0,0 +1,321 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"knn/artifact"
+	"knn/data"
+	"knn/feedback"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// feedbackPayload is the diagnosis a clinician confirmed for a prediction, Outcome is the class
+type feedbackPayload struct {
+	PredictionID string `json:"prediction_id"`
+	Outcome      *int   `json:"outcome"`
+	Clinician    string `json:"clinician"`
+}
+
+// accuracyGroup compares the live accuracy of a model version on the confirmed cases with the
+// accuracy its cross validation promised, the latter is unknown for a version trained without it
+type accuracyGroup struct {
+	ModelVersion           string   `json:"model_version"`
+	Model                  string   `json:"model"`
+	Confirmed              int      `json:"confirmed"`
+	Correct                int      `json:"correct"`
+	LiveAccuracy           float64  `json:"live_accuracy"`
+	CrossValidatedAccuracy *float64 `json:"cross_validated_accuracy,omitempty"`
+}
+
+// accuracyReport adds the groups up, the cross validated accuracy is the average of the groups
+// that have one weighted by their confirmed cases so both accuracies are over the same predictions
+type accuracyReport struct {
+	Confirmed              int             `json:"confirmed"`
+	Correct                int             `json:"correct"`
+	LiveAccuracy           float64         `json:"live_accuracy"`
+	CrossValidatedAccuracy *float64        `json:"cross_validated_accuracy,omitempty"`
+	Groups                 []accuracyGroup `json:"groups"`
+}
+
+// foldResult is the dataset version made of the active rows and the confirmed cases, Skipped counts
+// the new cases that couldn't become rows because some of their features were missing
+type foldResult struct {
+	datasetUpload
+	Folded  int `json:"folded"`
+	Skipped int `json:"skipped"`
+}
+
+// This function records the diagnosis a clinician confirmed for a patient scored earlier, for example
+// {"prediction_id": "5f0c...", "outcome": 1, "clinician": "dr. levi"}. The request must carry the
+// KNN_CLINICIAN_TOKEN since the confirmed cases can be folded into the training set.
+func (app *Config) Feedback(write http.ResponseWriter, read *http.Request) {
+	var feedback_payload feedbackPayload
+
+	possible_error := app.readJSON(write, read, &feedback_payload)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	label_column := app.Model().Dataset.Schema.LabelColumn()
+	var field_errors []data.FieldError
+
+	if feedback_payload.PredictionID == "" {
+		field_errors = append(field_errors, data.FieldError{Field: "prediction_id", Reason: "is required"})
+	}
+
+	if feedback_payload.Outcome == nil {
+		field_errors = append(field_errors, data.FieldError{Field: "outcome", Reason: "is required"})
+	} else if possible_error := label_column.Check(float64(*feedback_payload.Outcome)); possible_error != nil {
+		field_errors = append(field_errors, data.FieldError{Field: "outcome", Value: strconv.Itoa(*feedback_payload.Outcome), Reason: possible_error.Error()})
+	}
+
+	if strings.TrimSpace(feedback_payload.Clinician) == "" {
+		field_errors = append(field_errors, data.FieldError{Field: "clinician", Reason: "is required"})
+	}
+
+	if len(field_errors) > 0 {
+		app.validationJSON(write, &data.ValidationError{Fields: field_errors})
+		return
+	}
+
+	confirmed, possible_error := app.outcomes.Confirm(feedback_payload.PredictionID, *feedback_payload.Outcome, strings.TrimSpace(feedback_payload.Clinician))
+	if errors.Is(possible_error, feedback.ErrUnknownPrediction) {
+		app.errorJSON(write, possible_error, http.StatusNotFound)
+		return
+	}
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusInternalServerError)
+		return
+	}
+
+	verdict := "wrong"
+	if confirmed.Correct {
+		verdict = "right"
+	}
+
+	pay_load := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Outcome %s recorded, model %s was %s", label_column.LabelOf(float64(confirmed.Outcome.Class)), confirmed.Prediction.ModelVersion, verdict),
+		Data:    confirmed,
+	}
+
+	app.writeJSON(write, http.StatusCreated, pay_load)
+}
+
+// This function reports how accurate the predictions clinicians confirmed were, for every model
+// version and algorithm, next to the cross validated accuracy of that model
+func (app *Config) FeedbackAccuracy(write http.ResponseWriter, read *http.Request) {
+	model := app.Model()
+	cases := app.outcomes.Cases()
+
+	versions, possible_error := app.store.Versions()
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusInternalServerError)
+		return
+	}
+
+	// The artifacts of the model versions, the live one may not be kept by the store after a search
+	artifacts := map[string]*artifact.Artifact{model.Artifact.Version: model.Artifact}
+
+	report := accuracyReport{Groups: []accuracyGroup{}}
+	expected, expected_cases := 0.0, 0
+
+	for _, confirmed := range cases {
+		position := slices.IndexFunc(report.Groups, func(group accuracyGroup) bool {
+			return group.ModelVersion == confirmed.Prediction.ModelVersion && group.Model == confirmed.Prediction.Model
+		})
+		if position < 0 {
+			report.Groups = append(report.Groups, accuracyGroup{ModelVersion: confirmed.Prediction.ModelVersion, Model: confirmed.Prediction.Model})
+			position = len(report.Groups) - 1
+		}
+
+		group := &report.Groups[position]
+		group.Confirmed++
+		if confirmed.Correct {
+			group.Correct++
+		}
+	}
+
+	for index := range report.Groups {
+		group := &report.Groups[index]
+		group.LiveAccuracy = float64(group.Correct) / float64(group.Confirmed)
+
+		report.Confirmed += group.Confirmed
+		report.Correct += group.Correct
+
+		trained, found := artifacts[group.ModelVersion]
+		if !found {
+			for _, version := range versions {
+				if version.Model == group.ModelVersion {
+					trained, possible_error = app.store.Load(version.ID)
+					if possible_error != nil {
+						app.errorJSON(write, possible_error, http.StatusInternalServerError)
+						return
+					}
+					artifacts[group.ModelVersion] = trained
+					break
+				}
+			}
+		}
+
+		if trained == nil {
+			continue
+		}
+
+		for _, evaluation := range trained.Evaluations {
+			if evaluation.Model == group.Model {
+				accuracy := evaluation.Metrics.Accuracy
+				group.CrossValidatedAccuracy = &accuracy
+				expected += accuracy * float64(group.Confirmed)
+				expected_cases += group.Confirmed
+			}
+		}
+	}
+
+	message := "No confirmed outcomes yet"
+
+	if report.Confirmed > 0 {
+		report.LiveAccuracy = float64(report.Correct) / float64(report.Confirmed)
+		message = fmt.Sprintf("Live accuracy %.3f on %d confirmed outcomes", report.LiveAccuracy, report.Confirmed)
+	}
+
+	if expected_cases > 0 {
+		accuracy := expected / float64(expected_cases)
+		report.CrossValidatedAccuracy = &accuracy
+		message += fmt.Sprintf(", cross validated accuracy %.3f", accuracy)
+	}
+
+	app.writeJSON(write, http.StatusOK, jsonResponse{Error: false, Message: message, Data: report})
+}
+
+// This function adds the confirmed cases that aren't in the active dataset version yet to its rows
+// and keeps the result as a new version trained like the active one, with ?activate=true it answers
+// right away. A case whose features were not all given can't become a row and is skipped. The fold
+// holds the switching lock so the active version can't change under it and two folds of the same
+// version don't both add one.
+func (app *Config) FoldFeedback(write http.ResponseWriter, read *http.Request) {
+	admin := strings.TrimSpace(read.Header.Get(admin_user_header))
+
+	app.switching.Lock()
+	defer app.switching.Unlock()
+
+	active, possible_error := app.store.Active()
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusInternalServerError)
+		return
+	}
+
+	base, possible_error := app.store.Version(active)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusInternalServerError)
+		return
+	}
+
+	// The live model may not be the one of the active version, the rows come from the version
+	base_artifact, possible_error := app.store.Load(active)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusInternalServerError)
+		return
+	}
+
+	dataset := &data.Dataset{
+		Schema:   base_artifact.Schema,
+		Features: slices.Clone(base_artifact.Features),
+		Labels:   slices.Clone(base_artifact.Labels),
+	}
+	folded := slices.Clone(base.Cases)
+	result := foldResult{}
+
+	for _, confirmed := range app.outcomes.Cases() {
+		if slices.Contains(base.Cases, confirmed.Prediction.ID) {
+			continue
+		}
+
+		row, possible_error := dataset.Schema.Vector(confirmed.Prediction.Features)
+		if !confirmed.Prediction.Complete || possible_error != nil {
+			result.Skipped++
+			continue
+		}
+
+		dataset.Features = append(dataset.Features, row)
+		dataset.Labels = append(dataset.Labels, confirmed.Outcome.Class)
+		folded = append(folded, confirmed.Prediction.ID)
+		result.Folded++
+	}
+
+	if result.Folded == 0 {
+		app.errorJSON(write, fmt.Errorf("no confirmed case to add to dataset version %s, %d skipped", active, result.Skipped), http.StatusConflict)
+		return
+	}
+
+	source := fmt.Sprintf("%s with %d confirmed cases", active, result.Folded)
+
+	trained, possible_error := artifact.Train(dataset, source, base_artifact.Hyperparameters, default_folds, default_seed)
+	if possible_error != nil {
+		app.errorJSON(write, fmt.Errorf("can't train on the confirmed cases: %w", possible_error), http.StatusUnprocessableEntity)
+		return
+	}
+
+	result.Version, possible_error = app.store.Add(trained, admin, folded)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Dataset version %s folded %d confirmed cases into %s by %s: model %s", result.Version.ID, result.Folded, active, admin, result.Version.Model)
+
+	message := fmt.Sprintf("Dataset version %s kept with %d confirmed cases added to %s", result.Version.ID, result.Folded, active)
+
+	if read.URL.Query().Get("activate") == "true" {
+		change, possible_error := app.activateVersion(result.Version.ID, admin, false)
+		if possible_error != nil {
+			app.errorJSON(write, possible_error, http.StatusInternalServerError)
+			return
+		}
+		result.Switch = &change
+		message += " and activated"
+	}
+
+	app.writeJSON(write, http.StatusCreated, jsonResponse{Error: false, Message: message, Data: result})
+}
+
+// This function keeps the predictions so clinicians can confirm them and gives each response its id,
+// the features of the patients join the drift windows. A prediction that can't be kept is still
+// answered, only without an id.
+func (app *Config) record(payloads []requestsPayload, responses []*predictionResponse) {
+	if len(responses) == 0 {
+		return
+	}
+
+	for _, payload := range payloads {
+		app.drift.Observe(payload.Features)
+	}
+
+	predictions := make([]*feedback.Prediction, len(responses))
+
+	for index, response := range responses {
+		predictions[index] = &feedback.Prediction{
+			ModelVersion: response.ModelVersion,
+			Model:        response.Model,
+			Features:     payloads[index].Features,
+			Complete:     len(response.Imputed) == 0 && len(response.Ignored) == 0,
+			Class:        response.Class,
+			Probability:  response.Probability,
+		}
+	}
+
+	possible_error := app.outcomes.Record(predictions...)
+	if possible_error != nil {
+		log.Printf("Can't keep %d predictions for feedback: %v", len(predictions), possible_error)
+		return
+	}
+
+	for index, response := range responses {
+		response.PredictionID = predictions[index].ID
+	}
+}
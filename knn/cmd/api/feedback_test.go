@@ -0,0 +1,110 @@
+package main
+
+import (
+	"knn/classifier"
+	"knn/data"
+	"knn/feedback"
+	"net/http"
+	"testing"
+)
+
+// This function asks the service for a prediction and returns its id
+func predict(t *testing.T, app *Config, payload map[string]any) string {
+	t.Helper()
+
+	var prediction predictionResponse
+	decode(t, serve(app, json_request(t, http.MethodPost, "/knn", payload)), http.StatusAccepted, &prediction)
+
+	return prediction.PredictionID
+}
+
+// This function builds the request of a clinician confirming an outcome
+func confirm(t *testing.T, body any) *http.Request {
+	request := json_request(t, http.MethodPost, "/knn/feedback", body)
+	request.Header.Set("Authorization", "Bearer "+clinician_token)
+
+	return request
+}
+
+func TestFeedback(t *testing.T) {
+	app := new_test_app(t)
+
+	complete := predict(t, app, patient(nil))
+	imputed := predict(t, app, patient(map[string]any{"age": nil, "options": map[string]any{"missing": data.MissingMean}}))
+
+	var confirmed feedback.Case
+	decode(t, serve(app, confirm(t, map[string]any{"prediction_id": complete, "outcome": 0, "clinician": "dr. levi"})), http.StatusCreated, &confirmed)
+
+	if confirmed.Correct || confirmed.Outcome.Clinician != "dr. levi" || !confirmed.Prediction.Complete {
+		t.Fatalf("case %+v, expected the heart disease predicted for a healthy patient to be wrong", confirmed)
+	}
+
+	// A later outcome of the same prediction replaces the earlier one
+	decode(t, serve(app, confirm(t, map[string]any{"prediction_id": complete, "outcome": 1, "clinician": "dr. levi"})), http.StatusCreated, &confirmed)
+	decode(t, serve(app, confirm(t, map[string]any{"prediction_id": imputed, "outcome": 1, "clinician": "dr. levi"})), http.StatusCreated, nil)
+
+	var report accuracyReport
+	decode(t, serve(app, json_request(t, http.MethodGet, "/knn/feedback/accuracy", nil)), http.StatusOK, &report)
+
+	if report.Confirmed != 2 || report.Correct != 2 || report.LiveAccuracy != 1 || len(report.Groups) != 1 {
+		t.Fatalf("report %+v, expected the two right predictions of the knn", report)
+	}
+
+	group := report.Groups[0]
+	if group.Model != classifier.ModelKNN || group.ModelVersion != app.Model().Artifact.Version || group.CrossValidatedAccuracy == nil {
+		t.Fatalf("group %+v, expected the cross validated accuracy of the live knn", group)
+	}
+
+	// Only the complete case becomes a row, folding it again adds nothing
+	var fold foldResult
+	decode(t, serve(app, as_admin(json_request(t, http.MethodPost, "/knn/admin/datasets/fold?activate=true", nil))), http.StatusCreated, &fold)
+
+	if fold.Folded != 1 || fold.Skipped != 1 || fold.Switch == nil || len(app.Model().Dataset.Labels) != 304 {
+		t.Fatalf("fold %+v, expected one more row to answer", fold)
+	}
+
+	decode(t, serve(app, as_admin(json_request(t, http.MethodPost, "/knn/admin/datasets/fold", nil))), http.StatusConflict, nil)
+}
+
+func TestFeedbackRefuses(t *testing.T) {
+	app := new_test_app(t)
+
+	tests := []struct {
+		name   string
+		body   any
+		status int
+		fields []string
+	}{
+		{"unknown prediction", map[string]any{"prediction_id": "unknown", "outcome": 1, "clinician": "dr. levi"}, http.StatusNotFound, nil},
+		{"no field", map[string]any{}, http.StatusUnprocessableEntity, []string{"prediction_id", "outcome", "clinician"}},
+		{"invalid outcome", map[string]any{"prediction_id": "unknown", "outcome": 3, "clinician": " "}, http.StatusUnprocessableEntity, []string{"outcome", "clinician"}},
+		{"not json", "{", http.StatusBadRequest, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var field_errors []data.FieldError
+			decode(t, serve(app, confirm(t, test.body)), test.status, &field_errors)
+
+			if len(field_errors) != len(test.fields) {
+				t.Fatalf("fields %+v refused, expected %v", field_errors, test.fields)
+			}
+			for index, field := range test.fields {
+				if field_errors[index].Field != field {
+					t.Errorf("field %s refused, expected %s", field_errors[index].Field, field)
+				}
+			}
+		})
+	}
+
+	// Only the clinicians confirm an outcome
+	request := confirm(t, map[string]any{})
+	request.Header.Set("Authorization", "Bearer guess")
+	decode(t, serve(app, request), http.StatusUnauthorized, nil)
+
+	app.clinician_token = ""
+	decode(t, serve(app, confirm(t, map[string]any{})), http.StatusForbidden, nil)
+
+	// There is nothing to fold before a confirmed outcome
+	decode(t, serve(app, as_admin(json_request(t, http.MethodPost, "/knn/admin/datasets/fold", nil))), http.StatusConflict, nil)
+}
@@ -1,245 +1,137 @@
 package main
 
 import (
-	"encoding/csv"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
-	"math"
+	"knn/classifier"
+	"knn/data"
 	"net/http"
-	"os"
 	"slices"
-	"strconv"
+	"strings"
 )
 
+// requestsPayload holds the patient features keyed by the json field names declared in the dataset schema
+// and the optional settings overriding the service defaults for this request only. Invalid keeps the
+// fields that couldn't be decoded so they are reported with the ones failing the schema checks.
 type requestsPayload struct {
-	Age                                int     `json:"age"`
-	Gender                             int     `json:"gender"`
-	ChestPain                          int     `json:"chest_pain"`
-	RestingBloodPressure               int     `json:"resting_blood_pressure"`
-	CholestoralInMg                    int     `json:"cholestoral_in_mg"`
-	FastingBloodSugar                  int     `json:"fasting_blood_sugar"`
-	RestingElectrocardiographicResults int     `json:"resting_electrocardiographic_results"`
-	MaximumHeartRateAchieved           int     `json:"maximum_heart_rate_achieved"`
-	ExerciseInducedAngina              int     `json:"exercise_induced_angina"`
-	PreviousPeak                       float64 `json:"previous_peak"`
-	SlopeOfThePeakExercise             int     `json:"slope_of_the_peak_exercise"`
-	NumberOfMajorVessels               int     `json:"number_of_major_vessels"`
-	Thalassemia                        int     `json:"thalassemia"`
+	Features map[string]float64
+	Options  requestOptions
+	Invalid  []data.FieldError
 }
 
-// This function execute KNN algorithm on given data to predict the json message result
-func (app *Config) KNN(write http.ResponseWriter, read *http.Request) {
-	var requests_payload requestsPayload
+// requestOptions are the knn settings of a single request, whether to explain the result, how to
+// handle the missing features and which algorithm answers
+type requestOptions struct {
+	classifier.Settings
+	Explain bool   `json:"explain"`
+	Missing string `json:"missing,omitempty"`
+	Model   string `json:"model,omitempty"`
+}
 
-	// Write the json to requestsPayload struct
-	possible_error := app.readJSON(write, read, &requests_payload)
+// This function decodes the flat json object, every key is a feature except "options". A null feature
+// is left out like a missing one. A feature that isn't a number or options with unknown settings are
+// kept in Invalid instead of stopping the decoding.
+func (payload *requestsPayload) UnmarshalJSON(content []byte) error {
+	var fields map[string]json.RawMessage
 
+	possible_error := json.Unmarshal(content, &fields)
 	if possible_error != nil {
-		app.errorJSON(write, possible_error, http.StatusBadRequest)
-		return
+		return possible_error
 	}
 
-	// Load the csv into slice [][]int object and seperate X, y by the last column
-	X, y := load_dataset("heart.csv")
-
-	// Set the payload as []int slice
-	X_to_predict := []int{
-		requests_payload.Age,
-		requests_payload.Gender,
-		requests_payload.ChestPain,
-		requests_payload.RestingBloodPressure,
-		requests_payload.CholestoralInMg,
-		requests_payload.FastingBloodSugar,
-		requests_payload.RestingElectrocardiographicResults,
-		requests_payload.MaximumHeartRateAchieved,
-		requests_payload.ExerciseInducedAngina,
-		int(requests_payload.PreviousPeak),
-		requests_payload.SlopeOfThePeakExercise,
-		requests_payload.NumberOfMajorVessels,
-		requests_payload.Thalassemia,
-	}
+	payload.Features = map[string]float64{}
 
-	// Do scalling for X and X_to_predict
-	X_scaled := minmax_scale_fit_transform(X)
-	X_scaled_to_predict := minmax_to_predict_scale_fit_transform(X_to_predict)
+	for key, value := range fields {
+		if key == "options" {
+			decoded_options := json.NewDecoder(bytes.NewReader(value))
+			decoded_options.DisallowUnknownFields()
 
-	// Try to predict the result
-	y_predicted := predict(X_scaled_to_predict, X_scaled, y, 3)
+			possible_error = decoded_options.Decode(&payload.Options)
+			if possible_error != nil {
+				payload.Invalid = append(payload.Invalid, data.FieldError{Field: key, Reason: strings.TrimPrefix(possible_error.Error(), "json: ")})
+			}
+			continue
+		}
 
-	var result string
+		if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			continue
+		}
 
-	if y_predicted[0] == 0 {
-		result = "Yes"
-	} else {
-		result = "No"
+		var number float64
+		possible_error = json.Unmarshal(value, &number)
+		if possible_error != nil {
+			payload.Invalid = append(payload.Invalid, data.FieldError{Field: key, Value: string(value), Reason: "must be a number"})
+			continue
+		}
+		payload.Features[key] = number
 	}
 
-	pay_load := jsonResponse{
-		Error:   false,
-		Message: fmt.Sprintf("The result is: %s", result),
-	}
+	// Map iteration is random, keep the reported fields in a stable order
+	slices.SortFunc(payload.Invalid, func(a, b data.FieldError) int { return cmp.Compare(a.Field, b.Field) })
 
-	// Return answer to the broker
-	app.writeJSON(write, http.StatusAccepted, pay_load)
+	return nil
 }
 
-// This function get csv file and return it as two slices of type int
-func load_dataset(file_name string) ([][]int, []int) {
-	var X [][]int
-	var y []int
+// This function execute KNN algorithm on given data to predict the json message result
+func (app *Config) KNN(write http.ResponseWriter, read *http.Request) {
+	var requests_payload requestsPayload
 
-	// Try to open the csv file in read-write mode.
-	csvFile, csvFileError := os.OpenFile(file_name, os.O_RDWR, os.ModePerm)
-	if csvFileError != nil {
-		panic(csvFileError)
-	}
-	// Ensure the file is closed once the function returns
-	defer csvFile.Close()
+	// Write the json to requestsPayload struct
+	possible_error := app.readJSON(write, read, &requests_payload)
 
-	reader := csv.NewReader(csvFile)
-	_, possible_error := reader.Read() // Skips header
 	if possible_error != nil {
-		return X, y
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
 	}
 
-	for {
-		row, possible_error := reader.Read()
-		if possible_error == io.EOF {
-			break
-		}
-		if possible_error != nil {
-			log.Fatal(possible_error)
-		}
-
-		//convert the string to int and ignore the error
-		inR0, _ := strconv.Atoi(row[0])
-		inR1, _ := strconv.Atoi(row[1])
-		inR2, _ := strconv.Atoi(row[2])
-		inR3, _ := strconv.Atoi(row[3])
-		inR4, _ := strconv.Atoi(row[4])
-		inR5, _ := strconv.Atoi(row[5])
-		inR6, _ := strconv.Atoi(row[6])
-		inR7, _ := strconv.Atoi(row[7])
-		inR8, _ := strconv.Atoi(row[8])
-		inR9, _ := strconv.Atoi(row[9])
-		inR10, _ := strconv.Atoi(row[10])
-		inR11, _ := strconv.Atoi(row[7])
-		inR12, _ := strconv.Atoi(row[8])
-		inR13, _ := strconv.Atoi(row[9])
-
-		//Create a vector to add to X
-		row_to_add := []int{inR0, inR1, inR2, inR3, inR4, inR5, inR6, inR7, inR8, inR9, inR10, inR11, inR12}
-
-		//Add the vector to X and the last column value to the y
-		X = append(X, row_to_add)
-		y = append(y, inR13)
+	// Try to predict the result, invalid patient fields are all reported at once
+	prediction, possible_error := app.Model().predict(requests_payload)
+	var validation_error *data.ValidationError
+	if errors.As(possible_error, &validation_error) {
+		app.validationJSON(write, validation_error)
+		return
 	}
-
-	return X, y
-}
-
-// This function will do scalling to the X_to_predict in order to ensure the
-// varibles will be between 0 to 1 so the prediction will be more acurate since all the varible on the same scale
-func minmax_to_predict_scale_fit_transform(X_to_predict []int) []float32 {
-
-	// Create the return slice
-	X_scaled := make([]float32, len(X_to_predict))
-
-	// Find min and max values in the vector
-	min_value := slices.Min(X_to_predict)
-	max_value := slices.Max(X_to_predict)
-	range_value := max_value - min_value
-
-	// Set new value to each varible on the vector
-	for index, value := range X_to_predict {
-		new_value := float32(value-min_value) / float32(range_value)
-		X_scaled[index] = new_value
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
 	}
 
-	return X_scaled
-}
-
-// This function will do scalling to the X in order to ensure the
-// varibles will be between 0 to 1 so the prediction will be more acurate since all the varible on the same scale
-func minmax_scale_fit_transform(X [][]int) [][]float32 {
-
-	// Create the return slice
-	X_scaled := make([][]float32, len(X))
-
-	// Loop through all the vectors
-	for index, element := range X {
+	app.record([]requestsPayload{requests_payload}, []*predictionResponse{&prediction})
 
-		// Find min and max values in the vector
-		min_value := slices.Min(element)
-		max_value := slices.Max(element)
-		range_value := max_value - min_value
+	var result string
 
-		// Set new value to each varible on the vector
-		for _, value := range element {
-			new_value := float32(value-min_value) / float32(range_value)
-			X_scaled[index] = append(X_scaled[index], new_value)
-		}
+	if prediction.Class == classifier.PositiveClass {
+		result = "Yes"
+	} else {
+		result = "No"
 	}
 
-	return X_scaled
-}
-
-// This function calculate distance between X_to_predict vector and all X vectors
-// and return the distances
-func calc_distance(X_to_predict []float32, X [][]float32) []float32 {
-
-	distances := make([]float32, len(X))
-
-	// Loop through all the vectors and calculate the distance with euclidean distance formula
-	for i := 0; i < len(X); i++ {
-		euclidean_distance := 0.0
-
-		x := X[i]
-		y := X_to_predict
-
-		for r := 0; r < len(x); r++ {
-			difference := x[r] - y[r]
-			euclidean_distance += math.Pow(float64(difference), 2)
-		}
-
-		euclidean_distance = math.Sqrt(float64(euclidean_distance))
-		distances[i] = float32(euclidean_distance)
+	pay_load := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("The result is: %s, risk of heart disease %.0f%%", result, prediction.Probability*100),
+		Data:    prediction,
 	}
 
-	return distances
+	// Return answer to the broker
+	app.writeJSON(write, http.StatusAccepted, pay_load)
 }
 
-// This function will predict the result of X_to_predict based on the results of X
-func predict(X_to_predict []float32, X [][]float32, y []int, k int) []int {
-	// Calculate distance between X_to_predict vector and all X vectors
-	distances_array := calc_distance(X_to_predict, X)
-
-	y_predicted := make([]int, len(y))
+// This function returns the scaler parameters fitted on the encoded training set so they can be
+// audited, features names the encoded features in the order of the parameters
+func (app *Config) Scaler(write http.ResponseWriter, read *http.Request) {
+	model := app.Model()
 
-	group_A := 0
-	group_B := 0
-
-	// Run K times and find the K neighbors of X_to_predict vector
-	for i := 0; i < k; i++ {
-		closest_index := slices.Index(distances_array, slices.Min(distances_array))
-
-		if y[closest_index] == 1 {
-			group_A += 1
-		} else {
-			group_B += 1
-		}
-
-		distances_array = append(distances_array[:closest_index], distances_array[closest_index+1:]...)
-	}
-
-	// If more neighbors are from group_A X_to_predict is also belong to group_A
-	// otherwise X_to_predict belong to group_B
-	if group_A > group_B {
-		y_predicted = append(y_predicted, 1)
-	} else {
-		y_predicted = append(y_predicted, 0)
+	pay_load := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Scaler fitted with %s method", model.Scaler.Method),
+		Data: struct {
+			Features []string `json:"features"`
+			*data.Scaler
+		}{model.Encoder.Names, model.Scaler},
 	}
 
-	return y_predicted
+	app.writeJSON(write, http.StatusOK, pay_load)
 }
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"knn/classifier"
+	"knn/data"
+	"math"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestKNN(t *testing.T) {
+	app := new_test_app(t)
+
+	var prediction predictionResponse
+	message := decode(t, serve(app, json_request(t, http.MethodPost, "/knn", patient(nil))), http.StatusAccepted, &prediction)
+
+	if prediction.Class != classifier.PositiveClass || prediction.Label != "Heart disease" || message == "" {
+		t.Fatalf("class %d %q (%s), expected the heart disease of the first patient", prediction.Class, prediction.Label, message)
+	}
+
+	if math.Abs(prediction.Probabilities[0]+prediction.Probabilities[1]-1) > 1e-9 || prediction.Probability != prediction.Probabilities[1] {
+		t.Fatalf("probabilities %v with probability %v", prediction.Probabilities, prediction.Probability)
+	}
+
+	if prediction.ModelVersion != app.Model().Artifact.Version || prediction.PredictionID == "" {
+		t.Fatalf("model version %q and prediction id %q", prediction.ModelVersion, prediction.PredictionID)
+	}
+}
+
+func TestKNNSettings(t *testing.T) {
+	app := new_test_app(t)
+
+	tests := []struct {
+		name    string
+		options map[string]any
+	}{
+		{"k and metric", map[string]any{"k": 7, "metric": classifier.MetricManhattan}},
+		{"minkowski", map[string]any{"k": 3, "metric": classifier.MetricMinkowski, "p": 3}},
+		{"distance weighting", map[string]any{"k": 9, "weighting": classifier.WeightDistance}},
+		{"kernel weighting", map[string]any{"k": 9, "weighting": classifier.WeightGaussian, "bandwidth": 0.5}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var prediction predictionResponse
+			decode(t, serve(app, json_request(t, http.MethodPost, "/knn", patient(map[string]any{"options": test.options}))), http.StatusAccepted, &prediction)
+
+			settings := prediction.Settings
+			if settings == nil || settings.K != test.options["k"] || len(prediction.Neighbors) != settings.K {
+				t.Fatalf("settings %+v with %d neighbors, expected the options %v", settings, len(prediction.Neighbors), test.options)
+			}
+
+			for option, value := range map[string]string{"metric": settings.Metric, "weighting": settings.Weighting} {
+				if expected, given := test.options[option]; given && value != expected {
+					t.Errorf("%s %q, expected %q", option, value, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestKNNExplain(t *testing.T) {
+	app := new_test_app(t)
+
+	options := map[string]any{"k": 4, "explain": true}
+
+	var prediction predictionResponse
+	decode(t, serve(app, json_request(t, http.MethodPost, "/knn", patient(map[string]any{"options": options}))), http.StatusAccepted, &prediction)
+
+	if len(prediction.Explanation) != 4 {
+		t.Fatalf("%d neighbors explained, expected 4", len(prediction.Explanation))
+	}
+
+	for index, neighbor := range prediction.Explanation {
+		if len(neighbor.Features) != len(app.Model().Dataset.Schema.Features()) || neighbor.Label == "" {
+			t.Errorf("neighbor %d has %d features and label %q", index, len(neighbor.Features), neighbor.Label)
+		}
+
+		total := 0.0
+		for _, contribution := range neighbor.Contributions {
+			total += contribution
+		}
+		if total <= 0 && prediction.Neighbors[index].Distance > 0 {
+			t.Errorf("neighbor %d at distance %v has no contribution", index, prediction.Neighbors[index].Distance)
+		}
+	}
+}
+
+func TestKNNRefuses(t *testing.T) {
+	app := new_test_app(t)
+
+	tests := []struct {
+		name   string
+		body   any
+		status int
+		fields []string
+	}{
+		{"not json", "{", http.StatusBadRequest, nil},
+		{"two json values", "{} {}", http.StatusBadRequest, nil},
+		{"out of range", patient(map[string]any{"age": 130, "chest_pain": 5}), http.StatusUnprocessableEntity, []string{"age", "chest_pain"}},
+		{"not a number", patient(map[string]any{"age": "old"}), http.StatusUnprocessableEntity, []string{"age"}},
+		{"missing field", patient(map[string]any{"thalassemia": nil}), http.StatusUnprocessableEntity, []string{"thalassemia"}},
+		{"unknown option", patient(map[string]any{"options": map[string]any{"neighbours": 3}}), http.StatusUnprocessableEntity, []string{"options"}},
+		{"invalid k", patient(map[string]any{"options": map[string]any{"k": -1}}), http.StatusBadRequest, nil},
+		{"unknown metric", patient(map[string]any{"options": map[string]any{"metric": "jaccard"}}), http.StatusBadRequest, nil},
+		{"unknown model", patient(map[string]any{"options": map[string]any{"model": "svm"}}), http.StatusBadRequest, nil},
+		{"unknown missing policy", patient(map[string]any{"options": map[string]any{"missing": "guess"}}), http.StatusBadRequest, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var field_errors []data.FieldError
+			decode(t, serve(app, json_request(t, http.MethodPost, "/knn", test.body)), test.status, &field_errors)
+
+			var fields []string
+			for _, field_error := range field_errors {
+				fields = append(fields, field_error.Field)
+			}
+			if !slices.Equal(fields, test.fields) {
+				t.Fatalf("fields %v refused, expected %v", fields, test.fields)
+			}
+		})
+	}
+}
+
+func TestKNNMissing(t *testing.T) {
+	app := new_test_app(t)
+
+	tests := []struct {
+		name    string
+		options map[string]any
+		imputed string
+		ignored bool
+	}{
+		{"mean", map[string]any{"missing": data.MissingMean}, data.MissingMean, false},
+		{"median", map[string]any{"missing": data.MissingMedian}, data.MissingMedian, false},
+		{"knn", map[string]any{"missing": data.MissingKNN}, data.MissingKNN, false},
+		{"ignore", map[string]any{"missing": data.MissingIgnore}, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var prediction predictionResponse
+			decode(t, serve(app, json_request(t, http.MethodPost, "/knn", patient(map[string]any{"age": nil, "options": test.options}))), http.StatusAccepted, &prediction)
+
+			if test.ignored {
+				if !slices.Equal(prediction.Ignored, []string{"age"}) || len(prediction.Imputed) > 0 {
+					t.Fatalf("ignored %v and imputed %v, expected age ignored", prediction.Ignored, prediction.Imputed)
+				}
+				return
+			}
+
+			if len(prediction.Imputed) != 1 || prediction.Imputed[0].Field != "age" || prediction.Imputed[0].Method != test.imputed {
+				t.Fatalf("imputed %+v, expected age with %s", prediction.Imputed, test.imputed)
+			}
+
+			if age := prediction.Imputed[0].Value; age < 29 || age > 77 || age != math.Round(age) {
+				t.Fatalf("age imputed as %v, expected a whole age of the training set", age)
+			}
+		})
+	}
+
+	// Only the knn leaves features out of its distances
+	options := map[string]any{"missing": data.MissingIgnore, "model": classifier.ModelLogistic}
+	decode(t, serve(app, json_request(t, http.MethodPost, "/knn", patient(map[string]any{"age": nil, "options": options}))), http.StatusBadRequest, nil)
+}
+
+func TestKNNModels(t *testing.T) {
+	app := new_test_app(t)
+
+	tests := []struct {
+		model   string
+		members int
+	}{
+		{classifier.ModelLogistic, 0},
+		{classifier.ModelNaiveBayes, 0},
+		{classifier.ModelTree, 0},
+		{classifier.ModelMajorityVote, 4},
+		{classifier.ModelSoftVote, 4},
+		{classifier.ModelStacking, 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.model, func(t *testing.T) {
+			options := map[string]any{"model": test.model, "k": 7}
+
+			var prediction predictionResponse
+			decode(t, serve(app, json_request(t, http.MethodPost, "/knn", patient(map[string]any{"options": options}))), http.StatusAccepted, &prediction)
+
+			if prediction.Model != test.model || len(prediction.Members) != test.members || len(prediction.Neighbors) > 0 {
+				t.Fatalf("model %q with %d members and %d neighbors, expected %s with %d members", prediction.Model, len(prediction.Members), len(prediction.Neighbors), test.model, test.members)
+			}
+
+			if prediction.Probability < 0 || prediction.Probability > 1 {
+				t.Fatalf("probability %v", prediction.Probability)
+			}
+		})
+	}
+}
+
+func TestScaler(t *testing.T) {
+	app := new_test_app(t)
+
+	var scaler struct {
+		Features []string `json:"features"`
+		Method   string   `json:"method"`
+		Min      []float64
+		Max      []float64
+	}
+	decode(t, serve(app, json_request(t, http.MethodGet, "/knn/scaler", nil)), http.StatusOK, &scaler)
+
+	// The one-hot columns replace their categorical feature
+	if scaler.Method != data.ScalerMinMax || len(scaler.Features) != len(app.Model().Encoder.Names) || !slices.Contains(scaler.Features, "chest_pain=3") {
+		t.Fatalf("%s scaler over %v", scaler.Method, scaler.Features)
+	}
+
+	if len(scaler.Min) != len(scaler.Features) || len(scaler.Max) != len(scaler.Features) {
+		t.Fatalf("%d min and %d max for %d features", len(scaler.Min), len(scaler.Max), len(scaler.Features))
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"knn/classifier"
+	"net/http"
+)
+
+const (
+	default_importance_repeats = 10
+	max_importance_repeats     = 100
+)
+
+// This function tells which features matter to a model (the default one unless "model" is given):
+// it is fitted on a stratified split of the dataset and every feature is shuffled between the held
+// out rows to see how much the score drops, for example
+// /knn/importance?repeats=20&test_share=0.3&score=auc&model=logistic
+func (app *Config) Importance(write http.ResponseWriter, read *http.Request) {
+	model := app.Model()
+	query := read.URL.Query()
+
+	overrides, possible_error := settingsFromQuery(query)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+	settings := overrides.Resolve(model.Defaults)
+
+	model_name := cmp.Or(query.Get("model"), model.Algorithm)
+	scaler_method := cmp.Or(query.Get("scaler"), model.Scaler.Method)
+	score_name := cmp.Or(query.Get("score"), classifier.ImportanceAccuracy)
+
+	seed, possible_error := querySeed(query)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	test_share, possible_error := queryNumber(query, "test_share", default_test_share)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	repeats, possible_error := queryInteger(query, "repeats", default_importance_repeats)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	if repeats < 1 || repeats > max_importance_repeats {
+		app.errorJSON(write, fmt.Errorf("repeats must be between 1 and %d", max_importance_repeats), http.StatusBadRequest)
+		return
+	}
+
+	report, possible_error := classifier.PermutationImportance(model.Dataset, model_name, scaler_method, settings, score_name, test_share, repeats, seed)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	pay_load := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("%s %s %.3f on %d held out rows, %s matters most", report.Model, report.Score, report.Baseline, report.Samples, report.Features[0].Feature),
+		Data:    report,
+	}
+
+	app.writeJSON(write, http.StatusOK, pay_load)
+}
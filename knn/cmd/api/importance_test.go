@@ -0,0 +1,32 @@
+package main
+
+import (
+	"knn/classifier"
+	"net/http"
+	"testing"
+)
+
+func TestImportance(t *testing.T) {
+	app := new_test_app(t)
+
+	var report classifier.ImportanceReport
+	decode(t, serve(app, json_request(t, http.MethodGet, "/knn/importance?repeats=3&model=logistic", nil)), http.StatusOK, &report)
+
+	if report.Model != classifier.ModelLogistic || report.Repeats != 3 || len(report.Features) != 13 {
+		t.Fatalf("%s report of %d repeats over %d features", report.Model, report.Repeats, len(report.Features))
+	}
+
+	// The features come from the most to the least important
+	for index, feature := range report.Features {
+		if len(feature.Drops) != 3 {
+			t.Errorf("%s has %d drops, expected 3", feature.Feature, len(feature.Drops))
+		}
+		if index > 0 && feature.Mean > report.Features[index-1].Mean {
+			t.Errorf("%s is ranked after %s with a larger drop", feature.Feature, report.Features[index-1].Feature)
+		}
+	}
+
+	for _, query := range []string{"?repeats=0", "?repeats=2.5", "?repeats=101", "?score=luck", "?model=svm"} {
+		decode(t, serve(app, json_request(t, http.MethodGet, "/knn/importance"+query, nil)), http.StatusBadRequest, nil)
+	}
+}
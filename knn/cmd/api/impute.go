@@ -0,0 +1,54 @@
+package main
+
+import (
+	"knn/classifier"
+	"knn/data"
+)
+
+// imputedField is a missing feature of the patient and the value it was given
+type imputedField struct {
+	Field  string  `json:"field"`
+	Value  float64 `json:"value"`
+	Method string  `json:"method"`
+}
+
+// This function fills the missing features of X_to_predict in place and reports them. The knn policy
+// takes the typical value of the k training patients closest on the present features, the other
+// policies take a statistic of the whole training set.
+func (model *Model) impute(X_to_predict []float64, present []bool, policy string, settings classifier.Settings) ([]imputedField, error) {
+	features := model.Dataset.Schema.Features()
+
+	var nearest []classifier.Neighbor
+	if policy == data.MissingKNN {
+		var possible_error error
+		nearest, possible_error = model.KNN.Nearest(model.scale(X_to_predict), model.Encoder.Present(present), settings)
+		if possible_error != nil {
+			return nil, possible_error
+		}
+	}
+
+	var imputed []imputedField
+
+	for feature, column := range features {
+		if present[feature] {
+			continue
+		}
+
+		value, method := 0.0, policy
+
+		if policy == data.MissingKNN {
+			values := make([]float64, len(nearest))
+			for position, neighbor := range nearest {
+				values[position] = model.Dataset.Features[neighbor.Index][feature]
+			}
+			value = column.Typical(values)
+		} else {
+			value, method = model.Imputer.Value(column, feature, policy)
+		}
+
+		X_to_predict[feature] = value
+		imputed = append(imputed, imputedField{Field: column.Field, Value: value, Method: method})
+	}
+
+	return imputed, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+)
+
+const (
+	default_recall_queries = 200
+	max_recall_queries     = 10000
+	recall_noise           = 0.02
+)
+
+// This function reports how many of the exact nearest neighbors the live index finds and how
+// much faster it is than scanning every row. The queries are training rows with a little noise
+// so they look like real patients without being in the training set, for example
+// /knn/index?queries=500&k=5&seed=7
+func (app *Config) IndexRecall(write http.ResponseWriter, read *http.Request) {
+	model := app.Model()
+	query := read.URL.Query()
+
+	overrides, possible_error := settingsFromQuery(query)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+	settings := overrides.Resolve(model.Defaults)
+
+	seed, possible_error := querySeed(query)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	queries, possible_error := queryInteger(query, "queries", default_recall_queries)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	if queries < 1 || queries > max_recall_queries {
+		app.errorJSON(write, fmt.Errorf("queries must be between 1 and %d", max_recall_queries), http.StatusBadRequest)
+		return
+	}
+
+	random := rand.New(rand.NewPCG(seed, seed))
+	X_queries := make([][]float64, queries)
+
+	for position := range X_queries {
+		X_queries[position] = slices.Clone(model.X_scaled[random.IntN(len(model.X_scaled))])
+		for feature := range X_queries[position] {
+			X_queries[position][feature] += random.NormFloat64() * recall_noise
+		}
+	}
+
+	report, possible_error := model.KNN.Recall(X_queries, settings)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	pay_load := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("The %s index finds %.1f%% of the nearest neighbors, %.1fx the speed of a full scan", report.Index.Kind, report.Recall*100, report.Speedup),
+		Data:    report,
+	}
+
+	app.writeJSON(write, http.StatusOK, pay_load)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"knn/classifier"
+	"net/http"
+	"testing"
+)
+
+func TestCreateIndexOptions(t *testing.T) {
+	t.Setenv("KNN_INDEX", classifier.IndexLSH)
+	t.Setenv("KNN_LSH_TABLES", "4")
+	t.Setenv("KNN_LSH_BITS", "16")
+	t.Setenv("KNN_LSH_SEED", "7")
+
+	options, possible_error := createIndexOptions()
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	if options.Kind != classifier.IndexLSH || options.Tables != 4 || options.Bits != 16 || options.Seed != 7 {
+		t.Fatalf("options %+v, expected the lsh index of the environment", options)
+	}
+
+	t.Setenv("KNN_LSH_BITS", "many")
+	_, possible_error = createIndexOptions()
+	if possible_error == nil {
+		t.Fatal("expected an error for the bits")
+	}
+}
+
+func TestIndexRecall(t *testing.T) {
+	app := new_test_app(t)
+
+	tests := []struct {
+		name       string
+		options    classifier.IndexOptions
+		min_recall float64
+	}{
+		{"brute", classifier.IndexOptions{Kind: classifier.IndexBrute}, 1},
+		{"kd tree", classifier.IndexOptions{Kind: classifier.IndexKDTree}, 1},
+		{"ball tree", classifier.IndexOptions{Kind: classifier.IndexBallTree}, 1},
+		{"lsh", classifier.IndexOptions{Kind: classifier.IndexLSH, Tables: 8, Bits: 4, Seed: 1}, 0.5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trained := *app.Model().Artifact
+			trained.Hyperparameters.Index = test.options
+
+			model, possible_error := newModel(&trained)
+			if possible_error != nil {
+				t.Fatal(possible_error)
+			}
+			app.live.Store(model)
+
+			var report classifier.RecallReport
+			decode(t, serve(app, json_request(t, http.MethodGet, "/knn/index?queries=50&k=5", nil)), http.StatusOK, &report)
+
+			if report.Index.Kind != test.options.Kind || report.Queries != 50 || report.K != 5 {
+				t.Fatalf("%s index over %d queries with k=%d", report.Index.Kind, report.Queries, report.K)
+			}
+
+			if report.Recall < test.min_recall || report.Recall > 1 {
+				t.Fatalf("recall %.3f, expected at least %.3f", report.Recall, test.min_recall)
+			}
+		})
+	}
+
+	for _, query := range []string{"?queries=0", "?queries=1.5", "?queries=10001", "?k=-1", "?seed=x"} {
+		decode(t, serve(app, json_request(t, http.MethodGet, "/knn/index"+query, nil)), http.StatusBadRequest, nil)
+	}
+}
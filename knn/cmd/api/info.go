@@ -0,0 +1,80 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"knn/artifact"
+	"knn/classifier"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// modelInfo identifies the live model: the artifact version and checksum, how it answers by
+// default, what it was trained on and how well it did in the cross validation of its training
+type modelInfo struct {
+	Version      string                 `json:"version"`
+	Checksum     string                 `json:"checksum"`
+	CreatedAt    time.Time              `json:"created_at"`
+	Algorithm    string                 `json:"algorithm"`
+	K            int                    `json:"k"`
+	Metric       string                 `json:"metric"`
+	Scaler       string                 `json:"scaler"`
+	Settings     classifier.Settings    `json:"settings"`
+	Index        string                 `json:"index"`
+	Missing      string                 `json:"missing"`
+	Features     []string               `json:"features"`
+	TrainingRows int                    `json:"training_rows"`
+	ClassBalance map[string]int         `json:"class_balance"`
+	Dataset      artifact.DatasetInfo   `json:"dataset"`
+	Evaluation   *classifier.Evaluation `json:"evaluation,omitempty"`
+}
+
+// This function describes the model answering the requests so a verdict can be traced back to it
+func (app *Config) ModelInfo(write http.ResponseWriter, read *http.Request) {
+	model := app.Model()
+	trained := model.Artifact
+	label_column := model.Dataset.Schema.LabelColumn()
+
+	info := modelInfo{
+		Version:      trained.Version,
+		Checksum:     trained.Checksum,
+		CreatedAt:    trained.CreatedAt,
+		Algorithm:    model.Algorithm,
+		K:            model.Defaults.K,
+		Metric:       model.Defaults.Metric,
+		Scaler:       model.Scaler.Method,
+		Settings:     classifier.Settings{}.Resolve(model.Defaults),
+		Index:        model.KNN.Index().Kind,
+		Missing:      model.Missing,
+		Features:     model.Dataset.Schema.FeatureFields(),
+		TrainingRows: len(model.Dataset.Labels),
+		ClassBalance: map[string]int{},
+		Dataset:      trained.Dataset,
+	}
+
+	for _, class := range model.Dataset.Labels {
+		label := cmp.Or(label_column.LabelOf(float64(class)), strconv.Itoa(class))
+		info.ClassBalance[label]++
+	}
+
+	// The metrics of the default algorithm, the artifact has none when it was trained without folds
+	for _, evaluation := range trained.Evaluations {
+		if evaluation.Model == model.Algorithm {
+			info.Evaluation = evaluation
+		}
+	}
+
+	message := fmt.Sprintf("Model %s, %s trained on %d rows", info.Version, info.Algorithm, info.TrainingRows)
+	if info.Evaluation != nil {
+		message += fmt.Sprintf(", cross validated accuracy %.3f", info.Evaluation.Metrics.Accuracy)
+	}
+
+	pay_load := jsonResponse{
+		Error:   false,
+		Message: message,
+		Data:    info,
+	}
+
+	app.writeJSON(write, http.StatusOK, pay_load)
+}
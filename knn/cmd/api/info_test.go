@@ -0,0 +1,50 @@
+package main
+
+import (
+	"knn/classifier"
+	"net/http"
+	"testing"
+)
+
+func TestModelInfo(t *testing.T) {
+	app := new_test_app(t)
+	trained := app.Model().Artifact
+
+	var info modelInfo
+	decode(t, serve(app, json_request(t, http.MethodGet, "/knn/model", nil)), http.StatusOK, &info)
+
+	if info.Version != trained.Version || info.Checksum != trained.Checksum || info.Algorithm != classifier.ModelKNN {
+		t.Fatalf("model %s (%s) answered by %s, expected %s (%s)", info.Version, info.Checksum, info.Algorithm, trained.Version, trained.Checksum)
+	}
+
+	if info.TrainingRows != 303 || info.ClassBalance["Heart disease"]+info.ClassBalance["No heart disease"] != 303 || len(info.Features) != 13 {
+		t.Fatalf("%d rows balanced as %v over %d features", info.TrainingRows, info.ClassBalance, len(info.Features))
+	}
+
+	if info.Evaluation == nil || info.Evaluation.Model != info.Algorithm || info.Index != classifier.IndexBrute {
+		t.Fatalf("evaluation %+v of the %s index", info.Evaluation, info.Index)
+	}
+}
+
+func TestModels(t *testing.T) {
+	app := new_test_app(t)
+
+	var models modelsResponse
+	decode(t, serve(app, json_request(t, http.MethodGet, "/knn/models", nil)), http.StatusOK, &models)
+
+	if models.Default != classifier.ModelKNN || len(models.Features) != len(app.Model().Encoder.Names) {
+		t.Fatalf("default %s over %d features", models.Default, len(models.Features))
+	}
+
+	var names []string
+	for _, description := range models.Models {
+		names = append(names, description.Name)
+		if len(description.Parameters) == 0 {
+			t.Errorf("%s describes no parameters", description.Name)
+		}
+	}
+
+	if len(names) != len(classifier.ModelNames()) {
+		t.Fatalf("models %v, expected %v", names, classifier.ModelNames())
+	}
+}
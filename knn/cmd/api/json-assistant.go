@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"knn/data"
 	"net/http"
 )
 
@@ -83,3 +84,13 @@ func (app *Config) errorJSON(write http.ResponseWriter, possible_error error, st
 	// Write the JSON error response
 	return app.writeJSON(write, statusCode, payload)
 }
+
+// validationJSON sends every invalid field of a request with the Unprocessable Entity (422) status
+func (app *Config) validationJSON(write http.ResponseWriter, validation_error *data.ValidationError) error {
+	var payload jsonResponse
+	payload.Error = true
+	payload.Message = validation_error.Error()
+	payload.Data = validation_error.Fields
+
+	return app.writeJSON(write, http.StatusUnprocessableEntity, payload)
+}
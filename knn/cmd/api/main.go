@@ -1,18 +1,111 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
+	"knn/artifact"
+	"knn/classifier"
+	"knn/data"
+	"knn/drift"
+	"knn/feedback"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
-type Config struct{}
+type Config struct {
+	// live is the model answering the requests, it is replaced as a whole when a better
+	// configuration is promoted or another dataset version is activated so every request
+	// works with one consistent model
+	live atomic.Pointer[Model]
+
+	// store keeps the dataset versions, switching makes the admin switches one at a time
+	store       *artifact.Store
+	switching   sync.Mutex
+	admin_token string
+
+	// outcomes keeps the predictions and the diagnoses clinicians confirmed for them, only the
+	// holders of the clinician token can confirm one
+	outcomes        *feedback.Store
+	clinician_token string
+
+	// drift keeps the last feature values of the predicted patients to compare them with the training set
+	drift *drift.Monitor
+}
 
 const connection_port = "80"
 
+const default_dataset_file = "heart.csv"
+
+const default_data_dir = "datasets"
+
+const default_scaler_method = data.ScalerMinMax
+
+const default_missing_policy = data.MissingReject
+
+const default_algorithm = classifier.ModelKNN
+
+const default_drift_window = 1000
+
+const default_feedback_retention = 100000
+
+const shutdown_timeout = 30 * time.Second
+
 func main() {
+	data_dir := cmp.Or(os.Getenv("KNN_DATA_DIR"), default_data_dir)
+
+	store, possible_error := artifact.OpenStore(data_dir)
+	if possible_error != nil {
+		log.Panic(possible_error)
+	}
+
+	// A clinician can confirm any of the last KNN_FEEDBACK_RETENTION predictions
+	retention, possible_error := strconv.Atoi(cmp.Or(os.Getenv("KNN_FEEDBACK_RETENTION"), strconv.Itoa(default_feedback_retention)))
+	if possible_error != nil || retention < 1 {
+		log.Panicf("KNN_FEEDBACK_RETENTION must be a positive whole number, got %q", os.Getenv("KNN_FEEDBACK_RETENTION"))
+	}
+
+	outcomes, possible_error := feedback.Open(data_dir, retention)
+	if possible_error != nil {
+		log.Panic(possible_error)
+	}
+
+	drift_window, possible_error := strconv.Atoi(cmp.Or(os.Getenv("KNN_DRIFT_WINDOW"), strconv.Itoa(default_drift_window)))
+	if possible_error != nil || drift_window < 1 {
+		log.Panicf("KNN_DRIFT_WINDOW must be a positive whole number, got %q", os.Getenv("KNN_DRIFT_WINDOW"))
+	}
+
+	app := Config{
+		store:           store,
+		admin_token:     os.Getenv("KNN_ADMIN_TOKEN"),
+		outcomes:        outcomes,
+		clinician_token: os.Getenv("KNN_CLINICIAN_TOKEN"),
+		drift:           drift.NewMonitor(drift_window),
+	}
+
+	trained, possible_error := app.loadActive()
+	if possible_error != nil {
+		log.Panicf("Can't load the model: %v", possible_error)
+	}
+
+	model, possible_error := newModel(trained)
+	if possible_error != nil {
+		log.Panicf("Can't prepare the model: %v", possible_error)
+	}
 
-	app := Config{}
+	log.Printf("Serving model %s trained on %d rows of %s, checksum %s", trained.Version, trained.Dataset.Rows, trained.Dataset.Source, trained.Checksum)
+
+	app.live.Store(model)
 
 	// Print a message to the log indicating the service is starting
 	log.Println("Starting knn service on port", connection_port)
@@ -22,8 +115,255 @@ func main() {
 		Handler: app.routes(),
 	}
 
-	possible_error := server.ListenAndServe()
-	if possible_error != nil {
+	// On SIGINT or SIGTERM the requests in flight are answered before the queued predictions are
+	// written, a clinician can then confirm every prediction the service gave
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		<-signals.Done()
+
+		log.Println("Stopping knn service")
+
+		timeout, cancel := context.WithTimeout(context.Background(), shutdown_timeout)
+		defer cancel()
+
+		possible_error := server.Shutdown(timeout)
+		if possible_error != nil {
+			log.Printf("Can't wait for the requests in flight: %v", possible_error)
+		}
+	}()
+
+	possible_error = server.ListenAndServe()
+	if possible_error != nil && !errors.Is(possible_error, http.ErrServerClosed) {
 		log.Panic(possible_error)
 	}
+
+	<-stopped
+
+	possible_error = app.outcomes.Close()
+	if possible_error != nil {
+		log.Panicf("Can't write the queued predictions: %v", possible_error)
+	}
+}
+
+// This function returns the model answering the requests, a request should call it once
+// and keep working with the returned model
+func (app *Config) Model() *Model {
+	return app.live.Load()
+}
+
+// This function returns the artifact of the active dataset version. The artifact of KNN_ARTIFACT
+// (or the one trained without it) becomes a version and is activated when there is no active version
+// yet or when it is a model the store never saw, so deploying a new artifact takes over the versions
+// activated by hand while restarting keeps them.
+func (app *Config) loadActive() (*artifact.Artifact, error) {
+	active, possible_error := app.store.Active()
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	if active != "" && os.Getenv("KNN_ARTIFACT") == "" {
+		ignored := slices.DeleteFunc(slices.Clone(training_variables), func(name string) bool { return os.Getenv(name) == "" })
+		if len(ignored) > 0 {
+			log.Printf("Dataset version %s is active, ignoring %s: set KNN_ARTIFACT or upload a dataset version to change the model", active, strings.Join(ignored, ", "))
+		}
+
+		return app.store.Load(active)
+	}
+
+	trained, possible_error := loadArtifact()
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	versions, possible_error := app.store.Versions()
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	known := slices.ContainsFunc(versions, func(version artifact.Version) bool { return version.Model == trained.Version })
+	if active != "" && known {
+		return app.store.Load(active)
+	}
+
+	version, possible_error := app.store.Add(trained, "deployment", nil)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	_, possible_error = app.store.Activate(version.ID, "deployment", false)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	log.Printf("Dataset version %s of model %s activated by deployment", version.ID, trained.Version)
+
+	return trained, nil
+}
+
+// The variables a model is trained with when there is no KNN_ARTIFACT, they have no effect once a
+// dataset version is active
+var training_variables = []string{
+	"DATASET_FILE", "DATASET_SCHEMA", "KNN_K", "KNN_METRIC", "KNN_MINKOWSKI_P", "KNN_TIE_BREAK",
+	"KNN_WEIGHTING", "KNN_BANDWIDTH", "KNN_SCALER", "KNN_MISSING", "KNN_MODEL", "KNN_INDEX",
+	"KNN_LSH_TABLES", "KNN_LSH_BITS", "KNN_LSH_PROBES", "KNN_LSH_SEED",
+}
+
+// This function reads the artifact written by the train command from KNN_ARTIFACT. Without one the
+// model is trained on DATASET_FILE with the KNN_* settings like the train command would, so a
+// developer can run the service without training first.
+func loadArtifact() (*artifact.Artifact, error) {
+	artifact_file := os.Getenv("KNN_ARTIFACT")
+	if artifact_file != "" {
+		return artifact.Load(artifact_file)
+	}
+
+	// Load the training set once, the service can't answer anything without it
+	dataset_file := os.Getenv("DATASET_FILE")
+	if dataset_file == "" {
+		dataset_file = default_dataset_file
+	}
+
+	log.Printf("KNN_ARTIFACT is not set, training the model on %s", dataset_file)
+
+	schema, possible_error := loadSchema()
+	if possible_error != nil {
+		return nil, fmt.Errorf("can't load dataset schema: %w", possible_error)
+	}
+
+	dataset, possible_error := data.LoadDataset(dataset_file, schema)
+	if possible_error != nil {
+		return nil, fmt.Errorf("can't load dataset %s: %w", dataset_file, possible_error)
+	}
+
+	hyperparameters, possible_error := createHyperparameters()
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	return artifact.Train(dataset, dataset_file, hyperparameters, default_folds, default_seed)
+}
+
+// This function reads how to build the model from the environment
+func createHyperparameters() (artifact.Hyperparameters, error) {
+	hyperparameters := artifact.Hyperparameters{
+		ScalerMethod: cmp.Or(os.Getenv("KNN_SCALER"), default_scaler_method),
+		// Patients with missing features are refused unless KNN_MISSING says how to handle them
+		Missing: cmp.Or(os.Getenv("KNN_MISSING"), default_missing_policy),
+		// The algorithm answering the requests that don't name one
+		Algorithm: cmp.Or(os.Getenv("KNN_MODEL"), default_algorithm),
+	}
+
+	var possible_error error
+
+	hyperparameters.Defaults, possible_error = createDefaults()
+	if possible_error != nil {
+		return hyperparameters, fmt.Errorf("invalid knn settings: %w", possible_error)
+	}
+
+	hyperparameters.Index, possible_error = createIndexOptions()
+	if possible_error != nil {
+		return hyperparameters, fmt.Errorf("invalid index settings: %w", possible_error)
+	}
+
+	return hyperparameters, nil
+}
+
+// This function loads the schema file given in DATASET_SCHEMA or falls back to the heart.csv schema
+func loadSchema() (*data.Schema, error) {
+	schema_file := os.Getenv("DATASET_SCHEMA")
+	if schema_file == "" {
+		return data.DefaultSchema()
+	}
+
+	return data.LoadSchema(schema_file)
+}
+
+// This function reads the default knn settings from the environment, every request can override them
+func createDefaults() (classifier.Settings, error) {
+	defaults := classifier.Settings{
+		K:         3,
+		Metric:    classifier.MetricEuclidean,
+		P:         2,
+		TieBreak:  classifier.TieNearest,
+		Weighting: classifier.WeightUniform,
+	}
+
+	if value := os.Getenv("KNN_K"); value != "" {
+		k, possible_error := strconv.Atoi(value)
+		if possible_error != nil {
+			return defaults, fmt.Errorf("KNN_K must be a whole number: %w", possible_error)
+		}
+		defaults.K = k
+	}
+
+	if value := os.Getenv("KNN_METRIC"); value != "" {
+		defaults.Metric = value
+	}
+
+	if value := os.Getenv("KNN_MINKOWSKI_P"); value != "" {
+		p, possible_error := strconv.ParseFloat(value, 64)
+		if possible_error != nil {
+			return defaults, fmt.Errorf("KNN_MINKOWSKI_P must be a number: %w", possible_error)
+		}
+		defaults.P = p
+	}
+
+	if value := os.Getenv("KNN_TIE_BREAK"); value != "" {
+		defaults.TieBreak = value
+	}
+
+	if value := os.Getenv("KNN_WEIGHTING"); value != "" {
+		defaults.Weighting = value
+	}
+
+	if value := os.Getenv("KNN_BANDWIDTH"); value != "" {
+		bandwidth, possible_error := strconv.ParseFloat(value, 64)
+		if possible_error != nil {
+			return defaults, fmt.Errorf("KNN_BANDWIDTH must be a number: %w", possible_error)
+		}
+		defaults.Bandwidth = bandwidth
+	}
+
+	return defaults, nil
+}
+
+// This function reads the neighbor index from KNN_INDEX and the knobs of the approximate lsh index
+// from KNN_LSH_TABLES, KNN_LSH_BITS, KNN_LSH_PROBES and KNN_LSH_SEED
+func createIndexOptions() (classifier.IndexOptions, error) {
+	options := classifier.DefaultIndexOptions()
+
+	if value := os.Getenv("KNN_INDEX"); value != "" {
+		options.Kind = value
+	}
+
+	for _, knob := range []struct {
+		name  string
+		value *int
+	}{
+		{"KNN_LSH_TABLES", &options.Tables},
+		{"KNN_LSH_BITS", &options.Bits},
+		{"KNN_LSH_PROBES", &options.Probes},
+	} {
+		if value := os.Getenv(knob.name); value != "" {
+			number, possible_error := strconv.Atoi(value)
+			if possible_error != nil {
+				return options, fmt.Errorf("%s must be a whole number: %w", knob.name, possible_error)
+			}
+			*knob.value = number
+		}
+	}
+
+	if value := os.Getenv("KNN_LSH_SEED"); value != "" {
+		seed, possible_error := strconv.ParseUint(value, 10, 64)
+		if possible_error != nil {
+			return options, fmt.Errorf("KNN_LSH_SEED must be a non-negative whole number: %w", possible_error)
+		}
+		options.Seed = seed
+	}
+
+	return options, nil
 }
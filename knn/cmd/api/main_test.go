@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"knn/artifact"
+	"knn/drift"
+	"knn/feedback"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const heart_file = "../../../heart.csv"
+
+const admin_token = "secret"
+
+const clinician_token = "doc"
+
+// The model trained on heart.csv is shared by the tests, training it takes a while
+var heart_artifact struct {
+	once           sync.Once
+	trained        *artifact.Artifact
+	possible_error error
+}
+
+// This function returns a service answering with the model trained on heart.csv, its dataset versions
+// and predictions are kept in a directory of the test
+func new_test_app(t *testing.T) *Config {
+	t.Helper()
+
+	heart_artifact.once.Do(func() {
+		t.Setenv("DATASET_FILE", heart_file)
+		heart_artifact.trained, heart_artifact.possible_error = loadArtifact()
+	})
+	if heart_artifact.possible_error != nil {
+		t.Fatal(heart_artifact.possible_error)
+	}
+
+	directory := t.TempDir()
+
+	store, possible_error := artifact.OpenStore(directory)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	outcomes, possible_error := feedback.Open(directory, 100)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+	t.Cleanup(func() { outcomes.Close() })
+
+	app := &Config{
+		store:           store,
+		admin_token:     admin_token,
+		outcomes:        outcomes,
+		clinician_token: clinician_token,
+		drift:           drift.NewMonitor(50),
+	}
+
+	trained := heart_artifact.trained
+
+	version, possible_error := store.Add(trained, "deployment", nil)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	_, possible_error = store.Activate(version.ID, "deployment", false)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	model, possible_error := newModel(trained)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+	app.live.Store(model)
+
+	return app
+}
+
+// This function returns the features of the first patient of heart.csv as a request payload, a nil
+// change removes the field
+func patient(changes map[string]any) map[string]any {
+	values := map[string]any{
+		"age": 63, "gender": 1, "chest_pain": 3, "resting_blood_pressure": 145, "cholestoral_in_mg": 233,
+		"fasting_blood_sugar": 1, "resting_electrocardiographic_results": 0, "maximum_heart_rate_achieved": 150,
+		"exercise_induced_angina": 0, "previous_peak": 2.3, "slope_of_the_peak_exercise": 0,
+		"number_of_major_vessels": 0, "thalassemia": 1,
+	}
+
+	for field, value := range changes {
+		if value == nil {
+			delete(values, field)
+			continue
+		}
+		values[field] = value
+	}
+
+	return values
+}
+
+// This function builds a request with the json of content as its body, a string is sent as it is
+func json_request(t *testing.T, method string, path string, content any) *http.Request {
+	t.Helper()
+
+	var body io.Reader
+
+	switch content := content.(type) {
+	case nil:
+	case string:
+		body = strings.NewReader(content)
+	default:
+		encoded, possible_error := json.Marshal(content)
+		if possible_error != nil {
+			t.Fatal(possible_error)
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	request := httptest.NewRequest(method, path, body)
+	request.Header.Set("Content-Type", "application/json")
+
+	return request
+}
+
+// This function adds the admin token and name to a request
+func as_admin(request *http.Request) *http.Request {
+	request.Header.Set("Authorization", "Bearer "+admin_token)
+	request.Header.Set(admin_user_header, "ada")
+
+	return request
+}
+
+// This function sends a request through the routes of the service
+func serve(app *Config, request *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	app.routes().ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+// This function checks the status of a json response and decodes its data into data, it returns the
+// message of the response
+func decode(t *testing.T, recorder *httptest.ResponseRecorder, status int, data any) string {
+	t.Helper()
+
+	var response struct {
+		Error   bool            `json:"error"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+
+	possible_error := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if possible_error != nil {
+		t.Fatalf("response %q is not json: %v", recorder.Body.String(), possible_error)
+	}
+
+	if recorder.Code != status || response.Error != (status >= 400) {
+		t.Fatalf("status %d (error %t, %s), expected %d", recorder.Code, response.Error, response.Message, status)
+	}
+
+	if data != nil && len(response.Data) > 0 {
+		possible_error = json.Unmarshal(response.Data, data)
+		if possible_error != nil {
+			t.Fatalf("data %s: %v", response.Data, possible_error)
+		}
+	}
+
+	return response.Message
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"knn/artifact"
+	"knn/classifier"
+	"knn/data"
+	"slices"
+)
+
+// Model holds the artifact it was built from, the training set described by its schema, the
+// encoder and scaler fitted on it, the knn over the scaled rows and the other algorithms fitted
+// on the same rows. It is never modified after creation so all the requests can share it without
+// locking.
+type Model struct {
+	artifact.Hyperparameters
+	Artifact    *artifact.Artifact
+	Dataset     *data.Dataset
+	Encoder     *data.Encoder
+	Scaler      *data.Scaler
+	Imputer     *data.Imputer
+	X_scaled    [][]float64
+	KNN         *classifier.KNN
+	Classifiers map[string]classifier.Model
+	Search      *searchRecord
+}
+
+// This function rebuilds the model of an artifact with the scaler it recorded and fits every
+// algorithm on its rows, the neighbors are found with the index of its hyperparameters built once here
+func newModel(trained *artifact.Artifact) (*Model, error) {
+	dataset := trained.TrainingSet()
+	config := trained.Hyperparameters
+
+	possible_error := config.Validate(len(dataset.Features))
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	// Encode the categorical columns as the schema asks and scale them like at training time
+	encoder := data.NewEncoder(dataset.Schema)
+	scaler := trained.Scaler
+	X_scaled := scaler.TransformAll(encoder.EncodeAll(dataset.Features))
+
+	knn, possible_error := classifier.NewKNN(X_scaled, dataset.Labels, encoder.Categorical()).Indexed(config.Index, config.Defaults)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	// The knn answers with its own settings per request, the other algorithms are fitted once here
+	// as the members of an ensemble that every way of combining them shares. The stacking model is
+	// fitted here too with the default settings, a request only changes the knn member it stacks.
+	ensemble := classifier.NewEnsemble(classifier.ModelStacking, encoder.Categorical(), config.Defaults)
+	possible_error = ensemble.Fit(X_scaled, dataset.Labels)
+	if possible_error != nil {
+		return nil, fmt.Errorf("can't fit ensemble: %w", possible_error)
+	}
+
+	classifiers := ensemble.Members()
+	delete(classifiers, classifier.ModelKNN)
+
+	for _, method := range []string{classifier.ModelMajorityVote, classifier.ModelSoftVote, classifier.ModelStacking} {
+		classifiers[method] = ensemble.As(method)
+	}
+
+	model := &Model{
+		Hyperparameters: config,
+		Artifact:        trained,
+		Dataset:         dataset,
+		Encoder:         encoder,
+		Scaler:          scaler,
+		Imputer:         data.FitImputer(dataset.Features),
+		X_scaled:        X_scaled,
+		KNN:             knn,
+		Classifiers:     classifiers,
+	}
+
+	return model, nil
+}
+
+// This function turns the payload of a request into a prediction, every error is caused by the payload
+func (model *Model) predict(requests_payload requestsPayload) (predictionResponse, error) {
+	algorithm := cmp.Or(requests_payload.Options.Model, model.Algorithm)
+	if algorithm != classifier.ModelKNN && model.Classifiers[algorithm] == nil {
+		return predictionResponse{}, fmt.Errorf("unknown model %q", algorithm)
+	}
+
+	policy := cmp.Or(requests_payload.Options.Missing, model.Missing)
+	if !data.ValidMissingPolicy(policy) {
+		return predictionResponse{}, fmt.Errorf("unknown missing value policy %q", policy)
+	}
+
+	if policy == data.MissingIgnore && algorithm != classifier.ModelKNN {
+		return predictionResponse{}, fmt.Errorf("the %s policy leaves features out of the distances, only the knn model measures distances", policy)
+	}
+
+	// Set the payload as a feature vector in the schema order, missing features are only accepted
+	// when the policy says what to do with them
+	var X_to_predict []float64
+	var present []bool
+	var possible_error error
+
+	if policy == data.MissingReject {
+		X_to_predict, possible_error = model.Dataset.Schema.Vector(requests_payload.Features)
+	} else {
+		X_to_predict, present, possible_error = model.Dataset.Schema.PartialVector(requests_payload.Features)
+	}
+	if possible_error != nil || len(requests_payload.Invalid) > 0 {
+		return predictionResponse{}, merge_invalid(requests_payload.Invalid, possible_error)
+	}
+
+	// Use the service defaults for every setting the request didn't override
+	settings := requests_payload.Options.Settings.Resolve(model.Defaults)
+
+	response := predictionResponse{ModelVersion: model.Artifact.Version}
+
+	if !slices.Contains(present, false) {
+		present = nil
+	} else if policy == data.MissingIgnore {
+		for feature, field := range model.Dataset.Schema.FeatureFields() {
+			if !present[feature] {
+				response.Ignored = append(response.Ignored, field)
+			}
+		}
+	} else {
+		response.Imputed, possible_error = model.impute(X_to_predict, present, policy, settings)
+		if possible_error != nil {
+			return predictionResponse{}, possible_error
+		}
+		present = nil
+	}
+
+	// Encode and scale X_to_predict like the training set was at startup
+	X_scaled_to_predict := model.scale(X_to_predict)
+	encoded_present := model.Encoder.Present(present)
+
+	if algorithm != classifier.ModelKNN {
+		fitted := model.Classifiers[algorithm]
+
+		// The knn member of an ensemble follows the knn settings of the request too
+		ensemble, is_ensemble := fitted.(*classifier.Ensemble)
+		if is_ensemble {
+			fitted = ensemble.WithSettings(settings)
+		}
+
+		return model.predictWith(fitted, X_scaled_to_predict, response)
+	}
+
+	prediction, possible_error := model.KNN.PredictPartial(X_scaled_to_predict, encoded_present, settings)
+	if possible_error != nil {
+		return predictionResponse{}, possible_error
+	}
+
+	prediction.Label = model.Dataset.Schema.LabelColumn().LabelOf(float64(prediction.Class))
+
+	response.Prediction = prediction
+
+	// Show the similar patients behind the result when asked to
+	if requests_payload.Options.Explain {
+		response.Explanation = model.explain(X_scaled_to_predict, encoded_present, prediction)
+	}
+
+	return response, nil
+}
+
+// This function predicts a scaled query with an algorithm other than knn, it has no neighbors to
+// explain but an ensemble shows the verdict of each of its members
+func (model *Model) predictWith(fitted classifier.Model, X_scaled_to_predict []float64, response predictionResponse) (predictionResponse, error) {
+	class, possible_error := fitted.Predict(X_scaled_to_predict)
+	if possible_error != nil {
+		return predictionResponse{}, possible_error
+	}
+
+	probabilities, possible_error := fitted.PredictProba(X_scaled_to_predict)
+	if possible_error != nil {
+		return predictionResponse{}, possible_error
+	}
+
+	response.Prediction = classifier.Prediction{
+		Model:         fitted.Describe().Name,
+		Class:         class,
+		Label:         model.Dataset.Schema.LabelColumn().LabelOf(float64(class)),
+		Probability:   probabilities[classifier.PositiveClass],
+		Probabilities: probabilities,
+	}
+
+	ensemble, is_ensemble := fitted.(*classifier.Ensemble)
+	if is_ensemble {
+		response.Members, possible_error = ensemble.Verdicts(X_scaled_to_predict)
+		if possible_error != nil {
+			return predictionResponse{}, possible_error
+		}
+	}
+
+	return response, nil
+}
+
+// This function encodes a query in schema order and scales it with the scaler fitted on the training set
+func (model *Model) scale(X_to_predict []float64) []float64 {
+	return model.Scaler.Transform(model.Encoder.Encode(X_to_predict))
+}
+
+// This function adds the fields that failed decoding to the schema errors, a field that wasn't
+// a number is only reported as such and not as missing too
+func merge_invalid(invalid []data.FieldError, possible_error error) error {
+	var validation_error *data.ValidationError
+	if possible_error != nil && !errors.As(possible_error, &validation_error) {
+		return possible_error
+	}
+
+	merged := &data.ValidationError{Fields: slices.Clone(invalid)}
+
+	if validation_error != nil {
+		for _, field_error := range validation_error.Fields {
+			decoded := !slices.ContainsFunc(invalid, func(failed data.FieldError) bool { return failed.Field == field_error.Field })
+			if decoded {
+				merged.Fields = append(merged.Fields, field_error)
+			}
+		}
+	}
+
+	return merged
+}
@@ -24,6 +24,33 @@ func (app *Config) routes() http.Handler {
 	mux.Use(middleware.Heartbeat("/ping"))
 
 	mux.Post("/knn", app.KNN)
+	mux.Post("/knn/batch", app.KNNBatch)
+	mux.Get("/knn/scaler", app.Scaler)
+	mux.Get("/knn/evaluation", app.Evaluation)
+	mux.Get("/knn/search", app.LastSearch)
+	mux.Get("/knn/index", app.IndexRecall)
+	mux.Get("/knn/model", app.ModelInfo)
+	mux.Get("/knn/models", app.Models)
+	mux.Get("/knn/importance", app.Importance)
+	mux.Post("/knn/counterfactuals", app.Counterfactuals)
+	mux.With(app.requireClinician).Post("/knn/feedback", app.Feedback)
+	mux.Get("/knn/feedback/accuracy", app.FeedbackAccuracy)
+	mux.Get("/knn/drift", app.Drift)
+
+	// A search cross validates every configuration so only the admins can run one, and make its
+	// best configuration the live model
+	mux.With(app.requireAdmin).Post("/knn/search", app.Search)
+
+	// The admins manage the training set versions
+	mux.Route("/knn/admin/datasets", func(admin chi.Router) {
+		admin.Use(app.requireAdmin)
+		admin.Get("/", app.Datasets)
+		admin.Post("/", app.UploadDataset)
+		admin.Get("/history", app.DatasetHistory)
+		admin.Post("/rollback", app.RollbackDataset)
+		admin.Post("/fold", app.FoldFeedback)
+		admin.Post("/{version}/activate", app.ActivateDataset)
+	})
 
 	return mux
 }
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"knn/artifact"
+	"knn/classifier"
+	"log"
+	"net/http"
+	"time"
+)
+
+// searchPayload describes a hyperparameter search, the empty fields use the defaults
+type searchPayload struct {
+	Strategy  string                  `json:"strategy"`
+	Trials    int                     `json:"trials"`
+	Objective string                  `json:"objective"`
+	Folds     int                     `json:"folds"`
+	Seed      *uint64                 `json:"seed"`
+	Space     *classifier.SearchSpace `json:"space"`
+	Promote   bool                    `json:"promote"`
+}
+
+// searchRecord keeps the search that chose the configuration of the live model
+type searchRecord struct {
+	PromotedAt       time.Time                `json:"promoted_at"`
+	PreviousScaler   string                   `json:"previous_scaler"`
+	PreviousSettings classifier.Settings      `json:"previous_settings"`
+	Result           *classifier.SearchResult `json:"result"`
+}
+
+// This function runs a grid or random search over k, metric, weighting and scaler with cross
+// validation and ranks the configurations. With "promote" the best one becomes the live model.
+func (app *Config) Search(write http.ResponseWriter, read *http.Request) {
+	var search_payload searchPayload
+
+	possible_error := app.readJSON(write, read, &search_payload)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	admin, _ := adminOf(read)
+
+	if search_payload.Strategy == "" {
+		search_payload.Strategy = classifier.SearchGrid
+	}
+	if search_payload.Objective == "" {
+		search_payload.Objective = "accuracy"
+	}
+	if search_payload.Folds == 0 {
+		search_payload.Folds = default_folds
+	}
+
+	seed := uint64(default_seed)
+	if search_payload.Seed != nil {
+		seed = *search_payload.Seed
+	}
+
+	space := classifier.DefaultSearchSpace()
+	if search_payload.Space != nil {
+		space = *search_payload.Space
+	}
+
+	model := app.Model()
+
+	result, possible_error := classifier.Search(model.Dataset, space, search_payload.Strategy, search_payload.Trials, search_payload.Objective, search_payload.Folds, seed)
+	if possible_error != nil {
+		app.errorJSON(write, possible_error, http.StatusBadRequest)
+		return
+	}
+
+	best := result.Best
+	message := fmt.Sprintf("Best of %d configurations: %s scaler, %s metric, %s weighting, k=%d with %s %.3f",
+		len(result.Candidates), best.Scaler, best.Settings.Metric, best.Settings.Weighting, best.Settings.K, result.Objective, best.Score)
+
+	if search_payload.Promote {
+		change, possible_error := app.promote(model, result, admin)
+		if errors.Is(possible_error, errLiveModelChanged) {
+			app.errorJSON(write, possible_error, http.StatusConflict)
+			return
+		}
+		if possible_error != nil {
+			app.errorJSON(write, possible_error, http.StatusInternalServerError)
+			return
+		}
+		message += fmt.Sprintf(", promoted to the live model as dataset version %s", change.To)
+	}
+
+	pay_load := jsonResponse{
+		Error:   false,
+		Message: message,
+		Data:    result,
+	}
+
+	app.writeJSON(write, http.StatusOK, pay_load)
+}
+
+// This function returns the search that chose the configuration of the live model
+func (app *Config) LastSearch(write http.ResponseWriter, read *http.Request) {
+	model := app.Model()
+
+	if model.Search == nil {
+		app.errorJSON(write, errors.New("the live model uses the configured defaults, no search was promoted"), http.StatusNotFound)
+		return
+	}
+
+	pay_load := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Live configuration promoted at %s", model.Search.PromotedAt.Format(time.RFC3339)),
+		Data:    model.Search,
+	}
+
+	app.writeJSON(write, http.StatusOK, pay_load)
+}
+
+// errLiveModelChanged is returned when another model went live while a search was running
+var errLiveModelChanged = errors.New("the live model changed during the search, run it again")
+
+// This function keeps the rows of the searched model trained with the best configuration of the
+// search as a new dataset version and activates it like an admin would, it fails if the live model
+// changed while the search was running
+func (app *Config) promote(searched *Model, result *classifier.SearchResult, admin string) (artifact.Switch, error) {
+	best := result.Best
+
+	config := searched.Hyperparameters
+	config.ScalerMethod = best.Scaler
+	config.Defaults = best.Settings
+
+	trained, possible_error := artifact.Train(searched.Dataset, searched.Artifact.Dataset.Source, config, default_folds, default_seed)
+	if possible_error != nil {
+		return artifact.Switch{}, possible_error
+	}
+
+	promoted, possible_error := newModel(trained)
+	if possible_error != nil {
+		return artifact.Switch{}, possible_error
+	}
+
+	promoted.Search = &searchRecord{
+		PromotedAt:       time.Now().UTC(),
+		PreviousScaler:   searched.Scaler.Method,
+		PreviousSettings: searched.Defaults,
+		Result:           result,
+	}
+
+	app.switching.Lock()
+	defer app.switching.Unlock()
+
+	if app.Model() != searched {
+		return artifact.Switch{}, errLiveModelChanged
+	}
+
+	version, possible_error := app.store.Add(trained, admin, nil)
+	if possible_error != nil {
+		return artifact.Switch{}, possible_error
+	}
+
+	change, possible_error := app.activate(version.ID, admin, false, promoted)
+	if possible_error != nil {
+		return artifact.Switch{}, possible_error
+	}
+
+	log.Printf("Promoted knn configuration %s by %s: %s scaler, settings %+v, %s %.3f", trained.Version, admin, best.Scaler, best.Settings, result.Objective, best.Score)
+
+	return change, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"knn/classifier"
+	"knn/data"
+	"net/http"
+	"testing"
+)
+
+// A search over four configurations, small enough for the tests
+var small_space = classifier.SearchSpace{
+	K:          []int{3, 15},
+	Metrics:    []string{classifier.MetricEuclidean, classifier.MetricManhattan},
+	Weightings: []string{classifier.WeightUniform},
+	Scalers:    []string{data.ScalerMinMax},
+}
+
+func TestSearch(t *testing.T) {
+	app := new_test_app(t)
+
+	var result classifier.SearchResult
+	decode(t, serve(app, as_admin(json_request(t, http.MethodPost, "/knn/search", map[string]any{"space": small_space, "folds": 3}))), http.StatusOK, &result)
+
+	if len(result.Candidates) != 4 || result.Strategy != classifier.SearchGrid || result.Folds != 3 {
+		t.Fatalf("%s search of %d candidates on %d folds, expected a grid of 4 on 3", result.Strategy, len(result.Candidates), result.Folds)
+	}
+
+	for _, candidate := range result.Candidates {
+		if candidate.Score > result.Best.Score {
+			t.Fatalf("candidate %+v beats the best %+v", candidate, result.Best)
+		}
+	}
+
+	// Nothing was promoted, the live model keeps its configured defaults
+	decode(t, serve(app, json_request(t, http.MethodGet, "/knn/search", nil)), http.StatusNotFound, nil)
+}
+
+func TestSearchPromote(t *testing.T) {
+	app := new_test_app(t)
+	searched := app.Model()
+
+	var result classifier.SearchResult
+	decode(t, serve(app, as_admin(json_request(t, http.MethodPost, "/knn/search", map[string]any{"space": small_space, "promote": true}))), http.StatusOK, &result)
+
+	model := app.Model()
+	if model == searched || model.Defaults.K != result.Best.Settings.K || model.Defaults.Metric != result.Best.Settings.Metric {
+		t.Fatalf("live defaults %+v, expected the best configuration %+v", model.Defaults, result.Best.Settings)
+	}
+
+	var record searchRecord
+	decode(t, serve(app, json_request(t, http.MethodGet, "/knn/search", nil)), http.StatusOK, &record)
+
+	if record.Result == nil || record.Result.Best.Score != result.Best.Score || record.PreviousSettings.K != searched.Defaults.K {
+		t.Fatalf("record %+v of the promoted search", record)
+	}
+
+	// The promoted configuration is a dataset version the admins can roll back
+	active, _ := app.store.Active()
+	version, possible_error := app.store.Version(active)
+	if possible_error != nil || version.Model != model.Artifact.Version || version.UploadedBy != "ada" {
+		t.Fatalf("active version %+v (%v), expected the promoted model", version, possible_error)
+	}
+}
+
+func TestSearchRefuses(t *testing.T) {
+	app := new_test_app(t)
+
+	huge := classifier.SearchSpace{
+		K:          make([]int, 1000),
+		Metrics:    make([]string, 1000),
+		Weightings: []string{classifier.WeightUniform},
+		Scalers:    []string{data.ScalerMinMax},
+	}
+
+	tests := []struct {
+		name   string
+		body   any
+		token  string
+		admin  string
+		status int
+	}{
+		{"no token", map[string]any{}, "", "ada", http.StatusUnauthorized},
+		{"wrong token", map[string]any{}, "guess", "ada", http.StatusUnauthorized},
+		{"no admin name", map[string]any{}, admin_token, "", http.StatusUnauthorized},
+		{"unknown strategy", map[string]any{"strategy": "bayes"}, admin_token, "ada", http.StatusBadRequest},
+		{"unknown objective", map[string]any{"objective": "luck", "space": small_space}, admin_token, "ada", http.StatusBadRequest},
+		{"space too large", map[string]any{"space": huge}, admin_token, "ada", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := json_request(t, http.MethodPost, "/knn/search", test.body)
+			request.Header.Set("Authorization", "Bearer "+test.token)
+			request.Header.Set(admin_user_header, test.admin)
+
+			decode(t, serve(app, request), test.status, nil)
+		})
+	}
+
+	// Without a token the search is disabled
+	app.admin_token = ""
+	decode(t, serve(app, as_admin(json_request(t, http.MethodPost, "/knn/search", map[string]any{}))), http.StatusForbidden, nil)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"knn/artifact"
+	"knn/classifier"
+	"knn/data"
+	"log"
+)
+
+// This command trains the model of the knn service and writes it as a versioned artifact: the
+// dataset hash, the schema, the fitted scaler, the hyperparameters, the training rows and the
+// cross validated metrics of every algorithm. The service loads the file given in KNN_ARTIFACT,
+// for example
+//
+//	go run ./cmd/train -dataset ../heart.csv -out knn-model.json -k 5 -metric manhattan
+func main() {
+	dataset_file := flag.String("dataset", "heart.csv", "csv file to train on")
+	schema_file := flag.String("schema", "", "json schema of the csv file, the heart.csv schema when empty")
+	output_file := flag.String("out", "knn-model.json", "artifact file to write")
+	folds := flag.Int("folds", 5, "cross validation folds of the recorded metrics, 0 to skip them")
+	seed := flag.Uint64("seed", 42, "seed of the cross validation folds")
+
+	defaults := classifier.Settings{}
+	index := classifier.DefaultIndexOptions()
+	hyperparameters := artifact.Hyperparameters{}
+
+	flag.StringVar(&hyperparameters.ScalerMethod, "scaler", data.ScalerMinMax, "scaling method: minmax, standard or robust")
+	flag.StringVar(&hyperparameters.Missing, "missing", data.MissingReject, "policy for the missing features of a request")
+	flag.StringVar(&hyperparameters.Algorithm, "model", classifier.ModelKNN, "algorithm answering the requests that don't name one")
+	flag.IntVar(&defaults.K, "k", 3, "number of neighbors")
+	flag.StringVar(&defaults.Metric, "metric", classifier.MetricEuclidean, "distance metric")
+	flag.Float64Var(&defaults.P, "p", 2, "power of the minkowski metric")
+	flag.StringVar(&defaults.TieBreak, "tie-break", classifier.TieNearest, "how a tied vote is broken")
+	flag.StringVar(&defaults.Weighting, "weighting", classifier.WeightUniform, "how the neighbors are weighted")
+	flag.Float64Var(&defaults.Bandwidth, "bandwidth", 0, "bandwidth of the gaussian weighting")
+	flag.StringVar(&index.Kind, "index", index.Kind, "neighbor index: brute, kdtree, balltree or lsh")
+	flag.IntVar(&index.Tables, "lsh-tables", index.Tables, "lsh hash tables")
+	flag.IntVar(&index.Bits, "lsh-bits", index.Bits, "lsh bits per table")
+	flag.IntVar(&index.Probes, "lsh-probes", index.Probes, "lsh extra buckets probed per table")
+	flag.Uint64Var(&index.Seed, "lsh-seed", index.Seed, "seed of the lsh hyperplanes")
+	flag.Parse()
+
+	hyperparameters.Defaults = defaults
+	hyperparameters.Index = index
+
+	schema, possible_error := data.DefaultSchema()
+	if *schema_file != "" {
+		schema, possible_error = data.LoadSchema(*schema_file)
+	}
+	if possible_error != nil {
+		log.Panicf("Can't load dataset schema: %v", possible_error)
+	}
+
+	dataset, possible_error := data.LoadDataset(*dataset_file, schema)
+	if possible_error != nil {
+		log.Panicf("Can't load dataset %s: %v", *dataset_file, possible_error)
+	}
+
+	trained, possible_error := artifact.Train(dataset, *dataset_file, hyperparameters, *folds, *seed)
+	if possible_error != nil {
+		log.Panicf("Can't train the model: %v", possible_error)
+	}
+
+	possible_error = trained.Save(*output_file)
+	if possible_error != nil {
+		log.Panic(possible_error)
+	}
+
+	fmt.Printf("model %s written to %s\n", trained.Version, *output_file)
+	fmt.Printf("dataset %s: %d rows, sha256 %s\n", trained.Dataset.Source, trained.Dataset.Rows, trained.Dataset.SHA256)
+	fmt.Printf("checksum %s\n", trained.Checksum)
+
+	if len(trained.Evaluations) > 0 {
+		fmt.Printf("\n%-14s %9s %9s %9s\n", "model", "accuracy", "f1", "auc")
+		for _, evaluation := range trained.Evaluations {
+			fmt.Printf("%-14s %9.3f %9.3f %9.3f\n", evaluation.Model, evaluation.Metrics.Accuracy, evaluation.Metrics.F1, evaluation.Metrics.AUC)
+		}
+	}
+}
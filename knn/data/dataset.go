@@ -0,0 +1,242 @@
+package data
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The number of cell errors printed in the error message, the rest are only counted
+const max_reported_errors = 10
+
+// Dataset is a typed copy of a csv file described by a schema
+type Dataset struct {
+	Schema   *Schema
+	Features [][]float64
+	Labels   []int
+}
+
+// CellError describes a value of the csv file that doesn't match the schema
+type CellError struct {
+	Row    int    `json:"row"`
+	Column string `json:"column"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+func (cell_error CellError) Error() string {
+	return fmt.Sprintf("row %d column %s value %q %s", cell_error.Row, cell_error.Column, cell_error.Value, cell_error.Reason)
+}
+
+// DatasetError collects every cell error found while reading a dataset
+type DatasetError struct {
+	Cells []CellError
+}
+
+func (dataset_error *DatasetError) Error() string {
+	var messages []string
+
+	for index, cell_error := range dataset_error.Cells {
+		if index == max_reported_errors {
+			messages = append(messages, fmt.Sprintf("and %d more", len(dataset_error.Cells)-index))
+			break
+		}
+		messages = append(messages, cell_error.Error())
+	}
+
+	return fmt.Sprintf("dataset has %d invalid values: %s", len(dataset_error.Cells), strings.Join(messages, "; "))
+}
+
+// This function opens the csv file and reads it with the given schema
+func LoadDataset(file_name string, schema *Schema) (*Dataset, error) {
+	csv_file, possible_error := os.Open(file_name)
+	if possible_error != nil {
+		return nil, fmt.Errorf("can't open dataset: %w", possible_error)
+	}
+	// Ensure the file is closed once the function returns
+	defer csv_file.Close()
+
+	return ReadDataset(csv_file, schema)
+}
+
+// This function reads csv content with a header row and converts every column declared
+// in the schema, the columns are matched by their header name so their order doesn't matter
+func ReadDataset(input io.Reader, schema *Schema) (*Dataset, error) {
+	reader := csv.NewReader(input)
+
+	header, possible_error := reader.Read()
+	if possible_error != nil {
+		return nil, fmt.Errorf("can't read dataset header: %w", possible_error)
+	}
+
+	// Find where each schema column is in the csv file
+	positions := map[string]int{}
+	for index, name := range header {
+		positions[strings.TrimSpace(name)] = index
+	}
+
+	for _, column := range schema.Columns {
+		if _, found := positions[column.Name]; !found {
+			return nil, fmt.Errorf("dataset is missing column %s", column.Name)
+		}
+	}
+
+	dataset := &Dataset{Schema: schema}
+	features := schema.Features()
+	label := schema.LabelColumn()
+	var cell_errors []CellError
+
+	// The header is row 1 so the data starts at row 2, like in a spreadsheet
+	for row_number := 2; ; row_number++ {
+		row, possible_error := reader.Read()
+		if possible_error == io.EOF {
+			break
+		}
+		if possible_error != nil {
+			return nil, fmt.Errorf("can't read dataset row %d: %w", row_number, possible_error)
+		}
+
+		vector := make([]float64, len(features))
+		valid := true
+
+		for index, column := range features {
+			value, cell_error := parse_cell(row, positions[column.Name], column, row_number)
+			if cell_error != nil {
+				cell_errors = append(cell_errors, *cell_error)
+				valid = false
+				continue
+			}
+			vector[index] = value
+		}
+
+		label_value, cell_error := parse_cell(row, positions[label.Name], label, row_number)
+		if cell_error != nil {
+			cell_errors = append(cell_errors, *cell_error)
+			valid = false
+		}
+
+		if valid {
+			dataset.Features = append(dataset.Features, vector)
+			dataset.Labels = append(dataset.Labels, int(label_value))
+		}
+	}
+
+	if len(cell_errors) > 0 {
+		return nil, &DatasetError{Cells: cell_errors}
+	}
+
+	if len(dataset.Features) == 0 {
+		return nil, fmt.Errorf("dataset has no rows")
+	}
+
+	return dataset, nil
+}
+
+// This function converts one csv cell into a number and checks it against its column
+func parse_cell(row []string, position int, column Column, row_number int) (float64, *CellError) {
+	raw := strings.TrimSpace(row[position])
+
+	value, possible_error := strconv.ParseFloat(raw, 64)
+	if possible_error != nil {
+		return 0, &CellError{Row: row_number, Column: column.Name, Value: raw, Reason: "is not a number"}
+	}
+
+	possible_error = column.Check(value)
+	if possible_error != nil {
+		return 0, &CellError{Row: row_number, Column: column.Name, Value: raw, Reason: possible_error.Error()}
+	}
+
+	return value, nil
+}
+
+// Record is one row of a csv file of patients converted to values keyed by json field name,
+// a row with invalid cells keeps its errors instead of failing the whole file
+type Record struct {
+	Row    int
+	Values map[string]float64
+	Errors []CellError
+}
+
+// This function reads csv content with the same columns as the dataset, the label column is
+// optional and ignored so files of new patients can be read too
+func ReadRecords(input io.Reader, schema *Schema) ([]Record, error) {
+	reader := csv.NewReader(input)
+
+	header, possible_error := reader.Read()
+	if possible_error != nil {
+		return nil, fmt.Errorf("can't read csv header: %w", possible_error)
+	}
+
+	positions := map[string]int{}
+	for index, name := range header {
+		positions[strings.TrimSpace(name)] = index
+	}
+
+	features := schema.Features()
+	for _, column := range features {
+		if _, found := positions[column.Name]; !found {
+			return nil, fmt.Errorf("csv is missing column %s", column.Name)
+		}
+	}
+
+	var records []Record
+
+	for row_number := 2; ; row_number++ {
+		row, possible_error := reader.Read()
+		if possible_error == io.EOF {
+			break
+		}
+		if possible_error != nil {
+			return nil, fmt.Errorf("can't read csv row %d: %w", row_number, possible_error)
+		}
+
+		record := Record{Row: row_number, Values: map[string]float64{}}
+
+		for _, column := range features {
+			value, cell_error := parse_cell(row, positions[column.Name], column, row_number)
+			if cell_error != nil {
+				record.Errors = append(record.Errors, *cell_error)
+				continue
+			}
+			record.Values[column.Field] = value
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// This function writes the dataset as csv content with the columns of its schema in order,
+// ReadDataset reads it back to the same rows
+func WriteDataset(output io.Writer, dataset *Dataset) error {
+	writer := csv.NewWriter(output)
+
+	var header []string
+	for _, column := range dataset.Schema.Columns {
+		header = append(header, column.Name)
+	}
+	writer.Write(header)
+
+	for index, row := range dataset.Features {
+		line := make([]string, 0, len(header))
+		feature := 0
+
+		for _, column := range dataset.Schema.Columns {
+			if column.Name == dataset.Schema.Label {
+				line = append(line, strconv.Itoa(dataset.Labels[index]))
+				continue
+			}
+			line = append(line, strconv.FormatFloat(row[feature], 'g', -1, 64))
+			feature++
+		}
+
+		writer.Write(line)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
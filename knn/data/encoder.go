@@ -0,0 +1,124 @@
+package data
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// The supported encodings of a categorical column, without one the code is used as a number
+const (
+	EncodingNone    = ""
+	EncodingOneHot  = "onehot"
+	EncodingOrdinal = "ordinal"
+)
+
+// Encoder turns a feature vector in schema order into the vector the distances are measured on.
+// A one-hot column becomes one 0/1 feature per value so every pair of different codes is equally
+// far apart, an ordinal column becomes the position of its value in the order listed by the schema.
+// It is built once from the schema and applied the same way to the training set and to every query.
+type Encoder struct {
+	Names       []string `json:"names"`
+	columns     []Column
+	categorical []bool
+	sources     []int
+}
+
+// This function builds the encoder of the schema feature columns
+func NewEncoder(schema *Schema) *Encoder {
+	encoder := &Encoder{columns: schema.Features()}
+
+	for feature, column := range encoder.columns {
+		if column.Encoding == EncodingOneHot {
+			for _, value := range column.Values {
+				encoder.Names = append(encoder.Names, column.Field+"="+strconv.FormatFloat(value, 'g', -1, 64))
+				encoder.categorical = append(encoder.categorical, true)
+				encoder.sources = append(encoder.sources, feature)
+			}
+			continue
+		}
+
+		// An ordinal column is ordered so its positions are measured like numbers
+		encoder.Names = append(encoder.Names, column.Field)
+		encoder.categorical = append(encoder.categorical, column.Type == TypeCategorical && column.Encoding != EncodingOrdinal)
+		encoder.sources = append(encoder.sources, feature)
+	}
+
+	return encoder
+}
+
+// This function encodes one feature vector in schema order
+func (encoder *Encoder) Encode(vector []float64) []float64 {
+	encoded := make([]float64, 0, len(encoder.Names))
+
+	for feature, column := range encoder.columns {
+		value := vector[feature]
+
+		switch column.Encoding {
+		case EncodingOneHot:
+			for _, category := range column.Values {
+				if value == category {
+					encoded = append(encoded, 1)
+				} else {
+					encoded = append(encoded, 0)
+				}
+			}
+		case EncodingOrdinal:
+			position := -1.0
+			for index, category := range column.Values {
+				if value == category {
+					position = float64(index)
+				}
+			}
+			encoded = append(encoded, position)
+		default:
+			encoded = append(encoded, value)
+		}
+	}
+
+	return encoded
+}
+
+// This function encodes every row of X
+func (encoder *Encoder) EncodeAll(X [][]float64) [][]float64 {
+	encoded := make([][]float64, len(X))
+
+	for index, row := range X {
+		encoded[index] = encoder.Encode(row)
+	}
+
+	return encoded
+}
+
+// This function marks which encoded features are categorical, the one-hot indicators are
+func (encoder *Encoder) Categorical() []bool {
+	return encoder.categorical
+}
+
+// This function expands a mask of the schema features to the encoded features, nil stays nil
+func (encoder *Encoder) Present(present []bool) []bool {
+	if present == nil {
+		return nil
+	}
+
+	expanded := make([]bool, len(encoder.sources))
+	for index, source := range encoder.sources {
+		expanded[index] = present[source]
+	}
+
+	return expanded
+}
+
+// This function checks the encoding of a column can be applied to it
+func check_encoding(column Column) error {
+	switch column.Encoding {
+	case EncodingNone:
+		return nil
+	case EncodingOneHot, EncodingOrdinal:
+		if column.Type != TypeCategorical {
+			return fmt.Errorf("column %s must be categorical to use the %s encoding", column.Name, column.Encoding)
+		}
+		return nil
+	default:
+		return fmt.Errorf("column %s has unknown encoding %q", column.Name, column.Encoding)
+	}
+}
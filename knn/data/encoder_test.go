@@ -0,0 +1,77 @@
+package data
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEncoder(t *testing.T) {
+	schema, possible_error := parseSchema([]byte(`{
+		"label": "target",
+		"columns": [
+			{"name": "age", "field": "age", "type": "int"},
+			{"name": "cp", "field": "chest_pain", "type": "categorical", "values": [0, 1, 2], "encoding": "onehot"},
+			{"name": "slp", "field": "slope", "type": "categorical", "values": [2, 0, 1], "encoding": "ordinal"},
+			{"name": "sex", "field": "gender", "type": "categorical", "values": [0, 1]},
+			{"name": "target", "field": "target", "type": "categorical", "values": [0, 1]}
+		]
+	}`))
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	encoder := NewEncoder(schema)
+
+	names := []string{"age", "chest_pain=0", "chest_pain=1", "chest_pain=2", "slope", "gender"}
+	if !slices.Equal(encoder.Names, names) {
+		t.Fatalf("names %v, expected %v", encoder.Names, names)
+	}
+
+	categorical := []bool{false, true, true, true, false, true}
+	if !slices.Equal(encoder.Categorical(), categorical) {
+		t.Fatalf("categorical %v, expected %v", encoder.Categorical(), categorical)
+	}
+
+	tests := []struct {
+		vector   []float64
+		expected []float64
+	}{
+		{[]float64{63, 0, 2, 1}, []float64{63, 1, 0, 0, 0, 1}},
+		{[]float64{41, 2, 0, 0}, []float64{41, 0, 0, 1, 1, 0}},
+		{[]float64{50, 1, 1, 1}, []float64{50, 0, 1, 0, 2, 1}},
+	}
+
+	for _, test := range tests {
+		if encoded := encoder.Encode(test.vector); !slices.Equal(encoded, test.expected) {
+			t.Errorf("%v encoded to %v, expected %v", test.vector, encoded, test.expected)
+		}
+	}
+
+	present := encoder.Present([]bool{true, false, true, true})
+	if expected := []bool{true, false, false, false, true, true}; !slices.Equal(present, expected) {
+		t.Fatalf("present %v, expected %v", present, expected)
+	}
+	if encoder.Present(nil) != nil {
+		t.Fatal("no mask must stay no mask")
+	}
+}
+
+func TestEncodingRefused(t *testing.T) {
+	tests := []struct {
+		name   string
+		column string
+	}{
+		{"one-hot number", `{"name": "age", "field": "age", "type": "int", "encoding": "onehot"}`},
+		{"ordinal number", `{"name": "age", "field": "age", "type": "float", "encoding": "ordinal"}`},
+		{"unknown encoding", `{"name": "cp", "field": "chest_pain", "type": "categorical", "values": [0, 1], "encoding": "binary"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, possible_error := parseSchema([]byte(`{"label": "target", "columns": [` + test.column + `, {"name": "target", "field": "target", "type": "int"}]}`))
+			if possible_error == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
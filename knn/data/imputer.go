@@ -0,0 +1,121 @@
+package data
+
+import (
+	"math"
+	"slices"
+)
+
+// The supported ways to handle a missing feature: refuse the request, fill the feature with a
+// statistic of the training set or with the values of the most similar patients, or leave it
+// out of the distances
+const (
+	MissingReject = "reject"
+	MissingMean   = "mean"
+	MissingMedian = "median"
+	MissingMode   = "mode"
+	MissingKNN    = "knn"
+	MissingIgnore = "ignore"
+)
+
+// This function checks the missing value policy is one we know how to apply
+func ValidMissingPolicy(policy string) bool {
+	switch policy {
+	case MissingReject, MissingMean, MissingMedian, MissingMode, MissingKNN, MissingIgnore:
+		return true
+	default:
+		return false
+	}
+}
+
+// Imputer holds the statistics of every feature of the training set used to fill missing values,
+// they are in the original units of the dataset
+type Imputer struct {
+	Mean   []float64 `json:"mean"`
+	Median []float64 `json:"median"`
+	Mode   []float64 `json:"mode"`
+}
+
+// This function learns the mean, median and most frequent value of every feature of X
+func FitImputer(X [][]float64) *Imputer {
+	features := len(X[0])
+	imputer := &Imputer{
+		Mean:   make([]float64, features),
+		Median: make([]float64, features),
+		Mode:   make([]float64, features),
+	}
+
+	column := make([]float64, len(X))
+
+	for feature := 0; feature < features; feature++ {
+		for row := range X {
+			column[row] = X[row][feature]
+			imputer.Mean[feature] += X[row][feature] / float64(len(X))
+		}
+
+		imputer.Mode[feature] = mode(column)
+
+		slices.Sort(column)
+		imputer.Median[feature] = quantile(column, 0.5)
+	}
+
+	return imputer
+}
+
+// This function returns the value filling the feature of the column with the policy and the policy
+// really used: a category has no mean or median so categorical columns always get the mode
+func (imputer *Imputer) Value(column Column, feature int, policy string) (float64, string) {
+	if column.Type == TypeCategorical {
+		return imputer.Mode[feature], MissingMode
+	}
+
+	switch policy {
+	case MissingMedian:
+		return column.Round(imputer.Median[feature]), MissingMedian
+	case MissingMode:
+		return imputer.Mode[feature], MissingMode
+	default:
+		return column.Round(imputer.Mean[feature]), MissingMean
+	}
+}
+
+// This function returns the typical value of a group of values of the column, the most frequent
+// one for a category and the mean otherwise
+func (column Column) Typical(values []float64) float64 {
+	if column.Type == TypeCategorical {
+		return mode(values)
+	}
+
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+
+	return column.Round(sum / float64(len(values)))
+}
+
+// This function rounds a value of a whole number column so a filled value looks like a real one
+func (column Column) Round(value float64) float64 {
+	if column.Type == TypeFloat {
+		return value
+	}
+
+	return math.Round(value)
+}
+
+// This function returns the most frequent value, the first one seen wins a tie
+func mode(values []float64) float64 {
+	counts := map[float64]int{}
+	for _, value := range values {
+		counts[value]++
+	}
+
+	// Going through the values again in their order finds the first one seen among the most frequent
+	best, best_count := 0.0, 0
+	for _, value := range values {
+		if counts[value] > best_count {
+			best, best_count = value, counts[value]
+		}
+	}
+
+	return best
+}
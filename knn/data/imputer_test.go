@@ -0,0 +1,110 @@
+package data
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []float64
+		expected float64
+	}{
+		{"single value", []float64{4}, 4},
+		{"most frequent", []float64{1, 2, 2, 3}, 2},
+		{"tie goes to the first seen", []float64{1, 2, 2, 1}, 1},
+		{"tie reached later by the first seen", []float64{3, 1, 1, 3, 2}, 3},
+		{"every value once", []float64{5, 4, 3}, 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if found := mode(test.values); found != test.expected {
+				t.Fatalf("mode of %v is %v, expected %v", test.values, found, test.expected)
+			}
+		})
+	}
+}
+
+func TestImputerValue(t *testing.T) {
+	// The first feature is 1, 2, 2 and 7, the second one is a category
+	imputer := FitImputer([][]float64{{1, 0}, {2, 1}, {2, 1}, {7, 0}})
+
+	whole := Column{Field: "age", Type: TypeInt}
+	decimal := Column{Field: "previous_peak", Type: TypeFloat}
+	category := Column{Field: "gender", Type: TypeCategorical}
+
+	tests := []struct {
+		name     string
+		column   Column
+		feature  int
+		policy   string
+		expected float64
+		used     string
+	}{
+		{"mean of a float", decimal, 0, MissingMean, 3, MissingMean},
+		{"median of a float", decimal, 0, MissingMedian, 2, MissingMedian},
+		{"mode of a float", decimal, 0, MissingMode, 2, MissingMode},
+		{"knn falls back to the mean", decimal, 0, MissingKNN, 3, MissingMean},
+		{"mean of a whole number is rounded", whole, 0, MissingMean, 3, MissingMean},
+		{"a category always gets the mode", category, 1, MissingMean, 0, MissingMode},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, used := imputer.Value(test.column, test.feature, test.policy)
+			if math.Abs(value-test.expected) > 1e-12 || used != test.used {
+				t.Fatalf("filled %v with %s, expected %v with %s", value, used, test.expected, test.used)
+			}
+		})
+	}
+}
+
+func TestTypical(t *testing.T) {
+	tests := []struct {
+		name     string
+		column   Column
+		values   []float64
+		expected float64
+	}{
+		{"mean of a float", Column{Type: TypeFloat}, []float64{1, 2, 4}, 7.0 / 3},
+		{"rounded mean of a whole number", Column{Type: TypeInt}, []float64{1, 2, 4}, 2},
+		{"mode of a category", Column{Type: TypeCategorical}, []float64{3, 1, 3}, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if typical := test.column.Typical(test.values); math.Abs(typical-test.expected) > 1e-12 {
+				t.Fatalf("typical value of %v is %v, expected %v", test.values, typical, test.expected)
+			}
+		})
+	}
+}
+
+func TestPartialVector(t *testing.T) {
+	schema, possible_error := DefaultSchema()
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	values := patient(map[string]float64{"age": math.NaN(), "thalassemia": math.NaN()})
+
+	vector, present, possible_error := schema.PartialVector(values)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	for index, column := range schema.Features() {
+		missing := column.Field == "age" || column.Field == "thalassemia"
+		if present[index] == missing || (missing && vector[index] != 0) || (!missing && vector[index] != values[column.Field]) {
+			t.Errorf("%s is %v and present %v", column.Field, vector[index], present[index])
+		}
+	}
+
+	// A missing field is allowed but an invalid one is still refused
+	_, _, possible_error = schema.PartialVector(patient(map[string]float64{"age": math.NaN(), "chest_pain": 7}))
+	if possible_error == nil {
+		t.Fatal("expected an error for an invalid chest pain")
+	}
+}
@@ -0,0 +1,98 @@
+package data
+
+import (
+	"fmt"
+	"math"
+)
+
+// The ways a modifiable column can be moved, an empty direction allows both
+const (
+	DirectionDecrease = "decrease"
+	DirectionIncrease = "increase"
+)
+
+// Modifiable is the range a patient can realistically move a column to with treatment or a change
+// of lifestyle, searched every Step, and the healthy direction to move it. A categorical column can
+// move to any of its values in that direction and needs no range.
+type Modifiable struct {
+	Min       float64 `json:"min,omitempty"`
+	Max       float64 `json:"max,omitempty"`
+	Step      float64 `json:"step,omitempty"`
+	Direction string  `json:"direction,omitempty"`
+}
+
+// This function makes sure the modifiable range of a column can be searched and stays within the column
+func check_modifiable(column Column) error {
+	modifiable := column.Modifiable
+	if modifiable == nil {
+		return nil
+	}
+
+	switch modifiable.Direction {
+	case "", DirectionDecrease, DirectionIncrease:
+	default:
+		return fmt.Errorf("column %s has unknown modifiable direction %q", column.Name, modifiable.Direction)
+	}
+
+	if column.Type == TypeCategorical {
+		return nil
+	}
+
+	if modifiable.Step <= 0 || modifiable.Min > modifiable.Max {
+		return fmt.Errorf("column %s must have a positive step and min at most max to be modifiable", column.Name)
+	}
+
+	if column.Check(modifiable.Min) != nil || column.Check(modifiable.Max) != nil {
+		return fmt.Errorf("column %s has a modifiable range outside of its allowed values", column.Name)
+	}
+
+	if column.Type == TypeInt && modifiable.Step != math.Trunc(modifiable.Step) {
+		return fmt.Errorf("column %s must have a whole modifiable step", column.Name)
+	}
+
+	return nil
+}
+
+// This function returns the values a modifiable column can be moved to from the given value in its
+// direction, nothing if it can't be changed
+func (column Column) Candidates(from float64) []float64 {
+	if column.Modifiable == nil {
+		return nil
+	}
+
+	var values []float64
+	if column.Type == TypeCategorical {
+		values = column.Values
+	} else {
+		for step := 0; ; step++ {
+			value := column.Modifiable.Min + float64(step)*column.Modifiable.Step
+			if value > column.Modifiable.Max {
+				break
+			}
+			values = append(values, column.Round(value))
+		}
+	}
+
+	var candidates []float64
+	for _, value := range values {
+		switch {
+		case value == from:
+		case column.Modifiable.Direction == DirectionDecrease && value > from:
+		case column.Modifiable.Direction == DirectionIncrease && value < from:
+		default:
+			candidates = append(candidates, value)
+		}
+	}
+
+	return candidates
+}
+
+// This function returns how far a change of a modifiable column goes, as a share of its range.
+// Moving a categorical column always counts as one.
+func (column Column) ChangeCost(from float64, to float64) float64 {
+	if column.Type == TypeCategorical || column.Modifiable == nil || column.Modifiable.Max == column.Modifiable.Min {
+		return 1
+	}
+
+	return math.Abs(to-from) / (column.Modifiable.Max - column.Modifiable.Min)
+}
@@ -0,0 +1,66 @@
+package data
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestCandidates(t *testing.T) {
+	pressure := Column{Name: "trtbps", Type: TypeInt, Modifiable: &Modifiable{Min: 100, Max: 140, Step: 10, Direction: DirectionDecrease}}
+	rate := Column{Name: "thalachh", Type: TypeInt, Modifiable: &Modifiable{Min: 100, Max: 140, Step: 10, Direction: DirectionIncrease}}
+	peak := Column{Name: "oldpeak", Type: TypeFloat, Modifiable: &Modifiable{Min: 0, Max: 1, Step: 0.5}}
+	sugar := Column{Name: "fbs", Type: TypeCategorical, Values: []float64{0, 1, 2}, Modifiable: &Modifiable{Direction: DirectionDecrease}}
+	fixed := Column{Name: "age", Type: TypeInt}
+
+	tests := []struct {
+		name     string
+		column   Column
+		from     float64
+		expected []float64
+	}{
+		{"decrease keeps the lower values", pressure, 125, []float64{100, 110, 120}},
+		{"decrease from the bottom", pressure, 100, nil},
+		{"increase keeps the higher values", rate, 120, []float64{130, 140}},
+		{"both directions skip the current value", peak, 0.5, []float64{0, 1}},
+		{"categorical in its direction", sugar, 1, []float64{0}},
+		{"not modifiable", fixed, 50, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if candidates := test.column.Candidates(test.from); !slices.Equal(candidates, test.expected) {
+				t.Fatalf("candidates %v, expected %v", candidates, test.expected)
+			}
+		})
+	}
+
+	if cost := pressure.ChangeCost(130, 110); math.Abs(cost-0.5) > 1e-12 {
+		t.Errorf("cost of half the range is %v", cost)
+	}
+	if cost := sugar.ChangeCost(1, 0); cost != 1 {
+		t.Errorf("cost of a category is %v", cost)
+	}
+}
+
+func TestModifiableRefused(t *testing.T) {
+	tests := []struct {
+		name   string
+		column string
+	}{
+		{"unknown direction", `{"name": "fbs", "field": "fbs", "type": "categorical", "values": [0, 1], "modifiable": {"direction": "down"}}`},
+		{"no step", `{"name": "chol", "field": "chol", "type": "int", "modifiable": {"min": 100, "max": 200}}`},
+		{"min above max", `{"name": "chol", "field": "chol", "type": "int", "modifiable": {"min": 200, "max": 100, "step": 10}}`},
+		{"outside of the column", `{"name": "chol", "field": "chol", "type": "int", "min": 80, "max": 700, "modifiable": {"min": 50, "max": 200, "step": 10}}`},
+		{"decimal step of a whole number", `{"name": "chol", "field": "chol", "type": "int", "modifiable": {"min": 100, "max": 200, "step": 0.5}}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, possible_error := parseSchema([]byte(`{"label": "target", "columns": [` + test.column + `, {"name": "target", "field": "target", "type": "int"}]}`))
+			if possible_error == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
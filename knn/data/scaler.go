@@ -0,0 +1,140 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// The supported scaling methods
+const (
+	ScalerMinMax   = "minmax"
+	ScalerStandard = "standard"
+	ScalerRobust   = "robust"
+)
+
+// Scaler learns per-feature statistics from the training matrix and applies the same
+// transform to the training rows and to every query so both are on the same scale.
+// All the statistics are kept, whatever the method, so they can be audited.
+type Scaler struct {
+	Method string    `json:"method"`
+	Min    []float64 `json:"min"`
+	Max    []float64 `json:"max"`
+	Mean   []float64 `json:"mean"`
+	Std    []float64 `json:"std"`
+	Median []float64 `json:"median"`
+	IQR    []float64 `json:"iqr"`
+}
+
+// This function checks the scaling method name is one we know how to apply
+func ValidScalerMethod(method string) bool {
+	return method == ScalerMinMax || method == ScalerStandard || method == ScalerRobust
+}
+
+// This function fits a scaler of the given method on the columns of X
+func FitScaler(method string, X [][]float64) (*Scaler, error) {
+	if !ValidScalerMethod(method) {
+		return nil, fmt.Errorf("unknown scaler method %q", method)
+	}
+
+	if len(X) == 0 {
+		return nil, fmt.Errorf("can't fit scaler on an empty matrix")
+	}
+
+	features := len(X[0])
+	scaler := &Scaler{
+		Method: method,
+		Min:    make([]float64, features),
+		Max:    make([]float64, features),
+		Mean:   make([]float64, features),
+		Std:    make([]float64, features),
+		Median: make([]float64, features),
+		IQR:    make([]float64, features),
+	}
+
+	column := make([]float64, len(X))
+
+	for feature := 0; feature < features; feature++ {
+		// Copy the column aside so it can be sorted for the quantiles
+		for row := range X {
+			column[row] = X[row][feature]
+		}
+		scaler.Mean[feature], scaler.Std[feature] = MeanStd(column)
+		slices.Sort(column)
+
+		scaler.Min[feature] = column[0]
+		scaler.Max[feature] = column[len(column)-1]
+		scaler.Median[feature] = quantile(column, 0.5)
+		scaler.IQR[feature] = quantile(column, 0.75) - quantile(column, 0.25)
+	}
+
+	return scaler, nil
+}
+
+// This function scales a single row with the fitted statistics and returns a new slice
+func (scaler *Scaler) Transform(row []float64) []float64 {
+	scaled := make([]float64, len(row))
+
+	for feature, value := range row {
+		var center, spread float64
+
+		switch scaler.Method {
+		case ScalerStandard:
+			center, spread = scaler.Mean[feature], scaler.Std[feature]
+		case ScalerRobust:
+			center, spread = scaler.Median[feature], scaler.IQR[feature]
+		default:
+			center, spread = scaler.Min[feature], scaler.Max[feature]-scaler.Min[feature]
+		}
+
+		// A constant column carries no information, keep it at zero instead of dividing by zero
+		if spread == 0 {
+			continue
+		}
+
+		scaled[feature] = (value - center) / spread
+	}
+
+	return scaled
+}
+
+// This function scales every row of X and returns a new matrix
+func (scaler *Scaler) TransformAll(X [][]float64) [][]float64 {
+	scaled := make([][]float64, len(X))
+
+	for index, row := range X {
+		scaled[index] = scaler.Transform(row)
+	}
+
+	return scaled
+}
+
+// This function returns the q quantile of an already sorted slice using linear interpolation
+func quantile(sorted []float64, q float64) float64 {
+	position := q * float64(len(sorted)-1)
+	lower := int(math.Floor(position))
+	upper := int(math.Ceil(position))
+
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(position-float64(lower))
+}
+
+// This function returns the mean and the population standard deviation of the values, both are
+// zero for no values
+func MeanStd(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	mean := sum / float64(len(values))
+
+	variance := 0.0
+	for _, value := range values {
+		variance += (value - mean) * (value - mean)
+	}
+
+	return mean, math.Sqrt(variance / float64(len(values)))
+}
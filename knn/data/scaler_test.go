@@ -0,0 +1,119 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+)
+
+// This function tells if two slices hold the same values up to rounding
+func close_to(a, b []float64) bool {
+	return slices.EqualFunc(a, b, func(x, y float64) bool { return math.Abs(x-y) < 1e-12 })
+}
+
+func TestScaler(t *testing.T) {
+	// The first feature is 1 to 5, the second one is constant
+	X := [][]float64{{3, 7}, {1, 7}, {5, 7}, {2, 7}, {4, 7}}
+
+	tests := []struct {
+		method   string
+		row      []float64
+		expected []float64
+	}{
+		{ScalerMinMax, []float64{1, 7}, []float64{0, 0}},
+		{ScalerMinMax, []float64{5, 9}, []float64{1, 0}},
+		{ScalerMinMax, []float64{2, 7}, []float64{0.25, 0}},
+		{ScalerStandard, []float64{3, 7}, []float64{0, 0}},
+		{ScalerStandard, []float64{3 + math.Sqrt2, 7}, []float64{1, 0}},
+		{ScalerRobust, []float64{3, 7}, []float64{0, 0}},
+		{ScalerRobust, []float64{5, 7}, []float64{1, 0}},
+		{ScalerRobust, []float64{1, 3}, []float64{-1, 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s/%v", test.method, test.row), func(t *testing.T) {
+			scaler, possible_error := FitScaler(test.method, X)
+			if possible_error != nil {
+				t.Fatal(possible_error)
+			}
+
+			if scaled := scaler.Transform(test.row); !close_to(scaled, test.expected) {
+				t.Fatalf("%v scaled to %v, expected %v", test.row, scaled, test.expected)
+			}
+		})
+	}
+}
+
+func TestScalerStatistics(t *testing.T) {
+	scaler, possible_error := FitScaler(ScalerStandard, [][]float64{{3}, {1}, {5}, {2}, {4}})
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	expected := Scaler{
+		Method: ScalerStandard,
+		Min:    []float64{1},
+		Max:    []float64{5},
+		Mean:   []float64{3},
+		Std:    []float64{math.Sqrt2},
+		Median: []float64{3},
+		IQR:    []float64{2},
+	}
+
+	for name, pair := range map[string][2][]float64{
+		"min":    {scaler.Min, expected.Min},
+		"max":    {scaler.Max, expected.Max},
+		"mean":   {scaler.Mean, expected.Mean},
+		"std":    {scaler.Std, expected.Std},
+		"median": {scaler.Median, expected.Median},
+		"iqr":    {scaler.IQR, expected.IQR},
+	} {
+		if !close_to(pair[0], pair[1]) {
+			t.Errorf("%s is %v, expected %v", name, pair[0], pair[1])
+		}
+	}
+}
+
+func TestScalerRefuses(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		X      [][]float64
+	}{
+		{"unknown method", "zscore", [][]float64{{1}}},
+		{"empty matrix", ScalerMinMax, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, possible_error := FitScaler(test.method, test.X)
+			if possible_error == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestMeanStd(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		mean   float64
+		std    float64
+	}{
+		{"empty", nil, 0, 0},
+		{"single", []float64{4}, 4, 0},
+		{"constant", []float64{2, 2, 2}, 2, 0},
+		{"population", []float64{2, 4, 4, 4, 5, 5, 7, 9}, 5, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mean, std := MeanStd(test.values)
+			if math.Abs(mean-test.mean) > 1e-12 || math.Abs(std-test.std) > 1e-12 {
+				t.Fatalf("mean %v and std %v, expected %v and %v", mean, std, test.mean, test.std)
+			}
+		})
+	}
+}
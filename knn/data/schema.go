@@ -0,0 +1,248 @@
+package data
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+)
+
+// The supported column types
+const (
+	TypeInt         = "int"
+	TypeFloat       = "float"
+	TypeCategorical = "categorical"
+)
+
+//go:embed heart.schema.json
+var heart_schema []byte
+
+// Column describes one column of the dataset: its csv header, the json field used by
+// the requests, its type, the values it is allowed to take, how a categorical one is encoded
+// and whether a patient can change it
+type Column struct {
+	Name       string      `json:"name"`
+	Field      string      `json:"field"`
+	Type       string      `json:"type"`
+	Min        *float64    `json:"min,omitempty"`
+	Max        *float64    `json:"max,omitempty"`
+	Values     []float64   `json:"values,omitempty"`
+	Labels     []string    `json:"labels,omitempty"`
+	Encoding   string      `json:"encoding,omitempty"`
+	Modifiable *Modifiable `json:"modifiable,omitempty"`
+}
+
+// Schema describes the dataset columns and which one of them is the label
+type Schema struct {
+	Label   string   `json:"label"`
+	Columns []Column `json:"columns"`
+}
+
+// This function returns the schema of heart.csv embedded in the binary
+func DefaultSchema() (*Schema, error) {
+	return parseSchema(heart_schema)
+}
+
+// This function reads a schema from the given json file
+func LoadSchema(file_name string) (*Schema, error) {
+	content, possible_error := os.ReadFile(file_name)
+	if possible_error != nil {
+		return nil, fmt.Errorf("can't read schema: %w", possible_error)
+	}
+
+	return parseSchema(content)
+}
+
+// This function decodes a schema and makes sure it is consistent
+func parseSchema(content []byte) (*Schema, error) {
+	var schema Schema
+
+	possible_error := json.Unmarshal(content, &schema)
+	if possible_error != nil {
+		return nil, fmt.Errorf("can't decode schema: %w", possible_error)
+	}
+
+	possible_error = schema.Check()
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	return &schema, nil
+}
+
+// This function makes sure the schema can be used to load a dataset
+func (schema *Schema) Check() error {
+	names := map[string]bool{}
+	fields := map[string]bool{}
+	has_label := false
+
+	for _, column := range schema.Columns {
+		if column.Name == "" || column.Field == "" {
+			return errors.New("schema column must have a name and a field")
+		}
+
+		if names[column.Name] || fields[column.Field] {
+			return fmt.Errorf("schema column %s is declared twice", column.Name)
+		}
+		names[column.Name] = true
+		fields[column.Field] = true
+
+		switch column.Type {
+		case TypeInt, TypeFloat:
+		case TypeCategorical:
+			if len(column.Values) == 0 {
+				return fmt.Errorf("categorical column %s must list its values", column.Name)
+			}
+		default:
+			return fmt.Errorf("column %s has unknown type %q", column.Name, column.Type)
+		}
+
+		possible_error := check_encoding(column)
+		if possible_error != nil {
+			return possible_error
+		}
+
+		possible_error = check_modifiable(column)
+		if possible_error != nil {
+			return possible_error
+		}
+
+		if len(column.Labels) > 0 && len(column.Labels) != len(column.Values) {
+			return fmt.Errorf("column %s must have one label per value", column.Name)
+		}
+
+		if column.Min != nil && column.Max != nil && *column.Min > *column.Max {
+			return fmt.Errorf("column %s has min greater than max", column.Name)
+		}
+
+		if column.Name == schema.Label {
+			has_label = true
+		}
+	}
+
+	if !has_label {
+		return fmt.Errorf("label column %q is not declared", schema.Label)
+	}
+
+	if len(schema.Features()) == 0 {
+		return errors.New("schema has no feature columns")
+	}
+
+	return nil
+}
+
+// This function returns the feature columns in order, without the label
+func (schema *Schema) Features() []Column {
+	var features []Column
+
+	for _, column := range schema.Columns {
+		if column.Name != schema.Label {
+			features = append(features, column)
+		}
+	}
+
+	return features
+}
+
+// This function returns the json field names of the feature columns in order
+func (schema *Schema) FeatureFields() []string {
+	var fields []string
+
+	for _, column := range schema.Features() {
+		fields = append(fields, column.Field)
+	}
+
+	return fields
+}
+
+// This function marks which of the feature columns are categorical codes
+func (schema *Schema) Categorical() []bool {
+	var categorical []bool
+
+	for _, column := range schema.Features() {
+		categorical = append(categorical, column.Type == TypeCategorical)
+	}
+
+	return categorical
+}
+
+// This function returns the label column
+func (schema *Schema) LabelColumn() Column {
+	for _, column := range schema.Columns {
+		if column.Name == schema.Label {
+			return column
+		}
+	}
+
+	return Column{}
+}
+
+// This function returns the readable name of a categorical code, or an empty string if it has none
+func (column Column) LabelOf(value float64) string {
+	index := slices.Index(column.Values, value)
+	if index < 0 || index >= len(column.Labels) {
+		return ""
+	}
+
+	return column.Labels[index]
+}
+
+// This function builds a feature vector in schema order from values keyed by json field name,
+// the error is a *ValidationError listing every missing, unknown or invalid field
+func (schema *Schema) Vector(values map[string]float64) ([]float64, error) {
+	field_errors := schema.Validate(values)
+	if len(field_errors) > 0 {
+		return nil, &ValidationError{Fields: field_errors}
+	}
+
+	vector, _, _ := schema.PartialVector(values)
+
+	return vector, nil
+}
+
+// This function builds a feature vector like Vector but accepts missing fields, present marks
+// the features that were given and the missing ones are left at zero for the caller to fill
+func (schema *Schema) PartialVector(values map[string]float64) ([]float64, []bool, error) {
+	field_errors := schema.validate(values, true)
+	if len(field_errors) > 0 {
+		return nil, nil, &ValidationError{Fields: field_errors}
+	}
+
+	features := schema.Features()
+	vector := make([]float64, len(features))
+	present := make([]bool, len(features))
+
+	for index, column := range features {
+		vector[index], present[index] = values[column.Field]
+	}
+
+	return vector, present, nil
+}
+
+// This function makes sure a value matches the column type and allowed range
+func (column Column) Check(value float64) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return errors.New("must be a finite number")
+	}
+
+	if column.Type != TypeFloat && value != math.Trunc(value) {
+		return errors.New("must be a whole number")
+	}
+
+	if column.Type == TypeCategorical && !slices.Contains(column.Values, value) {
+		return fmt.Errorf("must be one of %v", column.Values)
+	}
+
+	if column.Min != nil && value < *column.Min {
+		return fmt.Errorf("must be at least %v", *column.Min)
+	}
+
+	if column.Max != nil && value > *column.Max {
+		return fmt.Errorf("must be at most %v", *column.Max)
+	}
+
+	return nil
+}
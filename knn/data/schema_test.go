@@ -0,0 +1,149 @@
+package data
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// A schema of two features and a label for the small datasets of the tests
+const small_schema = `{
+	"label": "target",
+	"columns": [
+		{"name": "age", "field": "age", "type": "int", "min": 1, "max": 120},
+		{"name": "sex", "field": "gender", "type": "categorical", "values": [0, 1]},
+		{"name": "target", "field": "target", "type": "categorical", "values": [0, 1]}
+	]
+}`
+
+func TestDefaultSchema(t *testing.T) {
+	schema, possible_error := DefaultSchema()
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	if len(schema.Features()) != 13 || schema.LabelColumn().Name != schema.Label {
+		t.Fatalf("%d features with label %q, expected the 13 features of heart.csv", len(schema.Features()), schema.LabelColumn().Name)
+	}
+
+	dataset, possible_error := LoadDataset("../../heart.csv", schema)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	if len(dataset.Features) != 303 || len(dataset.Labels) != 303 {
+		t.Fatalf("%d rows and %d labels, expected 303", len(dataset.Features), len(dataset.Labels))
+	}
+}
+
+func TestSchemaRefuses(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"not json", `schema`},
+		{"no label", `{"label": "target", "columns": [{"name": "age", "field": "age", "type": "int"}]}`},
+		{"only the label", `{"label": "target", "columns": [{"name": "target", "field": "target", "type": "int"}]}`},
+		{"column without a field", `{"label": "target", "columns": [{"name": "age", "type": "int"}, {"name": "target", "field": "target", "type": "int"}]}`},
+		{"column declared twice", `{"label": "target", "columns": [{"name": "age", "field": "age", "type": "int"}, {"name": "age", "field": "years", "type": "int"}, {"name": "target", "field": "target", "type": "int"}]}`},
+		{"unknown type", `{"label": "target", "columns": [{"name": "age", "field": "age", "type": "date"}, {"name": "target", "field": "target", "type": "int"}]}`},
+		{"category without values", `{"label": "target", "columns": [{"name": "sex", "field": "gender", "type": "categorical"}, {"name": "target", "field": "target", "type": "int"}]}`},
+		{"min above max", `{"label": "target", "columns": [{"name": "age", "field": "age", "type": "int", "min": 9, "max": 1}, {"name": "target", "field": "target", "type": "int"}]}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, possible_error := parseSchema([]byte(test.content))
+			if possible_error == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestReadDataset(t *testing.T) {
+	schema, possible_error := parseSchema([]byte(small_schema))
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		features [][]float64
+		labels   []int
+		cells    []CellError
+	}{
+		{
+			name:     "columns in schema order",
+			content:  "age,sex,target\n63,1,1\n41,0,0\n",
+			features: [][]float64{{63, 1}, {41, 0}},
+			labels:   []int{1, 0},
+		},
+		{
+			name:     "columns matched by name",
+			content:  "target, sex ,age,extra\n1,1,63,x\n",
+			features: [][]float64{{63, 1}},
+			labels:   []int{1},
+		},
+		{
+			name:    "every invalid cell is reported",
+			content: "age,sex,target\n63.5,1,1\n41,2,0\nold,0,0\n",
+			cells: []CellError{
+				{Row: 2, Column: "age", Value: "63.5", Reason: "must be a whole number"},
+				{Row: 3, Column: "sex", Value: "2", Reason: "must be one of [0 1]"},
+				{Row: 4, Column: "age", Value: "old", Reason: "is not a number"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dataset, possible_error := ReadDataset(strings.NewReader(test.content), schema)
+
+			if test.cells != nil {
+				var dataset_error *DatasetError
+				if !errors.As(possible_error, &dataset_error) {
+					t.Fatalf("error %v, expected a dataset error", possible_error)
+				}
+				if !slices.Equal(dataset_error.Cells, test.cells) {
+					t.Fatalf("cell errors %+v, expected %+v", dataset_error.Cells, test.cells)
+				}
+				return
+			}
+
+			if possible_error != nil {
+				t.Fatal(possible_error)
+			}
+			if !slices.EqualFunc(dataset.Features, test.features, slices.Equal) || !slices.Equal(dataset.Labels, test.labels) {
+				t.Fatalf("read %v %v, expected %v %v", dataset.Features, dataset.Labels, test.features, test.labels)
+			}
+		})
+	}
+}
+
+func TestReadDatasetRefuses(t *testing.T) {
+	schema, possible_error := parseSchema([]byte(small_schema))
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"empty", ""},
+		{"missing column", "age,target\n63,1\n"},
+		{"no rows", "age,sex,target\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, possible_error := ReadDataset(strings.NewReader(test.content), schema)
+			if possible_error == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package data
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// FieldError describes a field of a request that can't be used for a prediction
+type FieldError struct {
+	Field  string `json:"field"`
+	Value  string `json:"value,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (field_error FieldError) Error() string {
+	if field_error.Value == "" {
+		return fmt.Sprintf("field %s %s", field_error.Field, field_error.Reason)
+	}
+
+	return fmt.Sprintf("field %s value %s %s", field_error.Field, field_error.Value, field_error.Reason)
+}
+
+// ValidationError collects every field error of a request so they can all be fixed at once
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (validation_error *ValidationError) Error() string {
+	var messages []string
+
+	for index, field_error := range validation_error.Fields {
+		if index == max_reported_errors {
+			messages = append(messages, fmt.Sprintf("and %d more", len(validation_error.Fields)-index))
+			break
+		}
+		messages = append(messages, field_error.Error())
+	}
+
+	return fmt.Sprintf("request has %d invalid fields: %s", len(validation_error.Fields), strings.Join(messages, "; "))
+}
+
+// This function checks values keyed by json field name against the schema: every feature must be
+// there and inside its clinical range or categorical domain, and no other field is accepted.
+// The errors follow the schema order with the unknown fields last, sorted by name.
+func (schema *Schema) Validate(values map[string]float64) []FieldError {
+	return schema.validate(values, false)
+}
+
+// This function checks the values against the schema, missing features are only reported
+// when they are not allowed
+func (schema *Schema) validate(values map[string]float64, allow_missing bool) []FieldError {
+	var field_errors []FieldError
+	known := map[string]bool{}
+
+	for _, column := range schema.Features() {
+		known[column.Field] = true
+
+		value, found := values[column.Field]
+		if !found {
+			if allow_missing {
+				continue
+			}
+			field_errors = append(field_errors, FieldError{Field: column.Field, Reason: "is required"})
+			continue
+		}
+
+		possible_error := column.Check(value)
+		if possible_error != nil {
+			field_errors = append(field_errors, FieldError{Field: column.Field, Value: strconv.FormatFloat(value, 'g', -1, 64), Reason: possible_error.Error()})
+		}
+	}
+
+	var unknown []string
+	for field := range values {
+		if !known[field] {
+			unknown = append(unknown, field)
+		}
+	}
+	slices.Sort(unknown)
+
+	for _, field := range unknown {
+		field_errors = append(field_errors, FieldError{Field: field, Reason: "is not a known field"})
+	}
+
+	return field_errors
+}
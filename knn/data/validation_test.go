@@ -0,0 +1,84 @@
+package data
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+)
+
+// This function returns a valid patient of heart.csv keyed by json field name, changed by the given
+// fields, a NaN value removes the field
+func patient(changes map[string]float64) map[string]float64 {
+	values := map[string]float64{
+		"age": 63, "gender": 1, "chest_pain": 3, "resting_blood_pressure": 145, "cholestoral_in_mg": 233,
+		"fasting_blood_sugar": 1, "resting_electrocardiographic_results": 0, "maximum_heart_rate_achieved": 150,
+		"exercise_induced_angina": 0, "previous_peak": 2.3, "slope_of_the_peak_exercise": 0,
+		"number_of_major_vessels": 0, "thalassemia": 1,
+	}
+
+	for field, value := range changes {
+		if math.IsNaN(value) {
+			delete(values, field)
+			continue
+		}
+		values[field] = value
+	}
+
+	return values
+}
+
+func TestValidate(t *testing.T) {
+	schema, possible_error := DefaultSchema()
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	missing := math.NaN()
+
+	tests := []struct {
+		name     string
+		values   map[string]float64
+		expected []FieldError
+	}{
+		{"valid", patient(nil), nil},
+		{"decimal peak", patient(map[string]float64{"previous_peak": 0.1}), nil},
+		{"missing", patient(map[string]float64{"age": missing}), []FieldError{{Field: "age", Reason: "is required"}}},
+		{"below the range", patient(map[string]float64{"age": 0}), []FieldError{{Field: "age", Value: "0", Reason: "must be at least 1"}}},
+		{"above the range", patient(map[string]float64{"resting_blood_pressure": 400}), []FieldError{{Field: "resting_blood_pressure", Value: "400", Reason: "must be at most 250"}}},
+		{"not whole", patient(map[string]float64{"age": 63.5}), []FieldError{{Field: "age", Value: "63.5", Reason: "must be a whole number"}}},
+		{"unknown category", patient(map[string]float64{"chest_pain": 4}), []FieldError{{Field: "chest_pain", Value: "4", Reason: "must be one of [0 1 2 3]"}}},
+		{
+			name:   "every error in schema order with the unknown fields last",
+			values: patient(map[string]float64{"zeta": 1, "thalassemia": 9, "age": missing, "alpha": 2}),
+			expected: []FieldError{
+				{Field: "age", Reason: "is required"},
+				{Field: "thalassemia", Value: "9", Reason: "must be one of [0 1 2 3]"},
+				{Field: "alpha", Reason: "is not a known field"},
+				{Field: "zeta", Reason: "is not a known field"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			field_errors := schema.Validate(test.values)
+			if !slices.Equal(field_errors, test.expected) {
+				t.Fatalf("errors %+v, expected %+v", field_errors, test.expected)
+			}
+
+			vector, possible_error := schema.Vector(test.values)
+			if test.expected == nil {
+				if possible_error != nil || len(vector) != len(schema.Features()) {
+					t.Fatalf("vector %v with error %v", vector, possible_error)
+				}
+				return
+			}
+
+			var validation_error *ValidationError
+			if !errors.As(possible_error, &validation_error) || !slices.Equal(validation_error.Fields, test.expected) {
+				t.Fatalf("error %v, expected the field errors", possible_error)
+			}
+		})
+	}
+}
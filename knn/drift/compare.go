@@ -0,0 +1,245 @@
+package drift
+
+import (
+	"fmt"
+	"knn/data"
+	"math"
+	"slices"
+)
+
+// The number of bins of a numeric feature, their edges are the quantiles of the training values
+const histogram_bins = 10
+
+// An empty bin would make the PSI infinite, its share is raised to this floor
+const psi_floor = 1e-4
+
+// Thresholds decide when a feature raises an alert: a PSI at least PSI or a KS test rejecting the
+// training distribution at KSAlpha. A feature with fewer than MinSamples values never alerts.
+type Thresholds struct {
+	PSI        float64 `json:"psi"`
+	KSAlpha    float64 `json:"ks_alpha"`
+	MinSamples int     `json:"min_samples"`
+}
+
+// This function returns the usual thresholds, a PSI of 0.2 is a significant shift of population
+func DefaultThresholds() Thresholds {
+	return Thresholds{PSI: 0.2, KSAlpha: 0.01, MinSamples: 50}
+}
+
+// This function makes sure the thresholds can decide anything
+func (thresholds Thresholds) Validate() error {
+	if thresholds.PSI <= 0 {
+		return fmt.Errorf("psi threshold must be positive, got %v", thresholds.PSI)
+	}
+
+	if thresholds.KSAlpha <= 0 || thresholds.KSAlpha >= 1 {
+		return fmt.Errorf("ks alpha must be between 0 and 1, got %v", thresholds.KSAlpha)
+	}
+
+	if thresholds.MinSamples < 1 {
+		return fmt.Errorf("min samples must be at least 1, got %d", thresholds.MinSamples)
+	}
+
+	return nil
+}
+
+// Bin is the share of the training and of the recent values falling in a histogram bin or equal
+// to a categorical value. Low and High bound a numeric bin, the first and last bins are open.
+type Bin struct {
+	Value    *float64 `json:"value,omitempty"`
+	Label    string   `json:"label,omitempty"`
+	Low      *float64 `json:"low,omitempty"`
+	High     *float64 `json:"high,omitempty"`
+	Training float64  `json:"training"`
+	Recent   float64  `json:"recent"`
+}
+
+// FeatureDrift compares the recent values of a feature with its training values
+type FeatureDrift struct {
+	Feature      string   `json:"feature"`
+	Type         string   `json:"type"`
+	Samples      int      `json:"samples"`
+	TrainingMean float64  `json:"training_mean"`
+	RecentMean   float64  `json:"recent_mean"`
+	TrainingStd  float64  `json:"training_std"`
+	RecentStd    float64  `json:"recent_std"`
+	Bins         []Bin    `json:"bins"`
+	PSI          float64  `json:"psi"`
+	KS           *float64 `json:"ks,omitempty"`
+	KSPValue     *float64 `json:"ks_p_value,omitempty"`
+	Alert        bool     `json:"alert"`
+	Reasons      []string `json:"reasons,omitempty"`
+}
+
+// Report is the drift of every feature, Alerts lists the features that raised one
+type Report struct {
+	Window     int            `json:"window"`
+	Observed   int64          `json:"observed"`
+	Thresholds Thresholds     `json:"thresholds"`
+	Features   []FeatureDrift `json:"features"`
+	Alerts     []string       `json:"alerts"`
+}
+
+// This function compares the recent values of every feature of the schema with its training
+// values: the PSI over the histogram bins (or the categorical values) and, for numeric features,
+// the two sample Kolmogorov-Smirnov statistic and its p-value
+func Compare(schema *data.Schema, training [][]float64, recent map[string][]float64, thresholds Thresholds) []FeatureDrift {
+	features := schema.Features()
+	drifts := make([]FeatureDrift, len(features))
+
+	for index, column := range features {
+		reference := make([]float64, len(training))
+		for row, values := range training {
+			reference[row] = values[index]
+		}
+		slices.Sort(reference)
+
+		values := slices.Clone(recent[column.Field])
+		slices.Sort(values)
+
+		drift := FeatureDrift{Feature: column.Field, Type: column.Type, Samples: len(values)}
+		drift.TrainingMean, drift.TrainingStd = data.MeanStd(reference)
+		drift.RecentMean, drift.RecentStd = data.MeanStd(values)
+
+		if column.Type == data.TypeCategorical {
+			drift.Bins = categorical_bins(column, reference, values)
+		} else {
+			drift.Bins = numeric_bins(reference, values)
+		}
+
+		if len(values) == 0 {
+			drifts[index] = drift
+			continue
+		}
+
+		for _, bin := range drift.Bins {
+			training_share := max(bin.Training, psi_floor)
+			recent_share := max(bin.Recent, psi_floor)
+			drift.PSI += (recent_share - training_share) * math.Log(recent_share/training_share)
+		}
+
+		if column.Type != data.TypeCategorical {
+			statistic, p_value := kolmogorov_smirnov(reference, values)
+			drift.KS, drift.KSPValue = &statistic, &p_value
+		}
+
+		if drift.Samples >= thresholds.MinSamples {
+			if drift.PSI >= thresholds.PSI {
+				drift.Reasons = append(drift.Reasons, fmt.Sprintf("psi %.3f is at least %v", drift.PSI, thresholds.PSI))
+			}
+			if drift.KSPValue != nil && *drift.KSPValue < thresholds.KSAlpha {
+				drift.Reasons = append(drift.Reasons, fmt.Sprintf("ks %.3f has p-value %.2g below %v", *drift.KS, *drift.KSPValue, thresholds.KSAlpha))
+			}
+			drift.Alert = len(drift.Reasons) > 0
+		}
+
+		drifts[index] = drift
+	}
+
+	return drifts
+}
+
+// This function shares the values among the categorical values of the column
+func categorical_bins(column data.Column, reference []float64, values []float64) []Bin {
+	bins := make([]Bin, len(column.Values))
+
+	for position, value := range column.Values {
+		bins[position] = Bin{
+			Value:    &column.Values[position],
+			Label:    column.LabelOf(value),
+			Training: share(reference, func(other float64) bool { return other == value }),
+			Recent:   share(values, func(other float64) bool { return other == value }),
+		}
+	}
+
+	return bins
+}
+
+// This function shares the values among bins bounded by the deciles of the sorted training values,
+// the same edges can come up more than once for a feature with few distinct values and are merged
+func numeric_bins(reference []float64, values []float64) []Bin {
+	var edges []float64
+	for bin := 1; bin < histogram_bins; bin++ {
+		edge := reference[(len(reference)-1)*bin/histogram_bins]
+		if len(edges) == 0 || edge > edges[len(edges)-1] {
+			edges = append(edges, edge)
+		}
+	}
+
+	bins := make([]Bin, len(edges)+1)
+
+	for position := range bins {
+		var low, high *float64
+		if position > 0 {
+			low = &edges[position-1]
+		}
+		if position < len(edges) {
+			high = &edges[position]
+		}
+
+		inside := func(value float64) bool {
+			return (low == nil || value > *low) && (high == nil || value <= *high)
+		}
+
+		bins[position] = Bin{Low: low, High: high, Training: share(reference, inside), Recent: share(values, inside)}
+	}
+
+	return bins
+}
+
+// This function returns the share of the values for which inside is true
+func share(values []float64, inside func(float64) bool) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	count := 0
+	for _, value := range values {
+		if inside(value) {
+			count++
+		}
+	}
+
+	return float64(count) / float64(len(values))
+}
+
+// This function returns the largest distance between the empirical distributions of two sorted
+// samples and the asymptotic p-value of seeing it if both come from the same distribution
+func kolmogorov_smirnov(first []float64, second []float64) (float64, float64) {
+	statistic := 0.0
+	i, j := 0, 0
+
+	for i < len(first) && j < len(second) {
+		value := min(first[i], second[j])
+		for i < len(first) && first[i] == value {
+			i++
+		}
+		for j < len(second) && second[j] == value {
+			j++
+		}
+
+		distance := math.Abs(float64(i)/float64(len(first)) - float64(j)/float64(len(second)))
+		statistic = max(statistic, distance)
+	}
+
+	effective := math.Sqrt(float64(len(first)*len(second)) / float64(len(first)+len(second)))
+	lambda := (effective + 0.12 + 0.11/effective) * statistic
+
+	// The Kolmogorov distribution as an alternating series, it converges fast unless lambda is tiny
+	p_value := 0.0
+	sign := 1.0
+	for term := 1; term <= 100; term++ {
+		value := sign * 2 * math.Exp(-2*float64(term*term)*lambda*lambda)
+		p_value += value
+		if math.Abs(value) < 1e-10 {
+			break
+		}
+		sign = -sign
+	}
+
+	if lambda < 0.3 {
+		p_value = 1
+	}
+
+	return statistic, math.Min(math.Max(p_value, 0), 1)
+}
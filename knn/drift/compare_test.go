@@ -0,0 +1,131 @@
+package drift
+
+import (
+	"knn/data"
+	"math"
+	"testing"
+)
+
+// This function returns the whole numbers from start up to end
+func sequence(start int, end int) []float64 {
+	values := make([]float64, 0, end-start)
+	for value := start; value < end; value++ {
+		values = append(values, float64(value))
+	}
+
+	return values
+}
+
+func TestKolmogorovSmirnov(t *testing.T) {
+	tests := []struct {
+		name      string
+		first     []float64
+		second    []float64
+		statistic float64
+		low       float64
+		high      float64
+	}{
+		{"same sample", sequence(0, 100), sequence(0, 100), 0, 1, 1},
+		{"disjoint samples", sequence(0, 100), sequence(100, 200), 1, 0, 1e-10},
+		{"half shifted", sequence(0, 100), sequence(50, 150), 0.5, 0, 1e-4},
+		{"every other value", sequence(0, 100), []float64{0, 2, 4, 6, 8, 90, 92, 94, 96, 98}, 0.41, 0.01, 0.1},
+		{"ties in both samples", []float64{1, 1, 2, 2}, []float64{1, 2, 2, 2}, 0.25, 0.9, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			statistic, p_value := kolmogorov_smirnov(test.first, test.second)
+
+			if math.Abs(statistic-test.statistic) > 1e-12 {
+				t.Errorf("statistic is %v, expected %v", statistic, test.statistic)
+			}
+			if p_value < test.low || p_value > test.high {
+				t.Errorf("p-value is %v, expected between %v and %v", p_value, test.low, test.high)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	schema, possible_error := data.DefaultSchema()
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	dataset, possible_error := data.LoadDataset("../../heart.csv", schema)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	features := schema.Features()
+	column := func(field string, change func(float64) float64) []float64 {
+		for index, feature := range features {
+			if feature.Field != field {
+				continue
+			}
+
+			values := make([]float64, len(dataset.Features))
+			for row, row_values := range dataset.Features {
+				values[row] = change(row_values[index])
+			}
+			return values
+		}
+
+		t.Fatalf("no feature %s", field)
+		return nil
+	}
+	same := func(value float64) float64 { return value }
+
+	tests := []struct {
+		name      string
+		field     string
+		recent    []float64
+		alert     bool
+		psi_above float64
+		psi_below float64
+	}{
+		{"numeric unchanged", "age", column("age", same), false, -1, 1e-12},
+		{"numeric shifted", "age", column("age", func(value float64) float64 { return value + 15 }), true, 1, math.Inf(1)},
+		{"numeric shifted but too few", "age", column("age", func(value float64) float64 { return value + 15 })[:10], false, 1, math.Inf(1)},
+		{"categorical unchanged", "gender", column("gender", same), false, -1, 1e-12},
+		{"categorical flipped", "gender", column("gender", func(value float64) float64 { return 1 - value }), true, 0.2, math.Inf(1)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			drifts := Compare(schema, dataset.Features, map[string][]float64{test.field: test.recent}, DefaultThresholds())
+
+			for _, drift := range drifts {
+				if drift.Feature != test.field {
+					// A feature without recent values has nothing to compare
+					if drift.Samples != 0 || drift.PSI != 0 || drift.Alert {
+						t.Errorf("%s has no recent values but %d samples, psi %v and alert %v", drift.Feature, drift.Samples, drift.PSI, drift.Alert)
+					}
+					continue
+				}
+
+				if drift.Samples != len(test.recent) {
+					t.Errorf("%d samples, expected %d", drift.Samples, len(test.recent))
+				}
+				if drift.PSI <= test.psi_above || drift.PSI >= test.psi_below {
+					t.Errorf("psi is %v, expected between %v and %v", drift.PSI, test.psi_above, test.psi_below)
+				}
+				if drift.Alert != test.alert {
+					t.Errorf("alert is %v, expected %v: %v", drift.Alert, test.alert, drift.Reasons)
+				}
+				if (drift.Type == data.TypeCategorical) != (drift.KS == nil) {
+					t.Errorf("a %s feature has ks %v", drift.Type, drift.KS)
+				}
+
+				training, recent := 0.0, 0.0
+				for _, bin := range drift.Bins {
+					training += bin.Training
+					recent += bin.Recent
+				}
+				if math.Abs(training-1) > 1e-9 || math.Abs(recent-1) > 1e-9 {
+					t.Errorf("the bins hold %v of the training values and %v of the recent ones", training, recent)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package drift
+
+import (
+	"sync"
+)
+
+// Monitor keeps the last values of every feature seen in the prediction requests, a feature missing
+// from a request leaves its window untouched
+type Monitor struct {
+	mutex    sync.Mutex
+	size     int
+	observed int64
+	windows  map[string]*window
+}
+
+// window is a ring of the last values of a feature
+type window struct {
+	values []float64
+	next   int
+}
+
+// This function creates a monitor keeping up to size values per feature
+func NewMonitor(size int) *Monitor {
+	return &Monitor{size: size, windows: map[string]*window{}}
+}
+
+// This function adds the feature values of a request to the windows, the oldest values make room
+func (monitor *Monitor) Observe(values map[string]float64) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	monitor.observed++
+
+	for field, value := range values {
+		ring, found := monitor.windows[field]
+		if !found {
+			ring = &window{values: make([]float64, 0, monitor.size)}
+			monitor.windows[field] = ring
+		}
+
+		if len(ring.values) < monitor.size {
+			ring.values = append(ring.values, value)
+			continue
+		}
+
+		ring.values[ring.next] = value
+		ring.next = (ring.next + 1) % monitor.size
+	}
+}
+
+// This function returns a copy of the window of every feature and how many requests were observed
+func (monitor *Monitor) Snapshot() (map[string][]float64, int64) {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+
+	snapshot := make(map[string][]float64, len(monitor.windows))
+	for field, ring := range monitor.windows {
+		snapshot[field] = append([]float64(nil), ring.values...)
+	}
+
+	return snapshot, monitor.observed
+}
+
+// This function returns how many values a window keeps
+func (monitor *Monitor) Size() int {
+	return monitor.size
+}
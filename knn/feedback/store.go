@@ -0,0 +1,448 @@
+package feedback
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// The files of the store. The predictions are appended to the current file until it holds the
+// retention, then it becomes the previous file and the one before is dropped. The outcomes are
+// few and hold their prediction so a confirmed case outlives the rotation.
+const (
+	predictions_file          = "predictions.jsonl"
+	previous_predictions_file = "predictions.previous.jsonl"
+	outcomes_file             = "outcomes.jsonl"
+)
+
+// ErrUnknownPrediction is returned for a prediction id the store never gave or no longer keeps
+var ErrUnknownPrediction = errors.New("unknown prediction id")
+
+// Prediction is a verdict given to a patient, kept so a clinician can confirm it later. The features
+// are the values the request gave, Complete tells if every feature was given so the case can become
+// a training row.
+type Prediction struct {
+	ID           string             `json:"id"`
+	At           time.Time          `json:"at"`
+	ModelVersion string             `json:"model_version"`
+	Model        string             `json:"model"`
+	Features     map[string]float64 `json:"features"`
+	Complete     bool               `json:"complete"`
+	Class        int                `json:"class"`
+	Probability  float64            `json:"probability"`
+}
+
+// Outcome is the diagnosis a clinician confirmed for a prediction
+type Outcome struct {
+	PredictionID string    `json:"prediction_id"`
+	Class        int       `json:"class"`
+	Clinician    string    `json:"clinician"`
+	RecordedAt   time.Time `json:"recorded_at"`
+}
+
+// Case is a prediction with its confirmed outcome
+type Case struct {
+	Prediction Prediction `json:"prediction"`
+	Outcome    Outcome    `json:"outcome"`
+	Correct    bool       `json:"correct"`
+}
+
+// location is where the line of a prediction starts, in the current file or the previous one
+type location struct {
+	previous bool
+	offset   int64
+}
+
+// Store keeps the predictions and their confirmed outcomes in append only files, a later outcome
+// of the same prediction replaces the earlier one. Recording a prediction only queues it, a
+// background writer appends the queue to the current file, and the memory only holds where every
+// kept prediction starts.
+type Store struct {
+	mutex     sync.Mutex
+	writing   sync.Mutex
+	directory string
+	retention int
+	current   *os.File
+	lines     int
+	size      int64
+	pending   []*Prediction
+	queued    chan struct{}
+	written   chan struct{}
+	index     map[string]location
+	outcomes  map[string]Case
+}
+
+// This function opens the store in the directory, reads back where the kept predictions are and the
+// confirmed cases, and starts the background writer. A file keeps up to retention predictions so
+// at least that many and at most twice as many can be confirmed.
+func Open(directory string, retention int) (*Store, error) {
+	if retention < 1 {
+		return nil, fmt.Errorf("prediction retention must be at least 1, got %d", retention)
+	}
+
+	possible_error := os.MkdirAll(directory, 0o755)
+	if possible_error != nil {
+		return nil, fmt.Errorf("can't open outcome store: %w", possible_error)
+	}
+
+	store := &Store{
+		directory: directory,
+		retention: retention,
+		queued:    make(chan struct{}, 1),
+		written:   make(chan struct{}),
+		index:     map[string]location{},
+		outcomes:  map[string]Case{},
+	}
+
+	_, possible_error = store.read_index(previous_predictions_file, true)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	store.lines, possible_error = store.read_index(predictions_file, false)
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	possible_error = read_lines(filepath.Join(directory, outcomes_file), func(confirmed Case, _ int64) {
+		store.outcomes[confirmed.Outcome.PredictionID] = confirmed
+	})
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	possible_error = store.open_current()
+	if possible_error != nil {
+		return nil, possible_error
+	}
+
+	go store.write_queued()
+
+	return store, nil
+}
+
+// This function indexes the predictions of a file by id and returns how many it holds
+func (store *Store) read_index(file_name string, previous bool) (int, error) {
+	lines := 0
+
+	possible_error := read_lines(filepath.Join(store.directory, file_name), func(line struct {
+		ID string `json:"id"`
+	}, offset int64) {
+		store.index[line.ID] = location{previous: previous, offset: offset}
+		lines++
+	})
+
+	return lines, possible_error
+}
+
+// This function opens the current predictions file for appending
+func (store *Store) open_current() error {
+	file, possible_error := os.OpenFile(filepath.Join(store.directory, predictions_file), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0o644)
+	if possible_error != nil {
+		return fmt.Errorf("can't open %s: %w", predictions_file, possible_error)
+	}
+
+	info, possible_error := file.Stat()
+	if possible_error != nil {
+		file.Close()
+		return fmt.Errorf("can't open %s: %w", predictions_file, possible_error)
+	}
+
+	store.current = file
+	store.size = info.Size()
+
+	return nil
+}
+
+// This function gives each prediction a new id and the current time and queues it for the
+// background writer, nothing is written while the request waits
+func (store *Store) Record(predictions ...*Prediction) error {
+	for _, prediction := range predictions {
+		id := make([]byte, 16)
+		_, possible_error := rand.Read(id)
+		if possible_error != nil {
+			return fmt.Errorf("can't create prediction id: %w", possible_error)
+		}
+
+		prediction.ID = hex.EncodeToString(id)
+		prediction.At = time.Now().UTC()
+	}
+
+	store.mutex.Lock()
+	for _, prediction := range predictions {
+		store.pending = append(store.pending, prediction)
+	}
+	store.mutex.Unlock()
+
+	// The writer may be busy with an earlier queue, it picks this one up when it is done
+	select {
+	case store.queued <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// This function writes the queued predictions whenever some are recorded, until the store is closed
+func (store *Store) write_queued() {
+	defer close(store.written)
+
+	for range store.queued {
+		possible_error := store.flush()
+		if possible_error != nil {
+			log.Printf("Can't keep predictions for feedback: %v", possible_error)
+		}
+	}
+}
+
+// This function stops the background writer, writes what is still queued and closes the current
+// file. Nothing can be recorded once the store is closed, the server must be stopped first.
+func (store *Store) Close() error {
+	close(store.queued)
+	<-store.written
+
+	possible_error := store.flush()
+	if possible_error != nil {
+		return possible_error
+	}
+
+	store.writing.Lock()
+	defer store.writing.Unlock()
+
+	return store.current.Close()
+}
+
+// This function appends the queued predictions to the current file in one write and indexes them,
+// the file is rotated first when it holds the retention
+func (store *Store) flush() error {
+	store.writing.Lock()
+	defer store.writing.Unlock()
+
+	store.mutex.Lock()
+	predictions := store.pending
+	store.pending = nil
+	store.mutex.Unlock()
+
+	if len(predictions) == 0 {
+		return nil
+	}
+
+	if store.lines >= store.retention {
+		possible_error := store.rotate()
+		if possible_error != nil {
+			return possible_error
+		}
+	}
+
+	var content bytes.Buffer
+	offsets := make([]int64, len(predictions))
+
+	for position, prediction := range predictions {
+		line, possible_error := json.Marshal(prediction)
+		if possible_error != nil {
+			return fmt.Errorf("can't encode %s: %w", predictions_file, possible_error)
+		}
+
+		offsets[position] = store.size + int64(content.Len())
+		content.Write(line)
+		content.WriteByte('\n')
+	}
+
+	_, possible_error := store.current.Write(content.Bytes())
+	if possible_error != nil {
+		return fmt.Errorf("can't write %s: %w", predictions_file, possible_error)
+	}
+
+	store.size += int64(content.Len())
+	store.lines += len(predictions)
+
+	store.mutex.Lock()
+	for position, prediction := range predictions {
+		store.index[prediction.ID] = location{offset: offsets[position]}
+	}
+	store.mutex.Unlock()
+
+	return nil
+}
+
+// This function makes the current file the previous one and starts a new current file, the
+// predictions of the former previous file can't be confirmed anymore
+func (store *Store) rotate() error {
+	possible_error := store.current.Close()
+	if possible_error != nil {
+		return fmt.Errorf("can't close %s: %w", predictions_file, possible_error)
+	}
+
+	possible_error = os.Rename(filepath.Join(store.directory, predictions_file), filepath.Join(store.directory, previous_predictions_file))
+	if possible_error != nil {
+		return fmt.Errorf("can't rotate %s: %w", predictions_file, possible_error)
+	}
+
+	store.mutex.Lock()
+	for id, where := range store.index {
+		if where.previous {
+			delete(store.index, id)
+		} else {
+			store.index[id] = location{previous: true, offset: where.offset}
+		}
+	}
+	store.mutex.Unlock()
+
+	store.lines = 0
+
+	return store.open_current()
+}
+
+// This function keeps the diagnosis a clinician confirmed for a prediction
+func (store *Store) Confirm(id string, class int, clinician string) (Case, error) {
+	// A prediction still queued is written first so it can be found
+	possible_error := store.flush()
+	if possible_error != nil {
+		return Case{}, possible_error
+	}
+
+	store.writing.Lock()
+	defer store.writing.Unlock()
+
+	store.mutex.Lock()
+	where, found := store.index[id]
+	store.mutex.Unlock()
+
+	if !found {
+		return Case{}, ErrUnknownPrediction
+	}
+
+	prediction, possible_error := store.read_prediction(where)
+	if possible_error != nil {
+		return Case{}, possible_error
+	}
+
+	outcome := Outcome{PredictionID: id, Class: class, Clinician: clinician, RecordedAt: time.Now().UTC()}
+	confirmed := Case{Prediction: prediction, Outcome: outcome, Correct: prediction.Class == class}
+
+	possible_error = append_lines(filepath.Join(store.directory, outcomes_file), confirmed)
+	if possible_error != nil {
+		return Case{}, possible_error
+	}
+
+	store.mutex.Lock()
+	store.outcomes[id] = confirmed
+	store.mutex.Unlock()
+
+	return confirmed, nil
+}
+
+// This function reads the prediction whose line starts at the location
+func (store *Store) read_prediction(where location) (Prediction, error) {
+	var prediction Prediction
+
+	file := store.current
+	if where.previous {
+		previous, possible_error := os.Open(filepath.Join(store.directory, previous_predictions_file))
+		if possible_error != nil {
+			return prediction, fmt.Errorf("can't read %s: %w", previous_predictions_file, possible_error)
+		}
+		defer previous.Close()
+		file = previous
+	}
+
+	line, possible_error := bufio.NewReader(io.NewSectionReader(file, where.offset, 1<<20)).ReadBytes('\n')
+	if possible_error != nil {
+		return prediction, fmt.Errorf("can't read prediction: %w", possible_error)
+	}
+
+	possible_error = json.Unmarshal(line, &prediction)
+	if possible_error != nil {
+		return prediction, fmt.Errorf("can't decode prediction: %w", possible_error)
+	}
+
+	return prediction, nil
+}
+
+// This function returns every confirmed prediction, the first confirmed first
+func (store *Store) Cases() []Case {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	cases := make([]Case, 0, len(store.outcomes))
+	for _, confirmed := range store.outcomes {
+		cases = append(cases, confirmed)
+	}
+
+	slices.SortFunc(cases, func(a, b Case) int { return a.Outcome.RecordedAt.Compare(b.Outcome.RecordedAt) })
+
+	return cases
+}
+
+// This function appends one json line per value to the file
+func append_lines(file_name string, values ...any) error {
+	var content []byte
+
+	for _, value := range values {
+		line, possible_error := json.Marshal(value)
+		if possible_error != nil {
+			return fmt.Errorf("can't encode %s: %w", filepath.Base(file_name), possible_error)
+		}
+		content = append(append(content, line...), '\n')
+	}
+
+	file, possible_error := os.OpenFile(file_name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if possible_error != nil {
+		return fmt.Errorf("can't write %s: %w", filepath.Base(file_name), possible_error)
+	}
+	defer file.Close()
+
+	_, possible_error = file.Write(content)
+	if possible_error != nil {
+		return fmt.Errorf("can't write %s: %w", filepath.Base(file_name), possible_error)
+	}
+
+	return nil
+}
+
+// This function decodes every json line of the file with the offset it starts at, a missing file
+// has no lines. A last line that doesn't decode was cut by a crash while it was appended, it is
+// dropped from the file so the next append starts on a line of its own.
+func read_lines[T any](file_name string, keep func(T, int64)) error {
+	file, possible_error := os.Open(file_name)
+	if errors.Is(possible_error, os.ErrNotExist) {
+		return nil
+	}
+	if possible_error != nil {
+		return fmt.Errorf("can't read %s: %w", filepath.Base(file_name), possible_error)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+
+	offset := int64(0)
+
+	for scanner.Scan() {
+		var value T
+		possible_error = json.Unmarshal(scanner.Bytes(), &value)
+		if possible_error != nil && !scanner.Scan() && scanner.Err() == nil {
+			log.Printf("Dropping the cut last line of %s at byte %d: %v", filepath.Base(file_name), offset, possible_error)
+			return os.Truncate(file_name, offset)
+		}
+		if possible_error != nil {
+			return fmt.Errorf("can't decode %s: %w", filepath.Base(file_name), possible_error)
+		}
+		keep(value, offset)
+
+		offset += int64(len(scanner.Bytes())) + 1
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,198 @@
+package feedback
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// This function records predictions of the given classes and returns their ids
+func record(t *testing.T, store *Store, classes ...int) []string {
+	t.Helper()
+
+	predictions := make([]*Prediction, len(classes))
+	ids := make([]string, len(classes))
+
+	for index, class := range classes {
+		predictions[index] = &Prediction{ModelVersion: "v1", Model: "knn", Features: map[string]float64{"age": float64(40 + index)}, Complete: true, Class: class}
+	}
+
+	possible_error := store.Record(predictions...)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	for index, prediction := range predictions {
+		ids[index] = prediction.ID
+	}
+
+	return ids
+}
+
+// The predictions queued when the store is closed are written and can be confirmed once it is
+// opened again, with the outcomes confirmed before
+func TestStoreConfirm(t *testing.T) {
+	directory := t.TempDir()
+
+	store, possible_error := Open(directory, 100)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	ids := record(t, store, 1, 0, 1)
+
+	first, possible_error := store.Confirm(ids[0], 1, "house")
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+	if !first.Correct || first.Prediction.Features["age"] != 40 || first.Outcome.Clinician != "house" {
+		t.Fatalf("confirmed %+v", first)
+	}
+
+	possible_error = store.Close()
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	store, possible_error = Open(directory, 100)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+	defer store.Close()
+
+	second, possible_error := store.Confirm(ids[1], 1, "cuddy")
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+	if second.Correct {
+		t.Fatalf("a negative prediction confirmed positive is correct: %+v", second)
+	}
+
+	// A later outcome replaces the earlier one
+	_, possible_error = store.Confirm(ids[0], 0, "house")
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	cases := store.Cases()
+	if len(cases) != 2 || cases[0].Outcome.PredictionID != ids[1] || cases[1].Outcome.PredictionID != ids[0] || cases[1].Correct {
+		t.Fatalf("cases %+v", cases)
+	}
+
+	if _, possible_error := store.Confirm("missing", 1, "house"); !errors.Is(possible_error, ErrUnknownPrediction) {
+		t.Fatalf("confirming a missing prediction: %v", possible_error)
+	}
+}
+
+// A file holds the retention, the predictions of the file before the previous one are forgotten
+func TestStoreRotation(t *testing.T) {
+	directory := t.TempDir()
+
+	store, possible_error := Open(directory, 2)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	var ids []string
+	for range 5 {
+		ids = append(ids, record(t, store, 1)...)
+
+		possible_error = store.flush()
+		if possible_error != nil {
+			t.Fatal(possible_error)
+		}
+	}
+
+	possible_error = store.Close()
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	store, possible_error = Open(directory, 2)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+	defer store.Close()
+
+	for index, id := range ids {
+		_, possible_error := store.Confirm(id, 1, "house")
+		if forgotten := index < 2; forgotten != errors.Is(possible_error, ErrUnknownPrediction) {
+			t.Errorf("prediction %d: %v", index+1, possible_error)
+		}
+	}
+}
+
+// A line cut by a crash while it was appended is dropped when the store is opened, the next line
+// starts on its own and a broken line before the last one still fails
+func TestStoreRecovery(t *testing.T) {
+	directory := t.TempDir()
+
+	store, possible_error := Open(directory, 100)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+	ids := record(t, store, 1, 1)
+	_, possible_error = store.Confirm(ids[0], 1, "house")
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+	possible_error = store.Close()
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	for _, file_name := range []string{predictions_file, outcomes_file} {
+		file, possible_error := os.OpenFile(filepath.Join(directory, file_name), os.O_APPEND|os.O_WRONLY, 0o644)
+		if possible_error != nil {
+			t.Fatal(possible_error)
+		}
+		file.WriteString(`{"id":"cut`)
+		file.Close()
+	}
+
+	store, possible_error = Open(directory, 100)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	if cases := store.Cases(); len(cases) != 1 {
+		t.Fatalf("%d cases after the recovery, expected 1", len(cases))
+	}
+
+	more := record(t, store, 0)
+	for _, id := range append(ids, more...) {
+		_, possible_error = store.Confirm(id, 0, "cuddy")
+		if possible_error != nil {
+			t.Fatal(possible_error)
+		}
+	}
+	possible_error = store.Close()
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	// The cut lines are gone so the store opens with every outcome
+	store, possible_error = Open(directory, 100)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+	if cases := store.Cases(); len(cases) != 3 {
+		t.Fatalf("%d cases after reopening, expected 3", len(cases))
+	}
+	store.Close()
+
+	content, possible_error := os.ReadFile(filepath.Join(directory, predictions_file))
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+	possible_error = os.WriteFile(filepath.Join(directory, predictions_file), append([]byte("broken\n"), content...), 0o644)
+	if possible_error != nil {
+		t.Fatal(possible_error)
+	}
+
+	_, possible_error = Open(directory, 100)
+	if possible_error == nil {
+		t.Fatal("expected an error for a broken line before the last one")
+	}
+}